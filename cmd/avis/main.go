@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -19,46 +20,128 @@ import (
 	"github.com/obicons/avis/executor"
 	"github.com/obicons/avis/hinj"
 	"github.com/obicons/avis/platforms"
-	"github.com/obicons/avis/sim"
 )
 
+// The fields a workload command template may use.
 type workloadInfo struct {
 	AutopilotName string
+	// which of the side-by-side vehicles the workload flies (see -workers)
+	Instance int
+	// where the workload reaches its vehicle, e.g. udp:127.0.0.1:14550
+	MAVLinkAddr string
+	// where the workload reaches the RPC server
+	RPCAddr string
 }
 
 type stats struct {
-	totalUnsafe       uint
-	unsafeFromGPS     uint
-	unsafeFromBaros   uint
-	unsafeFromAccel   uint
-	unsafeFromCompass uint
-	unsafeFromGyro    uint
+	totalUnsafe uint
+	// unsafe scenarios with a fault in each sensor type
+	unsafeBySensor   map[hinj.Sensor]uint
+	unsafeFromSpoof  uint
+	vacuousRuns      uint
+	inconsistentRuns uint
+	// runs the workload cut short by exiting early; these are not unsafe scenarios
+	crashedRuns uint
 }
 
 var (
-	rpcAddr                       = flag.String("rpc.addr", getRPCAddr(), "URL of RPC server")
+	rpcAddr                       = flag.String("rpc.addr", getRPCAddr(), "URL of RPC server (unix:///path or tcp://host:port)")
+	hinjAddr                      = flag.String("hinj.addr", getHINJAddr(), "URL of HINJ server (unix:///path or tcp://host:port)")
 	autopilot                     = flag.String("autopilot", "", "Autopilot to test (ardupilot or px4)")
 	workloadCmd                   = flag.String("workload.cmd", "", "Command of workload (accepts a Go template)")
 	workloadTimeoutSeconds        = flag.Uint("workload.timeout", 300, "Timeout of workload (seconds)")
+	startupTimeoutSeconds         = flag.Uint("startup.timeout", 60, "Time the simulator and autopilot each have to become ready (seconds)")
 	inReplay                      = flag.Bool("replay", false, "Perform a replay (requires replay.path to be setup)")
-	replayPath                    = flag.String("replay.path", "", "Path to a file containing a trace to replay")
+	replayPath                    = flag.String("replay.path", "", "Path to a bug bundle, or a file containing a failure plan, to replay")
 	outputLocation                = flag.String("output", getOutputLocation(), "")
-	doSensorTrace                 = flag.Bool("sensor.trace", false, "record the outputs of sensors")
-	accelOutputLocation           = flag.String("sensor.accel.output", getSensorOutputLocation("accel"), "")
-	gpsOutputLocation             = flag.String("sensor.gps.output", getSensorOutputLocation("gps"), "")
-	gyroOutputLocation            = flag.String("sensor.gyro.output", getSensorOutputLocation("gyro"), "")
-	compassOutputLocation         = flag.String("sensor.compass.output", getSensorOutputLocation("compass"), "")
-	barometerOutputLocation       = flag.String("sensor.barometer.output", getSensorOutputLocation("barometer"), "")
+	doSensorTrace                 = flag.Bool("sensor.trace", false, "Stream the sensor packets HINJ sends back to disk, in every run (see -sensor.*.output)")
+	sensorTraceEvery              = flag.Uint64("sensor.every", 0, "Trace only the packets sent during every Nth iteration (0 traces every iteration)")
+	sensorTraceRate               = flag.Float64("sensor.rate", 0, "Trace at most this many packets per second of each sensor instance (0 is unlimited)")
+	accelOutputLocation           = flag.String("sensor.accel.output", getSensorOutputLocation("accel.jsonl"), "Stream the accel trace to this file (JSON Lines; empty skips it)")
+	gpsOutputLocation             = flag.String("sensor.gps.output", getSensorOutputLocation("gps.jsonl"), "Stream the gps trace to this file (JSON Lines; empty skips it)")
+	gyroOutputLocation            = flag.String("sensor.gyro.output", getSensorOutputLocation("gyro.jsonl"), "Stream the gyro trace to this file (JSON Lines; empty skips it)")
+	compassOutputLocation         = flag.String("sensor.compass.output", getSensorOutputLocation("compass.jsonl"), "Stream the compass trace to this file (JSON Lines; empty skips it)")
+	barometerOutputLocation       = flag.String("sensor.barometer.output", getSensorOutputLocation("barometer.jsonl"), "Stream the barometer trace to this file (JSON Lines; empty skips it)")
+	sensorOutputs                 = flag.String("sensor.outputs", "", "Comma-separated Name=path pairs streaming more sensor types' traces, e.g. custom ones (JSON Lines)")
 	repl                          = flag.Bool("repl", false, "launch program in REPL mode (does no checking; runs vehicle + hinj)")
-	modeOutputDirectory           = flag.String("sensor.mode.output", getSensorOutputLocation("mode"), "")
+	modeOutputDirectory           = flag.String("sensor.mode.output", getSensorOutputLocation("mode.json"), "")
+	faultDuration                 = flag.Uint64("fault.duration", 0, "Iterations each explored failure lasts (0 means permanent)")
+	faultOnTime                   = flag.Uint64("fault.on", 0, "Iterations an intermittent failure stays failed (requires fault.off)")
+	faultOffTime                  = flag.Uint64("fault.off", 0, "Iterations an intermittent failure stays recovered (requires fault.on)")
+	hinjRecordPath                = flag.String("hinj.record", "", "Record every HINJ packet to this file (model checking appends the run number)")
+	hinjReplayPath                = flag.String("hinj.replay", "", "Replay the HINJ trace in this file in place of live sensors")
+	hinjRulesPath                 = flag.String("hinj.rules", "", "Apply the HINJ rules in this JSON file to every run")
+	hinjConsistency               = flag.Bool("hinj.consistency", true, "Record periods during which the instances of a redundant sensor disagree")
+	hinjConsistencyAnomaly        = flag.Bool("hinj.consistency.anomaly", false, "Report instances that disagree for too long as an anomaly (requires hinj.consistency)")
+	workers                       = flag.Int("workers", 1, "Number of scenarios to run in parallel, each with its own autopilot and simulator")
+	workersDir                    = flag.String("workers.dir", getWorkersDir(), "Directory holding each worker's sockets and state (requires workers > 1)")
+	exploreBattery                = flag.Bool("fault.battery", true, "Explore battery faults (voltage sag, drain, stuck current, cell failure)")
+	exploreRC                     = flag.Bool("fault.rc", true, "Explore RC input faults (loss, stick freeze, channel loss, out-of-range PWM)")
+	exploreSpoofing               = flag.Bool("fault.spoofing", true, "Explore GPS spoofing and meaconing attacks")
+	faultModelNames               = flag.String("fault.models", "ignore", "Comma-separated fault models to explore (ignore, bias, drift, noise, stuck, scale, delay, drop, reorder)")
 	signals                       = make(chan os.Signal, 1)
-	statistics              stats = stats{}
+	statistics              stats = stats{unsafeBySensor: make(map[hinj.Sensor]uint)}
+	faultKinds              []hinj.FaultKind
+	// where each sensor type is traced, by the name of its packet type
+	traceOutputs map[string]string
 )
 
+// GPS attacks we explore; each one hits every GPS receiver at once.
+var gpsAttacks = []hinj.FaultModel{
+	hinj.GPSSpoof(1, 0, 0),
+	hinj.GPSSpoof(5, 90, 0),
+	hinj.GPSSpoof(2, 225, -0.5),
+	hinj.GPSMeaconing(2),
+	hinj.GPSMeaconing(10),
+}
+
 func main() {
 	flag.Parse()
 	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
 
+	for _, name := range strings.Split(*faultModelNames, ",") {
+		kind, err := hinj.ParseFaultKind(strings.TrimSpace(name))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: -fault.models: %s\n", err)
+			os.Exit(1)
+		} else if kind == hinj.FaultSpoof || kind == hinj.FaultMeaconing {
+			fmt.Fprintf(os.Stderr, "error: -fault.models: %s is a GPS attack; use -fault.spoofing\n", kind)
+			os.Exit(1)
+		}
+		faultKinds = append(faultKinds, kind)
+	}
+	if (*faultOnTime == 0) != (*faultOffTime == 0) {
+		fmt.Fprintf(os.Stderr, "error: -fault.on and -fault.off must be specified together.\n")
+		os.Exit(1)
+	}
+	if *workers < 1 {
+		fmt.Fprintf(os.Stderr, "error: -workers must be at least 1.\n")
+		os.Exit(1)
+	}
+	if *sensorTraceRate < 0 {
+		fmt.Fprintf(os.Stderr, "error: -sensor.rate must not be negative.\n")
+		os.Exit(1)
+	}
+	traceOutputs = map[string]string{
+		"Accelerometer": *accelOutputLocation,
+		"GPS":           *gpsOutputLocation,
+		"Gyroscope":     *gyroOutputLocation,
+		"Compass":       *compassOutputLocation,
+		"Barometer":     *barometerOutputLocation,
+	}
+	for _, pair := range strings.Split(*sensorOutputs, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		sensorType, err := hinj.ParseSensor(strings.TrimSpace(parts[0]))
+		if err != nil || len(parts) != 2 {
+			fmt.Fprintf(os.Stderr, "error: -sensor.outputs: expected Name=path for a sensor type, found %q\n", pair)
+			os.Exit(1)
+		}
+		traceOutputs[sensorType.String()] = strings.TrimSpace(parts[1])
+	}
+
 	if *inReplay {
 		if *replayPath == "" {
 			fmt.Fprintf(os.Stderr, "error: -replay.path must be specified with -replay.\n")
@@ -67,8 +150,12 @@ func main() {
 			fmt.Fprintf(os.Stderr, "error: %s\n", err)
 			os.Exit(1)
 		} else if info.IsDir() {
-			fmt.Fprintf(os.Stderr, "error: %s is not a file\n", *replayPath)
-			os.Exit(1)
+			// a bug bundle
+			*replayPath = path.Join(*replayPath, executor.BundleFailurePlanName)
+			if _, err := os.Stat(*replayPath); err != nil {
+				fmt.Fprintf(os.Stderr, "error: %s\n", err)
+				os.Exit(1)
+			}
 		}
 		performReplay()
 	} else if *repl {
@@ -81,85 +168,69 @@ func main() {
 	}
 }
 
+// the positions the vehicle flew through in the profiling run
+var goldenRunPositions []entities.Position
+
 // called to perform a profile run and start the model checking process
 func performModelChecking() {
-	system := getAutoPilot(*autopilot)
-	hinj, err := hinj.NewHINJServer(getHINJAddr())
-	if err != nil {
-		log.Fatalf("Could not create a new HINJ server: %s\n", err)
-	}
-
-	config, _ := system.GetGazeboConfig()
-
-	gazebo, err := sim.NewGazeboFromEnv(config)
-	if err != nil {
-		log.Fatalf("Could not get a gazebo instance: %s\n", err)
-	}
-
-	workloadCmd, err := parseWorkloadTemplate(*autopilot, *workloadCmd)
-	if err != nil {
-		log.Fatalf("Could not parse workload command: %s\n", err)
+	pool := make([]*worker, *workers)
+	for id := range pool {
+		var err error
+		if pool[id], err = newWorker(id, len(pool)); err != nil {
+			log.Fatalf("Could not create worker %d: %s\n", id, err)
+		}
 	}
 
 	// this is a profiling run
 	positionRecorder := detector.NewPositionRecorder()
-	var modeChangeTimes []uint64
-	recordModeChanges := func(iterations uint64, mode int) {
-		modeChangeTimes = append(modeChangeTimes, iterations)
-	}
 
 	ex := executor.Executor{
-		HINJServer:  hinj,
-		Simulator:   gazebo,
-		Autopilot:   system,
-		WorkloadCmd: workloadCmd,
-		Timeout:     time.Duration(*workloadTimeoutSeconds) * time.Second,
-		RPCAddr:     *rpcAddr,
+		HINJServer:     pool[0].hinjServer,
+		Simulator:      pool[0].simulator,
+		Autopilot:      pool[0].autopilot,
+		WorkloadCmd:    pool[0].workloadCmd,
+		WorkloadEnv:    pool[0].workloadEnv,
+		Timeout:        time.Duration(*workloadTimeoutSeconds) * time.Second,
+		StartupTimeout: time.Duration(*startupTimeoutSeconds) * time.Second,
+		RPCAddr:        pool[0].rpcAddr,
 		Detectors: []detector.Detector{
 			detector.NewTimeoutDetector(time.Duration(*workloadTimeoutSeconds) * time.Second),
 			positionRecorder,
 			detector.NewFreeFallDetector(),
 		},
-		ModeChangeHandler: recordModeChanges,
-		TraceParameters: entities.SensorTraceParameters{
-			TraceSensors:         *doSensorTrace,
-			AccelTraceOutput:     *accelOutputLocation,
-			GPSTraceOutput:       *gpsOutputLocation,
-			GyroTraceOutput:      *gyroOutputLocation,
-			CompassTraceOutput:   *compassOutputLocation,
-			BarometerTraceOutput: *barometerOutputLocation,
-		},
+		HINJRecordPath:       *hinjRecordPath,
+		HINJReplayPath:       *hinjReplayPath,
+		HINJRulesPath:        *hinjRulesPath,
+		MonitorConsistency:   *hinjConsistency,
+		ConsistencyAnomalies: *hinjConsistencyAnomaly,
+		TraceParameters:      sensorTraceParameters(false),
 	}
 
 	log.Println("Performing a dry run...")
-	doneChan := make(chan int)
+	resultChan := make(chan *executor.RunResult)
 	go func() {
-		if err = ex.Execute(); err != nil {
+		result, err := ex.Execute()
+		if err != nil {
 			log.Fatalf("Error executing: %s\n", err)
 		}
-		doneChan <- 1
+		resultChan <- result
 	}()
 
+	var modeChangeTimes []uint64
 	select {
 	case <-signals:
 		log.Println("Received signal, exiting")
 		os.Exit(0)
-	case <-doneChan:
-		// do nothing, this is normal
+	case result := <-resultChan:
+		modeChangeTimes = result.ModeChangeIterations()
 	}
 
 	if err := saveModes(modeChangeTimes); err != nil {
 		log.Printf("error saving mode transitions: %s", err)
 	}
 
-	doModelChecking(
-		hinj,
-		gazebo,
-		system,
-		workloadCmd,
-		positionRecorder.(*detector.PositionRecorder).GetPositions(),
-		modeChangeTimes,
-	)
+	goldenRunPositions = positionRecorder.(*detector.PositionRecorder).GetPositions()
+	doModelChecking(pool, modeChangeTimes)
 }
 
 // performs a replay
@@ -176,39 +247,35 @@ func performReplay() {
 		panic(err)
 	}
 
-	system := getAutoPilot(*autopilot)
-	hinj, err := hinj.NewHINJServer(getHINJAddr())
-	if err != nil {
-		log.Fatalf("Could not create a new HINJ server: %s\n", err)
-	}
-
-	config, _ := system.GetGazeboConfig()
-
-	gazebo, err := sim.NewGazeboFromEnv(config)
-	if err != nil {
-		log.Fatalf("Could not get a gazebo instance: %s\n", err)
-	}
-
-	workloadCmd, err := parseWorkloadTemplate(*autopilot, *workloadCmd)
+	w, err := newWorker(0, 1)
 	if err != nil {
-		log.Fatalf("Could not parse workload command: %s\n", err)
+		log.Fatalf("Could not create a worker: %s\n", err)
 	}
 
 	ex := executor.Executor{
-		HINJServer:  hinj,
-		Simulator:   gazebo,
-		Autopilot:   system,
-		WorkloadCmd: workloadCmd,
-		Timeout:     time.Duration(*workloadTimeoutSeconds) * time.Second,
-		RPCAddr:     *rpcAddr,
+		HINJServer:     w.hinjServer,
+		Simulator:      w.simulator,
+		Autopilot:      w.autopilot,
+		WorkloadCmd:    w.workloadCmd,
+		WorkloadEnv:    w.workloadEnv,
+		Timeout:        time.Duration(*workloadTimeoutSeconds) * time.Second,
+		StartupTimeout: time.Duration(*startupTimeoutSeconds) * time.Second,
+		RPCAddr:        w.rpcAddr,
 		Detectors: []detector.Detector{
 			detector.NewTimeoutDetector(time.Duration(*workloadTimeoutSeconds) * time.Second),
 			detector.NewFreeFallDetector(),
 		},
-		ModeChangeHandler:  func(totalIterations uint64, modeNumber int) {},
-		MissionFailurePlan: failurePlan,
-	}
-	if err = ex.Execute(); err != nil {
+		ModeChangeHandler:    func(totalIterations uint64, modeNumber int) {},
+		MissionFailurePlan:   failurePlan,
+		OutputLocation:       *outputLocation,
+		TraceParameters:      sensorTraceParameters(true),
+		HINJRecordPath:       *hinjRecordPath,
+		HINJReplayPath:       *hinjReplayPath,
+		HINJRulesPath:        *hinjRulesPath,
+		MonitorConsistency:   *hinjConsistency,
+		ConsistencyAnomalies: *hinjConsistencyAnomaly,
+	}
+	if _, err = ex.Execute(); err != nil {
 		panic(err)
 	}
 
@@ -216,48 +283,38 @@ func performReplay() {
 
 // launches a REPL
 func performREPL() {
-	system := getAutoPilot(*autopilot)
-	hinj, err := hinj.NewHINJServer(getHINJAddr())
-	if err != nil {
-		log.Fatalf("Could not create a new HINJ server: %s\n", err)
-	}
-
-	config, _ := system.GetGazeboConfig()
-
-	gazebo, err := sim.NewGazeboFromEnv(config)
-	if err != nil {
-		log.Fatalf("Could not get a gazebo instance: %s\n", err)
-	}
-
-	workloadCmd, err := parseWorkloadTemplate(*autopilot, *workloadCmd)
+	w, err := newWorker(0, 1)
 	if err != nil {
-		log.Fatalf("Could not parse workload command: %s\n", err)
+		log.Fatalf("Could not create a worker: %s\n", err)
 	}
 
 	ex := executor.Executor{
-		HINJServer:        hinj,
-		Simulator:         gazebo,
-		Autopilot:         system,
-		WorkloadCmd:       workloadCmd,
-		Timeout:           time.Duration(*workloadTimeoutSeconds) * time.Second,
-		RPCAddr:           *rpcAddr,
-		ModeChangeHandler: func(totalIterations uint64, modeNumber int) {},
-		REPL:              true,
-	}
-	if err = ex.Execute(); err != nil {
+		HINJServer:           w.hinjServer,
+		Simulator:            w.simulator,
+		Autopilot:            w.autopilot,
+		WorkloadCmd:          w.workloadCmd,
+		WorkloadEnv:          w.workloadEnv,
+		Timeout:              time.Duration(*workloadTimeoutSeconds) * time.Second,
+		StartupTimeout:       time.Duration(*startupTimeoutSeconds) * time.Second,
+		RPCAddr:              w.rpcAddr,
+		ModeChangeHandler:    func(totalIterations uint64, modeNumber int) {},
+		REPL:                 true,
+		HINJRecordPath:       *hinjRecordPath,
+		HINJReplayPath:       *hinjReplayPath,
+		HINJRulesPath:        *hinjRulesPath,
+		MonitorConsistency:   *hinjConsistency,
+		ConsistencyAnomalies: *hinjConsistencyAnomaly,
+	}
+	if _, err = ex.Execute(); err != nil {
 		panic(err)
 	}
 
 }
 
-// does the actual checking
-func doModelChecking(hinjServer *hinj.HINJServer,
-	sim sim.Sim,
-	autopilot platforms.System,
-	workloadCmd string,
-	positions []entities.Position,
-	modeChangeTimes []uint64) {
-
+// does the actual checking.
+// each worker runs scenarios from the shared queue, and new scenarios are
+// enqueued as runs finish, until the queue is empty and every worker is idle.
+func doModelChecking(pool []*worker, modeChangeTimes []uint64) {
 	// The first item of failurePlans is the next scenario we consider and so on.
 	// FIFO order.
 	var failurePlans [][]executor.FailurePlan
@@ -265,88 +322,161 @@ func doModelChecking(hinjServer *hinj.HINJServer,
 	// Tracks the failure scenarios that we have considered
 	consideredScenarios := make(map[uint64]bool)
 
-	enqueueScenarios(modeChangeTimes, &failurePlans, consideredScenarios)
-	for len(failurePlans) > 0 {
-		// dequeue the next failure plan
-		nextFailurePlan := failurePlans[0]
-		failurePlans = failurePlans[1:]
-
-		fmt.Println(nextFailurePlan)
+	// cancelled to stop the runs in progress when we are signalled
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-		// we will use this information to create new failure plans
-		var modeChangeTimes []uint64
-		recordModeChanges := func(iterations uint64, mode int) {
-			modeChangeTimes = append(modeChangeTimes, iterations)
-		}
+	jobs := make(chan job)
+	results := make(chan jobResult)
+	for _, w := range pool {
+		go w.work(ctx, jobs, results)
+	}
+	defer close(jobs)
 
-		ex := executor.Executor{
-			HINJServer:  hinjServer,
-			Simulator:   sim,
-			Autopilot:   autopilot,
-			WorkloadCmd: workloadCmd,
-			Timeout:     time.Duration(*workloadTimeoutSeconds) * time.Second,
-			RPCAddr:     *rpcAddr,
-			Detectors: []detector.Detector{
-				detector.NewTimeoutDetector(time.Duration(*workloadTimeoutSeconds) * time.Second),
-				detector.NewFreeFallDetector(),
-				detector.NewDeviantDetector(positions),
-			},
-			ModeChangeHandler:  recordModeChanges,
-			MissionFailurePlan: nextFailurePlan,
-			OutputLocation:     *outputLocation,
+	enqueueScenarios(modeChangeTimes, &failurePlans, consideredScenarios)
+	runNumber, running := 0, 0
+	for len(failurePlans) > 0 || running > 0 {
+		// only offer a job while there is one to offer
+		var nextJobs chan<- job
+		var nextJob job
+		if len(failurePlans) > 0 {
+			nextJobs = jobs
+			nextJob = job{runNumber: runNumber, failurePlan: failurePlans[0]}
 		}
-		doneChan := make(chan int)
-		go func() {
-			if err := ex.Execute(); err != nil {
-				log.Fatalf("Error executing: %s\n", err)
-			}
-			doneChan <- 1
-		}()
 
 		select {
 		case <-signals:
 			log.Println("Received signal, exiting.")
-			displayStats()
+			stopCampaign(cancel, results, running)
 			os.Exit(0)
-		case <-doneChan:
-			// do nothing, this is normal
+		case nextJobs <- nextJob:
+			// dequeue the failure plan a worker took
+			fmt.Println(nextJob.failurePlan)
+			failurePlans = failurePlans[1:]
+			runNumber++
+			running++
+		case result := <-results:
+			running--
+			if result.err != nil {
+				log.Println(result.err)
+				stopCampaign(cancel, results, running)
+				os.Exit(1)
+			}
+			recordResult(result.RunResult, &failurePlans, consideredScenarios)
 		}
+	}
+}
 
-		// update our statistics
-		if !ex.MissionSuccessful {
-			updateStats(nextFailurePlan)
-		}
+// cuts short the running jobs and waits for them, which lets each worker stop its autopilot and simulator.
+// Then, displays the statistics gathered so far.
+func stopCampaign(cancel context.CancelFunc, results <-chan jobResult, running int) {
+	cancel()
+	for ; running > 0; running-- {
+		<-results
+	}
+	displayStats()
+}
 
-		// enqeueue the same failures of this run, but with the failure time shifted
-		var shiftedFailures []executor.FailurePlan
-		for _, failure := range nextFailurePlan {
-			shiftedFailure := failure
-			shiftedFailure.FailureTime += 1
-			shiftedFailures = append(shiftedFailures, shiftedFailure)
-		}
+// updates our statistics with a finished run, and enqueues the scenarios it suggests
+func recordResult(result *executor.RunResult, failurePlans *[][]executor.FailurePlan, consideredScenarios map[uint64]bool) {
+	if len(result.VacuousFailures) != 0 {
+		statistics.vacuousRuns++
+	}
+	if len(result.Inconsistencies) != 0 {
+		statistics.inconsistentRuns++
+	}
+	if result.WorkloadCrashed() {
+		statistics.crashedRuns++
+	} else if !result.Successful() {
+		updateStats(result.FailurePlan)
+	}
 
-		// enqueues only if we haven't considered the shifted failure
-		if hash, err := hashstructure.Hash(shiftedFailures, nil); err != nil {
-			// this should never occur
-			panic(err)
-		} else if !consideredScenarios[hash] {
-			consideredScenarios[hash] = true
-			failurePlans = append(failurePlans, shiftedFailures)
-		} // otherwise, we don't need to consider the shifted scenario
+	// enqeueue the same failures of this run, but with the failure time shifted
+	var shiftedFailures []executor.FailurePlan
+	for _, failure := range result.FailurePlan {
+		shiftedFailure := failure
+		shiftedFailure.FailureTime += 1
+		shiftedFailures = append(shiftedFailures, shiftedFailure)
+	}
 
-		enqueueScenarios(modeChangeTimes, &failurePlans, consideredScenarios)
-		if err := saveModes(modeChangeTimes); err != nil {
-			log.Printf("error saving mode transitions: %s", err)
-		}
+	// enqueues only if we haven't considered the shifted failure
+	if hash, err := hashstructure.Hash(shiftedFailures, nil); err != nil {
+		// this should never occur
+		panic(err)
+	} else if !consideredScenarios[hash] {
+		consideredScenarios[hash] = true
+		*failurePlans = append(*failurePlans, shiftedFailures)
+	} // otherwise, we don't need to consider the shifted scenario
+
+	modeChangeTimes := result.ModeChangeIterations()
+	enqueueScenarios(modeChangeTimes, failurePlans, consideredScenarios)
+	if err := saveModes(modeChangeTimes); err != nil {
+		log.Printf("error saving mode transitions: %s", err)
+	}
+}
+
+// returns an executor that runs failurePlan on w
+func newModelCheckingExecutor(w *worker, failurePlan []executor.FailurePlan) *executor.Executor {
+	return &executor.Executor{
+		HINJServer:     w.hinjServer,
+		Simulator:      w.simulator,
+		Autopilot:      w.autopilot,
+		WorkloadCmd:    w.workloadCmd,
+		WorkloadEnv:    w.workloadEnv,
+		Timeout:        time.Duration(*workloadTimeoutSeconds) * time.Second,
+		StartupTimeout: time.Duration(*startupTimeoutSeconds) * time.Second,
+		RPCAddr:        w.rpcAddr,
+		Detectors: []detector.Detector{
+			detector.NewTimeoutDetector(time.Duration(*workloadTimeoutSeconds) * time.Second),
+			detector.NewFreeFallDetector(),
+			detector.NewDeviantDetector(goldenRunPositions),
+		},
+		MissionFailurePlan:   failurePlan,
+		OutputLocation:       *outputLocation,
+		LogPrefix:            w.instance.LogPrefix(),
+		TraceParameters:      sensorTraceParameters(true),
+		HINJRulesPath:        *hinjRulesPath,
+		MonitorConsistency:   *hinjConsistency,
+		ConsistencyAnomalies: *hinjConsistencyAnomaly,
+	}
+}
+
+// returns the sensor tracing the flags ask for.
+// perRun gives each run its own traces, next to the outputs the flags name.
+func sensorTraceParameters(perRun bool) entities.SensorTraceParameters {
+	return entities.SensorTraceParameters{
+		TraceSensors: *doSensorTrace,
+		Outputs:      traceOutputs,
+		Sampling: entities.SensorSampling{
+			EveryIterations: *sensorTraceEvery,
+			Rate:            *sensorTraceRate,
+		},
+		PerRun: perRun,
 	}
 }
 
 // enqueue the new mode changes from this run.
 // at each mode transition, we can inject a subset of our failure powerset.
+// each fault kind gets its own powerset, so a scenario never mixes fault kinds.
 func enqueueScenarios(modeChangeTimes []uint64, plans *[][]executor.FailurePlan, consideredScenarios map[uint64]bool) {
 	for _, modeTimestamp := range modeChangeTimes {
-		failures := allFailures(modeTimestamp)
-		candidates := failurePowerset(failures)
+		var candidates [][]executor.FailurePlan
+		for _, kind := range faultKinds {
+			candidates = append(candidates, failurePowerset(allFailures(modeTimestamp, kind))...)
+		}
+		var singles []executor.FailurePlan
+		for _, packetType := range hinj.PacketTypes() {
+			if (packetType.ID == hinj.Battery && !*exploreBattery) || (packetType.ID == hinj.RCInputs && !*exploreRC) {
+				continue
+			}
+			singles = append(singles, singleFailures(packetType, modeTimestamp)...)
+		}
+		for _, failure := range singles {
+			candidates = append(candidates, []executor.FailurePlan{failure})
+		}
+		if *exploreSpoofing {
+			candidates = append(candidates, spoofingScenarios(modeTimestamp)...)
+		}
 		// remove scenarios that we have:
 		//   i. already considered (hash the scenario and compare)
 		//  ii. are not feasible (e.g. redundant failures)
@@ -382,28 +512,34 @@ func scenarioFeasible(scenario []executor.FailurePlan) bool {
 				count++
 			}
 		}
-		if count != 3 {
+		if count != int(sensorInstances(failure.SensorFailure.SensorType)) {
 			return false
 		}
 	}
 	return true
 }
 
-// returns all failures at iteration
-func allFailures(iteration uint64) []executor.FailurePlan {
+// returns all failures of the given kind at iteration
+func allFailures(iteration uint64, kind hinj.FaultKind) []executor.FailurePlan {
 	var failures []executor.FailurePlan
-	sensorTypes := []hinj.Sensor{hinj.GPS, hinj.Accelerometer, hinj.Compass, hinj.Gyroscope, hinj.Barometer}
-	for _, sensorType := range sensorTypes {
-		// TODO - probably use a map to store # of instances
-		for instance := uint8(0); instance < uint8(3); instance++ {
+	for _, packetType := range hinj.PacketTypes() {
+		if !packetType.Explore {
+			continue
+		}
+		sensorType := packetType.ID
+		for instance := uint8(0); instance < packetType.Instances; instance++ {
 			failures = append(
 				failures,
 				executor.FailurePlan{
 					SensorFailure: hinj.SensorFailure{
 						SensorType: sensorType,
 						Instance:   instance,
+						Model:      faultModel(kind, sensorType, instance),
 					},
 					FailureTime: iteration,
+					Duration:    *faultDuration,
+					OnTime:      *faultOnTime,
+					OffTime:     *faultOffTime,
 				},
 			)
 		}
@@ -411,6 +547,75 @@ func allFailures(iteration uint64) []executor.FailurePlan {
 	return failures
 }
 
+// returns a failure at iteration for each fault listed in packetType.Faults.
+// each is explored on its own rather than as part of a powerset.
+func singleFailures(packetType *hinj.PacketType, iteration uint64) []executor.FailurePlan {
+	var failures []executor.FailurePlan
+	for _, model := range packetType.Faults {
+		failures = append(
+			failures,
+			executor.FailurePlan{
+				SensorFailure: hinj.SensorFailure{
+					SensorType: packetType.ID,
+					Model:      model,
+				},
+				FailureTime: iteration,
+				Duration:    *faultDuration,
+				OnTime:      *faultOnTime,
+				OffTime:     *faultOffTime,
+			},
+		)
+	}
+	return failures
+}
+
+// returns one scenario per attack in gpsAttacks, each spoofing every GPS receiver at iteration
+func spoofingScenarios(iteration uint64) [][]executor.FailurePlan {
+	var scenarios [][]executor.FailurePlan
+	for _, model := range gpsAttacks {
+		var scenario []executor.FailurePlan
+		for instance := uint8(0); instance < sensorInstances(hinj.GPS); instance++ {
+			scenario = append(
+				scenario,
+				executor.FailurePlan{
+					SensorFailure: hinj.SensorFailure{
+						SensorType: hinj.GPS,
+						Instance:   instance,
+						Model:      model,
+					},
+					FailureTime: iteration,
+					Duration:    *faultDuration,
+					OnTime:      *faultOnTime,
+					OffTime:     *faultOffTime,
+				},
+			)
+		}
+		scenarios = append(scenarios, scenario)
+	}
+	return scenarios
+}
+
+// returns the number of instances of sensorType we fail
+func sensorInstances(sensorType hinj.Sensor) uint8 {
+	if packetType, ok := hinj.LookupPacketType(sensorType); ok {
+		return packetType.Instances
+	}
+	return 0
+}
+
+// returns the fault model of the given kind used when exploring sensorType
+func faultModel(kind hinj.FaultKind, sensorType hinj.Sensor, instance uint8) hinj.FaultModel {
+	var magnitude float64
+	if packetType, ok := hinj.LookupPacketType(sensorType); ok {
+		magnitude = packetType.FaultMagnitudes[kind]
+	}
+	return hinj.FaultModel{
+		Kind:      kind,
+		Magnitude: magnitude,
+		Seed:      int64(sensorType)<<8 | int64(instance),
+	}
+}
+
 // returns the powerset of the given failure plan (e.g. all possible failures)
 func failurePowerset(failures []executor.FailurePlan) [][]executor.FailurePlan {
 	if len(failures) == 0 {
@@ -437,35 +642,19 @@ func copyAndAppend(failures []executor.FailurePlan, item executor.FailurePlan) [
 
 // called when a failure is encountered to record relevant statistics
 func updateStats(failurePlan []executor.FailurePlan) {
-	hasGPS, hasBaro, hasAccel, hasCompass, hasGyro := false, false, false, false, false
+	faulted := make(map[hinj.Sensor]bool)
+	hasSpoof := false
 	for _, plan := range failurePlan {
-		switch plan.SensorFailure.SensorType {
-		case hinj.GPS:
-			hasGPS = true
-		case hinj.Barometer:
-			hasBaro = true
-		case hinj.Accelerometer:
-			hasAccel = true
-		case hinj.Compass:
-			hasCompass = true
-		case hinj.Gyroscope:
-			hasGyro = true
+		if kind := plan.SensorFailure.Model.Kind; kind == hinj.FaultSpoof || kind == hinj.FaultMeaconing {
+			hasSpoof = true
 		}
+		faulted[plan.SensorFailure.SensorType] = true
 	}
-	if hasGPS {
-		statistics.unsafeFromGPS++
+	for sensorType := range faulted {
+		statistics.unsafeBySensor[sensorType]++
 	}
-	if hasBaro {
-		statistics.unsafeFromAccel++
-	}
-	if hasCompass {
-		statistics.unsafeFromCompass++
-	}
-	if hasAccel {
-		statistics.unsafeFromAccel++
-	}
-	if hasGyro {
-		statistics.unsafeFromGyro++
+	if hasSpoof {
+		statistics.unsafeFromSpoof++
 	}
 	statistics.totalUnsafe++
 }
@@ -473,11 +662,15 @@ func updateStats(failurePlan []executor.FailurePlan) {
 func displayStats() {
 	fmt.Println("Stats:")
 	fmt.Printf("    %d total unsafe scenarios\n", statistics.totalUnsafe)
-	fmt.Printf("    %d unsafe scenarios w/ a GPS fault\n", statistics.unsafeFromGPS)
-	fmt.Printf("    %d unsafe scenarios w/ a Baro fault\n", statistics.unsafeFromBaros)
-	fmt.Printf("    %d unsafe scenarios w/ a Accel fault\n", statistics.unsafeFromAccel)
-	fmt.Printf("    %d unsafe scenarios w/ a Compass fault\n", statistics.unsafeFromCompass)
-	fmt.Printf("    %d unsafe scenarios w/ a Gyro fault\n", statistics.unsafeFromGyro)
+	for _, packetType := range hinj.PacketTypes() {
+		if packetType.IsSensor {
+			fmt.Printf("    %d unsafe scenarios w/ a %s fault\n", statistics.unsafeBySensor[packetType.ID], packetType.Name)
+		}
+	}
+	fmt.Printf("    %d unsafe scenarios w/ a GPS spoofing attack\n", statistics.unsafeFromSpoof)
+	fmt.Printf("    %d vacuous runs (a failed sensor never sent a packet)\n", statistics.vacuousRuns)
+	fmt.Printf("    %d runs where the instances of a sensor disagreed\n", statistics.inconsistentRuns)
+	fmt.Printf("    %d runs where the workload exited early (not counted as unsafe)\n", statistics.crashedRuns)
 }
 
 func getHINJAddr() string {
@@ -507,6 +700,14 @@ func getRPCAddr() string {
 	return "unix://" + path
 }
 
+func getWorkersDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		panic(err)
+	}
+	return path.Join(home, ".avis", "workers")
+}
+
 func getOutputLocation() string {
 	wd, err := os.Getwd()
 	if err != nil {
@@ -515,15 +716,15 @@ func getOutputLocation() string {
 	return path.Join(wd, "bugs/")
 }
 
-func getAutoPilot(autopilotName string) platforms.System {
+func getAutoPilot(autopilotName string, instance platforms.Instance) (platforms.System, error) {
 	adjustedName := strings.ToLower(autopilotName)
 	var sys platforms.System
 	var err error
 	switch adjustedName {
 	case "ardupilot":
-		sys, err = platforms.NewArduPilotFromEnv()
+		sys, err = platforms.NewArduPilotInstanceFromEnv(instance)
 	case "px4":
-		sys, err = platforms.NewPX4FromEnv()
+		sys, err = platforms.NewPX4InstanceFromEnv(instance)
 	case "":
 		err = fmt.Errorf("autopilot name not supplied via -autopilot")
 	default:
@@ -531,15 +732,13 @@ func getAutoPilot(autopilotName string) platforms.System {
 	}
 
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "cannot create new autopilot: %s\n", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("cannot create new autopilot: %s", err)
 	}
 
-	return sys
+	return sys, nil
 }
 
-func parseWorkloadTemplate(autopilotName, workloadCmd string) (string, error) {
-	info := workloadInfo{AutopilotName: autopilotName}
+func parseWorkloadTemplate(info workloadInfo, workloadCmd string) (string, error) {
 	template := template.New("Workload")
 	template, err := template.Parse(workloadCmd)
 	if err != nil {
@@ -554,12 +753,12 @@ func parseWorkloadTemplate(autopilotName, workloadCmd string) (string, error) {
 	return builder.String(), nil
 }
 
-func getSensorOutputLocation(sensorName string) string {
+func getSensorOutputLocation(fileName string) string {
 	cwd, err := os.Getwd()
 	if err != nil {
 		panic(err)
 	}
-	return path.Join(cwd, fmt.Sprintf("data/%s.json", sensorName))
+	return path.Join(cwd, "data", fileName)
 }
 
 func saveModes(modeChangeTimes []uint64) error {
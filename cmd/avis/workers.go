@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/obicons/avis/executor"
+	"github.com/obicons/avis/hinj"
+	"github.com/obicons/avis/platforms"
+	"github.com/obicons/avis/sim"
+	"github.com/obicons/avis/util"
+)
+
+// Everything one executor needs to run scenarios alongside other workers.
+// Each worker has its own autopilot instance, simulator, HINJ server and RPC address.
+type worker struct {
+	id          int
+	instance    platforms.Instance
+	hinjServer  *hinj.HINJServer
+	simulator   sim.Sim
+	autopilot   platforms.System
+	rpcAddr     string
+	workloadCmd string
+	workloadEnv []string
+}
+
+// A scenario handed to a worker.
+type job struct {
+	runNumber   int
+	failurePlan []executor.FailurePlan
+}
+
+// The outcome of a job; RunResult is nil if the job was cut short or failed.
+type jobResult struct {
+	job
+	*executor.RunResult
+	err error
+}
+
+// Returns worker id of count.
+// A lone worker uses the addresses given on the command line and $HOME, as avis always has;
+// otherwise each worker gets a directory under -workers.dir for its sockets.
+func newWorker(id, count int) (*worker, error) {
+	w := worker{
+		id:       id,
+		rpcAddr:  *rpcAddr,
+		instance: platforms.Instance{ID: id},
+	}
+	hinjURL := *hinjAddr
+	if count > 1 {
+		w.instance.Dir = path.Join(*workersDir, fmt.Sprintf("worker-%d", id))
+		if err := w.instance.Prepare(); err != nil {
+			return nil, err
+		}
+
+		var err error
+		if hinjURL, err = util.InstanceURL(hinjURL, w.instance.Dir, id); err != nil {
+			return nil, fmt.Errorf("-hinj.addr: %s", err)
+		} else if w.rpcAddr, err = util.InstanceURL(w.rpcAddr, w.instance.Dir, id); err != nil {
+			return nil, fmt.Errorf("-rpc.addr: %s", err)
+		}
+		removeStaleSocket(hinjURL)
+		removeStaleSocket(w.rpcAddr)
+	}
+
+	var err error
+	if w.autopilot, err = getAutoPilot(*autopilot, w.instance); err != nil {
+		return nil, err
+	}
+	if w.hinjServer, err = hinj.NewHINJServer(hinjURL); err != nil {
+		return nil, fmt.Errorf("could not create a new HINJ server: %s", err)
+	}
+
+	config, _ := w.autopilot.GetGazeboConfig()
+	if w.simulator, err = sim.NewGazeboFromEnv(config); err != nil {
+		return nil, fmt.Errorf("could not get a gazebo instance: %s", err)
+	}
+
+	info := workloadInfo{
+		AutopilotName: *autopilot,
+		Instance:      id,
+		MAVLinkAddr:   w.autopilot.MAVLinkAddr(),
+		RPCAddr:       w.rpcAddr,
+	}
+	if w.workloadCmd, err = parseWorkloadTemplate(info, *workloadCmd); err != nil {
+		return nil, fmt.Errorf("could not parse workload command: %s", err)
+	}
+	// workloads hand AVIS_RPC_ADDR straight to gRPC, which cannot dial tcp URLs
+	rpcTarget, err := util.GRPCTarget(w.rpcAddr)
+	if err != nil {
+		return nil, fmt.Errorf("could not get the RPC server's gRPC target: %s", err)
+	}
+	w.workloadEnv = []string{
+		"AVIS_INSTANCE=" + strconv.Itoa(id),
+		"AVIS_MAVLINK_ADDR=" + info.MAVLinkAddr,
+		"AVIS_RPC_ADDR=" + rpcTarget,
+	}
+
+	return &w, nil
+}
+
+// Runs every job it receives, until jobs is closed.
+// A job in progress when ctx is done is cut short.
+func (w *worker) work(ctx context.Context, jobs <-chan job, results chan<- jobResult) {
+	for j := range jobs {
+		results <- w.run(ctx, j)
+	}
+}
+
+// Runs a single scenario.
+func (w *worker) run(ctx context.Context, j job) jobResult {
+	ex := newModelCheckingExecutor(w, j.failurePlan)
+	if *workers > 1 {
+		// runs finish at the same time, so the time alone is not unique
+		ex.Name = fmt.Sprintf("%d.%d", time.Now().Unix(), j.runNumber)
+	}
+	if *hinjRecordPath != "" {
+		ex.HINJRecordPath = fmt.Sprintf("%s.%d", *hinjRecordPath, j.runNumber)
+	}
+	// a run cut short because we are shutting down is discarded, so its error does not matter
+	result, err := ex.ExecuteContext(ctx)
+	if err != nil && ctx.Err() == nil {
+		return jobResult{job: j, err: fmt.Errorf("error executing on worker %d: %s", w.id, err)}
+	}
+	return jobResult{job: j, RunResult: result}
+}
+
+// Removes a unix socket left behind by a previous run, so the server can listen on it.
+func removeStaleSocket(rawURL string) {
+	if u, err := url.Parse(rawURL); err == nil && u.Scheme == "unix" {
+		os.Remove(u.Path)
+	}
+}
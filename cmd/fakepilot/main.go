@@ -0,0 +1,84 @@
+// fakepilot is a stand-in autopilot for testing HINJ.
+// It flies a fake vehicle, streams every sensor packet to a HINJ server,
+// and reports how many packets the server altered.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"time"
+
+	"github.com/obicons/avis/hinj"
+	"github.com/obicons/avis/hinj/client"
+)
+
+var (
+	hinjAddr = flag.String("hinj.addr", getHINJAddr(), "URL of HINJ server (unix:///path or tcp://host:port)")
+	duration = flag.Duration("duration", 10*time.Second, "Length of the simulated flight")
+	oneShot  = flag.Bool("oneshot", false, "Send each packet on its own connection instead of a stream")
+	realTime = flag.Bool("realtime", true, "Pace packets at the rate real sensors produce them")
+)
+
+func main() {
+	flag.Parse()
+
+	var hinjClient *client.Client
+	if !*oneShot {
+		var err error
+		if hinjClient, err = client.Dial(*hinjAddr); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(1)
+		}
+		defer hinjClient.Close()
+	}
+
+	vehicle := client.NewFakeVehicle()
+	sent := make(map[hinj.Sensor]int)
+	altered := make(map[hinj.Sensor]int)
+	ticker := time.NewTicker(time.Second / client.TickRate)
+	defer ticker.Stop()
+
+	ticks := int(duration.Seconds() * client.TickRate)
+	for tick := 0; tick < ticks; tick++ {
+		if *realTime {
+			<-ticker.C
+		}
+		for _, msg := range vehicle.Tick() {
+			var reply interface{}
+			var err error
+			if *oneShot {
+				reply, err = client.SendOneShot(*hinjAddr, msg)
+			} else {
+				reply, err = hinjClient.Send(msg)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %s\n", err)
+				os.Exit(1)
+			}
+
+			sensorType, _ := hinj.MessageType(msg)
+			sent[sensorType]++
+			if !reflect.DeepEqual(msg, reply) {
+				altered[sensorType]++
+			}
+		}
+	}
+
+	for _, packetType := range hinj.PacketTypes() {
+		if sensorType := packetType.ID; sent[sensorType] != 0 && packetType.IsSensor {
+			fmt.Printf("%s: %d packets sent, %d altered\n", sensorType, sent[sensorType], altered[sensorType])
+		}
+	}
+}
+
+// Returns the address avis listens on by default.
+func getHINJAddr() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		panic(err)
+	}
+	return "unix://" + path.Join(home, ".hardware_controller")
+}
@@ -3,32 +3,65 @@ package controller
 
 import (
 	context "context"
+	"errors"
 	"net"
 	"net/url"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/obicons/avis/hinj"
 	"github.com/obicons/avis/sim"
+	"github.com/obicons/avis/util"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// how long Shutdown waits for requests in flight before cancelling them
+const shutdownGracePeriod = time.Second
+
+// returned by requests that arrive as the server shuts down
+var ErrStopped = errors.New("simulator controller stopped")
+
+// Applies the HINJ rules clients send with SetRules; *hinj.HINJServer is one.
+type RuleSetter interface {
+	SetRules(rules *hinj.RuleSet)
+}
+
 type SimulatorController struct {
 	url        *url.URL
 	grpcServer *grpc.Server
 	simulator  sim.Sim
 	listener   net.Listener
-	shutdownCh chan int
-	modeCh     chan int
+	// closed by the first Terminate request, after its verdict is stored
+	shutdownCh    chan int
+	terminateOnce sync.Once
+	didPass       bool
+	explanation   string
+	modeCh        chan int
+	// closed by Shutdown, so that no request waits on a reader that is gone
+	stoppedCh    chan struct{}
+	shutdownOnce sync.Once
+	// where SetRules requests apply their rules, if anywhere
+	ruleSetter RuleSetter
 }
 
+// Returns a SimulatorController that will listen on addrStr.
+// addrStr is a unix (unix:///path/to.sock) or tcp (tcp://host:port) URL.
 func New(addrStr string, simulator sim.Sim) (*SimulatorController, error) {
 	var err error
 	server := SimulatorController{}
 	server.url, err = url.Parse(addrStr)
 	if err != nil {
 		return nil, err
+	} else if _, _, err = util.URLNetworkAddress(server.url); err != nil {
+		return nil, err
 	}
 	server.simulator = simulator
 	server.shutdownCh = make(chan int)
 	server.modeCh = make(chan int)
+	server.stoppedCh = make(chan struct{})
 	return &server, nil
 
 }
@@ -36,33 +69,79 @@ func New(addrStr string, simulator sim.Sim) (*SimulatorController, error) {
 // Starts the SimulatorController.
 // It is an error to call this method if server has already been started.
 func (server *SimulatorController) Start() error {
-	var err error
-	// TODO -- clean this up
-	server.listener, err = net.Listen(server.url.Scheme, server.url.Path)
+	if err := server.Listen(); err != nil {
+		return err
+	}
+	return server.Serve()
+}
+
+// Listens on the server's address. Clients may connect once it returns,
+// although their requests wait until Serve is called.
+func (server *SimulatorController) Listen() error {
+	network, address, err := util.URLNetworkAddress(server.url)
+	if err != nil {
+		return err
+	}
+	server.listener, err = net.Listen(network, address)
 	if err != nil {
 		return err
 	}
 	server.grpcServer = grpc.NewServer()
 	service := NewSimulatorControllerService(server)
 	RegisterSimulatorControllerService(server.grpcServer, service)
+	return nil
+}
+
+// Serves requests until the server is shut down.
+// It is an error to call this method before Listen.
+func (server *SimulatorController) Serve() error {
 	return server.grpcServer.Serve(server.listener)
 }
 
+// Sets where SetRules requests apply their rules; without one, they fail.
+// It must be called before Serve.
+func (server *SimulatorController) SetRuleSetter(setter RuleSetter) {
+	server.ruleSetter = setter
+}
+
 // Returns a channel to receive mode changes from
 func (server *SimulatorController) Mode() <-chan int {
 	return server.modeCh
 }
 
-// Returns a channel to receieve shutdown requests from.
+// Returns a channel that is closed once a client requests termination.
 func (server *SimulatorController) Done() <-chan int {
 	return server.shutdownCh
 }
 
-// Stops the SimulatorController.
-// It is an error to call this method if server has not been started.
+// Returns what the first Terminate request reported.
+// It is only meaningful once Done is closed.
+func (server *SimulatorController) Verdict() (didPass bool, explanation string) {
+	return server.didPass, server.explanation
+}
+
+// Stops the SimulatorController, and fails any request still waiting to be read.
+// It is safe to call this method more than once, or if Listen failed.
 func (server *SimulatorController) Shutdown() {
-	server.grpcServer.Stop()
-	server.listener.Close()
+	server.shutdownOnce.Do(func() {
+		close(server.stoppedCh)
+		if server.grpcServer != nil {
+			// lets requests in flight (e.g. a Terminate) answer first
+			stopped := make(chan struct{})
+			go func() {
+				server.grpcServer.GracefulStop()
+				close(stopped)
+			}()
+			select {
+			case <-stopped:
+			case <-time.After(shutdownGracePeriod):
+				server.grpcServer.Stop()
+			}
+		}
+		if server.listener != nil {
+			server.listener.Close()
+		}
+	})
 }
 
 // Implements RPC
@@ -84,13 +163,42 @@ func (s *SimulatorController) Time(ctx context.Context, req *TimeRequest) (*Time
 }
 
 // Implements RPC
+// Terminating more than once has no further effect.
 func (s *SimulatorController) Terminate(ctx context.Context, req *TerminateRequest) (*TerminateResponse, error) {
-	s.shutdownCh <- 1
+	s.terminateOnce.Do(func() {
+		s.didPass, s.explanation = req.DidPass, req.Explanation
+		close(s.shutdownCh)
+	})
 	return &TerminateResponse{}, nil
 }
 
 // Implements RPC
+// Waits until the mode is read, the request is cancelled, or the server is shut down.
 func (s *SimulatorController) ModeChange(ctx context.Context, req *ModeChangeRequest) (*ModeChangeResponse, error) {
-	s.modeCh <- int(req.NextMode)
-	return &ModeChangeResponse{}, nil
+	select {
+	case s.modeCh <- int(req.NextMode):
+		return &ModeChangeResponse{}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-s.stoppedCh:
+		return nil, ErrStopped
+	}
+}
+
+// Implements RPC
+// Replaces the rules in effect with the rule set in req (see hinj/rules.go); an empty set removes them.
+func (s *SimulatorController) SetRules(ctx context.Context, req *SetRulesRequest) (*SetRulesResponse, error) {
+	if s.ruleSetter == nil {
+		return nil, status.Error(codes.FailedPrecondition, "no HINJ server to apply rules to")
+	} else if req.Rules == "" {
+		s.ruleSetter.SetRules(nil)
+		return &SetRulesResponse{}, nil
+	}
+
+	rules, err := hinj.LoadRules(strings.NewReader(req.Rules))
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	s.ruleSetter.SetRules(rules)
+	return &SetRulesResponse{}, nil
 }
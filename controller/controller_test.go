@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/obicons/avis/hinj"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const testRules = `{"Rules": [{
+  "Name": "low baro",
+  "Sensor": "Barometer",
+  "Instances": [1],
+  "Actions": [{"Type": "offset", "Field": "Pressure", "Value": -500}],
+  "Window": {"Start": 1000, "End": 5000}
+}]}`
+
+// records the rules it is given
+type ruleRecorder struct {
+	calls int
+	rules *hinj.RuleSet
+}
+
+func (r *ruleRecorder) SetRules(rules *hinj.RuleSet) {
+	r.calls++
+	r.rules = rules
+}
+
+// Serves a SimulatorController whose rules go to setter, and returns a client of it.
+func startTestController(t *testing.T, setter RuleSetter) SimulatorControllerClient {
+	dir, err := ioutil.TempDir("", "avis-controller")
+	if err != nil {
+		t.Fatalf("TempDir() returned an unexpected error: %s", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	socketPath := path.Join(dir, "rpc.sock")
+	server, err := New("unix://"+socketPath, nil)
+	if err != nil {
+		t.Fatalf("New() returned an unexpected error: %s", err)
+	} else if setter != nil {
+		server.SetRuleSetter(setter)
+	}
+	if err = server.Listen(); err != nil {
+		t.Fatalf("Listen() returned an unexpected error: %s", err)
+	}
+	go server.Serve()
+	t.Cleanup(server.Shutdown)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// this version of gRPC cannot resolve unix targets itself
+	conn, err := grpc.DialContext(
+		ctx,
+		"passthrough:///"+socketPath,
+		grpc.WithInsecure(),
+		grpc.WithBlock(),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", addr)
+		}),
+	)
+	if err != nil {
+		t.Fatalf("DialContext() returned an unexpected error: %s", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return NewSimulatorControllerClient(conn)
+}
+
+func TestUnitSetRules(t *testing.T) {
+	recorder := &ruleRecorder{}
+	client := startTestController(t, recorder)
+	ctx := context.Background()
+
+	if _, err := client.SetRules(ctx, &SetRulesRequest{Rules: testRules}); err != nil {
+		t.Fatalf("SetRules() returned an unexpected error: %s", err)
+	} else if recorder.rules == nil || len(recorder.rules.Rules) != 1 || recorder.rules.Rules[0].Name != "low baro" {
+		t.Fatalf("expected the rule set to be applied, found %+v", recorder.rules)
+	}
+
+	_, err := client.SetRules(ctx, &SetRulesRequest{Rules: `{"Rules": [{"Sensor": "Barometer", "Bogus": 1}]}`})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected an invalid rule set to be rejected, found %v", err)
+	} else if recorder.calls != 1 {
+		t.Fatalf("expected an invalid rule set to leave the rules alone")
+	}
+
+	if _, err = client.SetRules(ctx, &SetRulesRequest{}); err != nil {
+		t.Fatalf("SetRules() returned an unexpected error: %s", err)
+	} else if recorder.rules != nil {
+		t.Fatalf("expected an empty rule set to remove the rules")
+	}
+}
+
+func TestUnitSetRulesWithoutHINJ(t *testing.T) {
+	client := startTestController(t, nil)
+	_, err := client.SetRules(context.Background(), &SetRulesRequest{Rules: testRules})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected SetRules() to fail without a HINJ server, found %v", err)
+	}
+}
@@ -22,6 +22,7 @@ type SimulatorControllerClient interface {
 	Time(ctx context.Context, in *TimeRequest, opts ...grpc.CallOption) (*TimeResponse, error)
 	Terminate(ctx context.Context, in *TerminateRequest, opts ...grpc.CallOption) (*TerminateResponse, error)
 	ModeChange(ctx context.Context, in *ModeChangeRequest, opts ...grpc.CallOption) (*ModeChangeResponse, error)
+	SetRules(ctx context.Context, in *SetRulesRequest, opts ...grpc.CallOption) (*SetRulesResponse, error)
 }
 
 type simulatorControllerClient struct {
@@ -97,6 +98,19 @@ func (c *simulatorControllerClient) ModeChange(ctx context.Context, in *ModeChan
 	return out, nil
 }
 
+var simulatorControllerSetRulesStreamDesc = &grpc.StreamDesc{
+	StreamName: "SetRules",
+}
+
+func (c *simulatorControllerClient) SetRules(ctx context.Context, in *SetRulesRequest, opts ...grpc.CallOption) (*SetRulesResponse, error) {
+	out := new(SetRulesResponse)
+	err := c.cc.Invoke(ctx, "/controller.SimulatorController/SetRules", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // SimulatorControllerService is the service API for SimulatorController service.
 // Fields should be assigned to their respective handler implementations only before
 // RegisterSimulatorControllerService is called.  Any unassigned fields will result in the
@@ -107,6 +121,7 @@ type SimulatorControllerService struct {
 	Time       func(context.Context, *TimeRequest) (*TimeResponse, error)
 	Terminate  func(context.Context, *TerminateRequest) (*TerminateResponse, error)
 	ModeChange func(context.Context, *ModeChangeRequest) (*ModeChangeResponse, error)
+	SetRules   func(context.Context, *SetRulesRequest) (*SetRulesResponse, error)
 }
 
 func (s *SimulatorControllerService) step(_ interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
@@ -194,6 +209,23 @@ func (s *SimulatorControllerService) modeChange(_ interface{}, ctx context.Conte
 	}
 	return interceptor(ctx, in, info, handler)
 }
+func (s *SimulatorControllerService) setRules(_ interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetRulesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return s.SetRules(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     s,
+		FullMethod: "/controller.SimulatorController/SetRules",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return s.SetRules(ctx, req.(*SetRulesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
 
 // RegisterSimulatorControllerService registers a service implementation with a gRPC server.
 func RegisterSimulatorControllerService(s grpc.ServiceRegistrar, srv *SimulatorControllerService) {
@@ -223,6 +255,11 @@ func RegisterSimulatorControllerService(s grpc.ServiceRegistrar, srv *SimulatorC
 			return nil, status.Errorf(codes.Unimplemented, "method ModeChange not implemented")
 		}
 	}
+	if srvCopy.SetRules == nil {
+		srvCopy.SetRules = func(context.Context, *SetRulesRequest) (*SetRulesResponse, error) {
+			return nil, status.Errorf(codes.Unimplemented, "method SetRules not implemented")
+		}
+	}
 	sd := grpc.ServiceDesc{
 		ServiceName: "controller.SimulatorController",
 		Methods: []grpc.MethodDesc{
@@ -246,6 +283,10 @@ func RegisterSimulatorControllerService(s grpc.ServiceRegistrar, srv *SimulatorC
 				MethodName: "ModeChange",
 				Handler:    srvCopy.modeChange,
 			},
+			{
+				MethodName: "SetRules",
+				Handler:    srvCopy.setRules,
+			},
 		},
 		Streams:  []grpc.StreamDesc{},
 		Metadata: "simulator_controller.proto",
@@ -287,6 +328,11 @@ func NewSimulatorControllerService(s interface{}) *SimulatorControllerService {
 	}); ok {
 		ns.ModeChange = h.ModeChange
 	}
+	if h, ok := s.(interface {
+		SetRules(context.Context, *SetRulesRequest) (*SetRulesResponse, error)
+	}); ok {
+		ns.SetRules = h.SetRules
+	}
 	return ns
 }
 
@@ -300,4 +346,5 @@ type UnstableSimulatorControllerService interface {
 	Time(context.Context, *TimeRequest) (*TimeResponse, error)
 	Terminate(context.Context, *TerminateRequest) (*TerminateResponse, error)
 	ModeChange(context.Context, *ModeChangeRequest) (*ModeChangeResponse, error)
+	SetRules(context.Context, *SetRulesRequest) (*SetRulesResponse, error)
 }
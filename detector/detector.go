@@ -1,6 +1,7 @@
 package detector
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/obicons/avis/entities"
@@ -14,6 +15,8 @@ const (
 	ProgramFault
 	Timeout
 	Deviation
+	// the instances of a redundant sensor disagreed for too long
+	Inconsistency
 )
 
 type Anomaly struct {
@@ -22,6 +25,28 @@ type Anomaly struct {
 
 	// kind of anomaly
 	Kind AnomalyKind
+
+	// name of the detector that reported it
+	Detector string
+
+	// the simulator's iteration at the time; filled in by the executor if zero
+	Iteration uint64
+
+	// the vehicle's position at the time, if known
+	Position entities.Position
+
+	// how the workload exited, for a ProgramFault
+	Exit *ProgramExit
+}
+
+// Describes a workload that exited before ending its run.
+type ProgramExit struct {
+	// the exit code, or -1 if a signal killed the workload
+	ExitCode int
+	// the signal that killed the workload, if any
+	Signal string
+	// the last lines the workload wrote to stdout and stderr
+	Output []string
 }
 
 type Detector interface {
@@ -35,6 +60,17 @@ type Detector interface {
 	SetAnomalyChan(chan<- Anomaly)
 }
 
+// Sends anomaly on ch, unless ch is full.
+// Detectors report through Report, so that a run that has already ended never blocks them.
+func Report(ch chan<- Anomaly, anomaly Anomaly) bool {
+	select {
+	case ch <- anomaly:
+		return true
+	default:
+		return false
+	}
+}
+
 func (k AnomalyKind) String() string {
 	switch k {
 	case AnomalyUnkown:
@@ -47,10 +83,18 @@ func (k AnomalyKind) String() string {
 		return "Timeout"
 	case Deviation:
 		return "Deviation"
+	case Inconsistency:
+		return "Inconsistency"
 	}
 	return "Unknown anomaly"
 }
 
 func (a Anomaly) String() string {
-	return a.Kind.String() + "@ " + a.Time.String()
+	description := a.Kind.String() + "@ " + a.Time.String()
+	if a.Exit != nil && a.Exit.Signal != "" {
+		description += fmt.Sprintf(" (killed by %s)", a.Exit.Signal)
+	} else if a.Exit != nil {
+		description += fmt.Sprintf(" (exit code %d)", a.Exit.ExitCode)
+	}
+	return description
 }
@@ -61,10 +61,12 @@ func (d *DeviantDetector) Start() {
 						count++
 						if count > 50 {
 							d.reported = true
-							d.anomalyChan <- Anomaly{
-								Time: pos.Time,
-								Kind: Deviation,
-							}
+							Report(d.anomalyChan, Anomaly{
+								Time:     pos.Time,
+								Kind:     Deviation,
+								Detector: "deviant",
+								Position: pos.Position,
+							})
 						}
 					} else {
 						count = 0
@@ -13,6 +13,7 @@ type FreeFallDetector struct {
 	positionChan   chan entities.TimestampedPosition
 	lastUpdateTime time.Time
 	lastPosition   entities.Position
+	reported       bool
 }
 
 const FreeFallThreshold = 9.8
@@ -62,11 +63,14 @@ func (d *FreeFallDetector) work() {
 			if accelY > FreeFallThreshold {
 				count++
 			}
-			if count > 10 {
-				d.anomalyChan <- Anomaly{
-					Time: pos.Time,
-					Kind: FreeFall,
-				}
+			if count > 10 && !d.reported {
+				d.reported = true
+				Report(d.anomalyChan, Anomaly{
+					Time:     pos.Time,
+					Kind:     FreeFall,
+					Detector: "freefall",
+					Position: pos.Position,
+				})
 			}
 		}
 	}
@@ -29,15 +29,21 @@ func (t *timeoutDetector) Start() {
 	go func() {
 		keepGoing := true
 		timer := time.NewTimer(t.timeout)
+		var last entities.TimestampedPosition
 		for keepGoing {
 			select {
 			case <-t.shutdownChan:
 				timer.Stop()
 				keepGoing = false
 			case <-timer.C:
-				t.anomalyChan <- Anomaly{Kind: Timeout}
-			case <-t.positionChan:
-				// do nothing
+				Report(t.anomalyChan, Anomaly{
+					Time:     last.Time,
+					Kind:     Timeout,
+					Detector: "timeout",
+					Position: last.Position,
+				})
+			case last = <-t.positionChan:
+				// only kept to say where the vehicle was
 			}
 		}
 	}()
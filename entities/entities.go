@@ -14,10 +14,20 @@ type TimestampedPosition struct {
 }
 
 type SensorTraceParameters struct {
-	TraceSensors         bool
-	AccelTraceOutput     string
-	GPSTraceOutput       string
-	GyroTraceOutput      string
-	CompassTraceOutput   string
-	BarometerTraceOutput string
+	TraceSensors bool
+	// where each sensor type's packets are traced, as JSON Lines, keyed by the name of its
+	// packet type (e.g. "GPS"); a type with no output is not traced
+	Outputs  map[string]string
+	Sampling SensorSampling
+	// if set, each run's traces go in a directory named after the run next to its outputs
+	// (e.g. data/<run>/gps.jsonl), so that runs, even on parallel workers, keep their own
+	PerRun bool
+}
+
+// Which packets a sensor trace keeps. The zero value keeps every packet of every instance.
+type SensorSampling struct {
+	// if non-zero, only packets sent during every Nth iteration are kept
+	EveryIterations uint64
+	// if non-zero, at most this many packets per second are kept for each instance
+	Rate float64
 }
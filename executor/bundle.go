@@ -0,0 +1,281 @@
+package executor
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/obicons/avis/detector"
+	"github.com/obicons/avis/entities"
+	"github.com/obicons/avis/platforms"
+)
+
+// A bug bundle is a directory in the output location holding everything known about a run
+// with an anomaly, so that it can be triaged on its own. Its manifest describes the rest.
+const BundleManifestName = "manifest.json"
+
+// The failure plan in a bundle, which -replay.path accepts.
+const BundleFailurePlanName = "failure_plan.json"
+
+// Describes a bug bundle.
+type BundleManifest struct {
+	Name    string
+	Created time.Time
+	// how avis was run
+	CommandLine []string
+	// only the variables avis and its components read (see bundleEnvironmentPrefixes),
+	// so that credentials in the environment do not end up in the bundle
+	Environment      []string
+	WorkingDirectory string
+	WorkloadCmd      string
+	WorkloadEnv      []string
+	FailurePlan      []FailurePlan
+	Anomalies        []detector.Anomaly
+	// the files in the bundle, relative to it
+	Files []BundleFile
+	// what could not be collected, and why
+	Missing []string
+}
+
+// The environment variables a bundle's manifest keeps, by prefix.
+var bundleEnvironmentPrefixes = []string{"AVIS_", "RMCK_", "GAZEBO_", "ARDUPILOT_", "PX4_", "PATH=", "HOME="}
+
+// Returns the variables of environ that a bundle's manifest keeps.
+func bundleEnvironment(environ []string) []string {
+	var kept []string
+	for _, variable := range environ {
+		for _, prefix := range bundleEnvironmentPrefixes {
+			if strings.HasPrefix(variable, prefix) {
+				kept = append(kept, variable)
+				break
+			}
+		}
+	}
+	return kept
+}
+
+// A file in a bug bundle.
+type BundleFile struct {
+	Path        string
+	Description string
+}
+
+// Where the vehicle was after a step.
+type tracedPosition struct {
+	Iteration uint64
+	Time      time.Time
+	Position  entities.Position
+}
+
+// Collects a bug bundle's files.
+type bundleWriter struct {
+	dir      string
+	manifest BundleManifest
+}
+
+// Writes the bug bundle of result, a run that began at start, to a new directory in the
+// output location, and returns the directory.
+// The log written from logOffset on in logPath is the run's share of the log.
+func (e *Executor) saveBundle(result *RunResult, start time.Time, logPath string, logOffset int64) (string, error) {
+	dir, err := createUniqueDir(path.Join(e.OutputLocation, result.Name))
+	if err != nil {
+		return "", err
+	}
+
+	workingDirectory, _ := os.Getwd()
+	w := bundleWriter{
+		dir: dir,
+		manifest: BundleManifest{
+			Name:             path.Base(dir),
+			Created:          time.Now(),
+			CommandLine:      os.Args,
+			Environment:      bundleEnvironment(os.Environ()),
+			WorkingDirectory: workingDirectory,
+			WorkloadCmd:      e.WorkloadCmd,
+			WorkloadEnv:      e.WorkloadEnv,
+			FailurePlan:      result.FailurePlan,
+			Anomalies:        result.Anomalies,
+		},
+	}
+
+	w.writeJSON(BundleFailurePlanName, "the failure plan; pass it to -replay.path", result.FailurePlan)
+	w.writeJSON("result.json", "the run's result, with its mode changes and HINJ statistics", result)
+
+	e.positionLock.Lock()
+	positions := e.positions
+	e.positionLock.Unlock()
+	w.writeJSONLines("positions.jsonl", "where the vehicle was after each step", len(positions), func(i int) interface{} {
+		return positions[i]
+	})
+
+	if traceOutputs := e.traceOutputs(result.Name); !e.TraceParameters.TraceSensors {
+		w.missing("sensor traces: sensor tracing (-sensor.trace) was off for the run")
+	} else if len(traceOutputs) == 0 {
+		w.missing("sensor traces: no sensor type had a trace output")
+	} else {
+		for sensorType, tracePath := range traceOutputs {
+			w.copyFile(tracePath, path.Join("sensors", path.Base(tracePath)), fmt.Sprintf("the %s trace", sensorType))
+		}
+	}
+	if e.HINJRecordPath != "" {
+		w.copyFile(e.HINJRecordPath, "hinj.trace", "every packet HINJ sent during the run; pass it to -hinj.replay")
+	} else {
+		w.missing("hinj.trace: HINJ recording (-hinj.record) was off for the run")
+	}
+
+	if logPath == "" {
+		w.missing("avis.log: avis logged to stdout (RMCK_DEBUG is set)")
+	} else if e.LogPrefix != "" {
+		w.copyLinesFrom(logPath, logOffset, e.LogPrefix, "avis.log", "what the workload, the autopilot and gazebo logged during the run")
+	} else {
+		w.copyFileFrom(logPath, logOffset, "avis.log", "what avis, the workload, the autopilot and gazebo logged during the run")
+	}
+
+	if flightLogger, ok := e.Autopilot.(platforms.FlightLogger); ok {
+		if flightLogs, err := flightLogger.FlightLogs(start); err != nil {
+			w.missing(fmt.Sprintf("flight logs: %s", err))
+		} else {
+			for _, flightLog := range flightLogs {
+				w.copyFile(flightLog, path.Join("flight_logs", path.Base(flightLog)), "the autopilot's flight log")
+			}
+		}
+	} else {
+		w.missing("flight logs: the autopilot does not keep any")
+	}
+
+	if err := w.writeManifest(); err != nil {
+		return dir, err
+	}
+	return dir, nil
+}
+
+// Creates a directory at dirPath, or if one exists, at dirPath-1, dirPath-2 and so on.
+func createUniqueDir(dirPath string) (string, error) {
+	candidate := dirPath
+	for i := 1; ; i++ {
+		err := os.Mkdir(candidate, 0777)
+		if err == nil {
+			return candidate, nil
+		} else if !os.IsExist(err) {
+			return "", err
+		}
+		candidate = fmt.Sprintf("%s-%d", dirPath, i)
+	}
+}
+
+// Notes in the manifest that something could not be collected.
+func (w *bundleWriter) missing(reason string) {
+	w.manifest.Missing = append(w.manifest.Missing, reason)
+}
+
+// Creates name in the bundle, and adds it to the manifest if write succeeds.
+func (w *bundleWriter) create(name, description string, write func(io.Writer) error) {
+	filePath := path.Join(w.dir, name)
+	if err := os.MkdirAll(path.Dir(filePath), 0777); err != nil {
+		w.missing(fmt.Sprintf("%s: %s", name, err))
+		return
+	}
+	file, err := os.Create(filePath)
+	if err != nil {
+		w.missing(fmt.Sprintf("%s: %s", name, err))
+		return
+	}
+	defer file.Close()
+
+	if err = write(file); err != nil {
+		w.missing(fmt.Sprintf("%s: %s", name, err))
+		return
+	}
+	w.manifest.Files = append(w.manifest.Files, BundleFile{Path: name, Description: description})
+}
+
+func (w *bundleWriter) writeJSON(name, description string, value interface{}) {
+	w.create(name, description, func(out io.Writer) error {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	})
+}
+
+func (w *bundleWriter) writeJSONLines(name, description string, count int, value func(i int) interface{}) {
+	w.create(name, description, func(out io.Writer) error {
+		encoder := json.NewEncoder(out)
+		for i := 0; i < count; i++ {
+			if err := encoder.Encode(value(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (w *bundleWriter) copyFile(source, name, description string) {
+	w.copyFileFrom(source, 0, name, description)
+}
+
+// Copies source into the bundle, from offset on.
+func (w *bundleWriter) copyFileFrom(source string, offset int64, name, description string) {
+	in, err := os.Open(source)
+	if err != nil {
+		w.missing(fmt.Sprintf("%s: %s", name, err))
+		return
+	}
+	defer in.Close()
+
+	if _, err = in.Seek(offset, io.SeekStart); err != nil {
+		w.missing(fmt.Sprintf("%s: %s", name, err))
+		return
+	}
+	w.create(name, description, func(out io.Writer) error {
+		_, err := io.Copy(out, in)
+		return err
+	})
+}
+
+// Copies the lines of source that begin with prefix into the bundle, from offset on.
+func (w *bundleWriter) copyLinesFrom(source string, offset int64, prefix, name, description string) {
+	in, err := os.Open(source)
+	if err != nil {
+		w.missing(fmt.Sprintf("%s: %s", name, err))
+		return
+	}
+	defer in.Close()
+
+	if _, err = in.Seek(offset, io.SeekStart); err != nil {
+		w.missing(fmt.Sprintf("%s: %s", name, err))
+		return
+	}
+	w.create(name, description, func(out io.Writer) error {
+		reader := bufio.NewReader(in)
+		for {
+			line, err := reader.ReadString('\n')
+			if strings.HasPrefix(line, prefix) {
+				if _, writeErr := io.WriteString(out, line); writeErr != nil {
+					return writeErr
+				}
+			}
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+		}
+	})
+}
+
+func (w *bundleWriter) writeManifest() error {
+	file, err := os.Create(path.Join(w.dir, BundleManifestName))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(w.manifest)
+}
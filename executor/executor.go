@@ -5,11 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"math/rand"
 	"os"
-	"os/exec"
 	"path"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/obicons/avis/controller"
@@ -25,6 +24,30 @@ type FailurePlan struct {
 	SensorFailure hinj.SensorFailure
 	// measured in iterations
 	FailureTime uint64
+	// number of iterations the failure lasts; zero means it never recovers
+	Duration uint64
+	// if both are non-zero, the failure alternates between OnTime iterations
+	// failed and OffTime iterations recovered, starting at FailureTime
+	OnTime  uint64
+	OffTime uint64
+}
+
+// Returns whether the plan's failure is in effect at iteration.
+func (p FailurePlan) ActiveAt(iteration uint64) bool {
+	if iteration < p.FailureTime {
+		return false
+	}
+
+	elapsed := iteration - p.FailureTime
+	if p.Duration != 0 && elapsed >= p.Duration {
+		return false
+	}
+
+	if p.OnTime != 0 && p.OffTime != 0 {
+		return elapsed%(p.OnTime+p.OffTime) < p.OnTime
+	}
+
+	return true
 }
 
 type Executor struct {
@@ -37,240 +60,488 @@ type Executor struct {
 	Detectors          []detector.Detector
 	ModeChangeHandler  func(totalIterations uint64, modeNumber int)
 	MissionFailurePlan []FailurePlan
-	OutputLocation     string
-	MissionSuccessful  bool
-	TraceParameters    entities.SensorTraceParameters
-	REPL               bool
-	rpcServer          *controller.SimulatorController
-	accelPackets       map[uint64]hinj.AccelerometerPacket
-	gyroPackets        map[uint64]hinj.GyroscopePacket
-	gpsPackets         map[uint64]hinj.GPSPacket
-	baroPackets        map[uint64]hinj.BarometerPacket
-	compassPackets     map[uint64]hinj.CompassPacket
-	rand               *rand.Rand
+	// where the run's result and bug bundle are saved; nothing is saved if empty
+	OutputLocation  string
+	TraceParameters entities.SensorTraceParameters
+	REPL            bool
+	// how long the simulator and autopilot each have to become ready; a minute if zero
+	StartupTimeout time.Duration
+	// extra environment variables for the workload (e.g. where its vehicle listens)
+	WorkloadEnv []string
+	// names the run's files in OutputLocation; the Unix time in nanoseconds if empty
+	Name string
+	// what the log lines of the run's components begin with (see platforms.Instance.LogPrefix);
+	// if set, the bug bundle keeps only these lines, as other runs share the log
+	LogPrefix string
+	// if set, every packet the HINJ server sends is recorded to this file
+	HINJRecordPath string
+	// if set, the HINJ trace in this file is replayed in place of live sensors
+	HINJReplayPath string
+	// if set, the HINJ rules in this file are applied to every packet
+	HINJRulesPath string
+	// if set, HINJ compares the instances of each redundant sensor (see hinj/consistency.go)
+	MonitorConsistency bool
+	// if set, instances that disagree for too long end the run as an anomaly
+	ConsistencyAnomalies bool
+	rpcServer            *controller.SimulatorController
+	// the mode changes reported so far; the mode reporter adds to them as the run ends
+	modeLock    sync.Mutex
+	modeChanges []ModeChange
+	// where the vehicle was at each step, for the bug bundle
+	positionLock sync.Mutex
+	positions    []tracedPosition
+}
+
+// Runs the workload once. See ExecuteContext.
+func (e *Executor) Execute() (*RunResult, error) {
+	return e.ExecuteContext(context.Background())
+}
+
+// Runs the workload once, until it terminates, a detector reports an anomaly, or ctx is done.
+// The run's components stop in a fixed order once it ends: the workload, the detectors,
+// the mode reporter, the RPC server, the autopilot, the simulator and finally HINJ.
+// If OutputLocation is set, the result is saved there, along with a bug bundle
+// for a run with an anomaly (see bundle.go).
+// Returns ctx.Err() if ctx ended the run.
+func (e *Executor) ExecuteContext(ctx context.Context) (*RunResult, error) {
+	start := time.Now()
+	logPath, logOffset := util.LogFilePath(), int64(0)
+	if info, err := os.Stat(logPath); err == nil {
+		logOffset = info.Size()
+	}
+
+	result, err := e.run(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.OutputLocation == "" {
+		return result, nil
+	}
+
+	// the autopilot has stopped, so its flight logs are complete
+	if len(result.Anomalies) != 0 {
+		bundle, err := e.saveBundle(result, start, logPath, logOffset)
+		if err != nil {
+			log.Printf("unable to save the bug bundle: %s\n", err)
+		}
+		result.Bundle = bundle
+	}
+	e.saveResult(result)
+	return result, nil
 }
 
-func (e *Executor) Execute() error {
-	e.clearSensors()
-	e.rand = rand.New(rand.NewSource(42))
+// Does the work of ExecuteContext, up to stopping the run's components.
+func (e *Executor) run(ctx context.Context) (*RunResult, error) {
+	result := &RunResult{Name: e.runName(), FailurePlan: e.MissionFailurePlan}
+	wallStart := time.Now()
+	e.positionLock.Lock()
+	e.positions = nil
+	e.positionLock.Unlock()
 
 	var err error
+	e.HINJServer.SetIterationSource(e.Simulator.Iterations)
 	if err := e.HINJServer.Start(); err != nil {
-		return err
+		return nil, err
 	}
 	defer e.HINJServer.Shutdown()
 
+	if e.HINJRecordPath != "" {
+		file, err := os.Create(e.HINJRecordPath)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		if err = e.HINJServer.StartRecording(file); err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err := e.HINJServer.StopRecording(); err != nil {
+				log.Printf("unable to save HINJ trace: %s\n", err)
+			}
+		}()
+	}
+
+	if e.TraceParameters.TraceSensors {
+		tracer, err := newSensorTracer(e.traceOutputs(result.Name), e.TraceParameters.Sampling)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err := tracer.Close(); err != nil {
+				log.Printf("unable to save sensor traces: %s\n", err)
+			}
+		}()
+
+		e.HINJServer.ObservePackets(tracer.observe)
+		defer e.HINJServer.StopObservingPackets()
+	}
+
+	if e.HINJReplayPath != "" {
+		file, err := os.Open(e.HINJReplayPath)
+		if err != nil {
+			return nil, err
+		}
+		err = e.HINJServer.StartReplay(file)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		defer e.HINJServer.StopReplay()
+	}
+
+	if e.HINJRulesPath != "" {
+		file, err := os.Open(e.HINJRulesPath)
+		if err != nil {
+			return nil, err
+		}
+		rules, err := hinj.LoadRules(file)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		e.HINJServer.SetRules(rules)
+	}
+
+	// the handler runs with the HINJ server's lock held, so it must not block
+	inconsistencyChan := make(chan hinj.ConsistencyEvent, 1)
+	if e.MonitorConsistency {
+		e.HINJServer.MonitorConsistency(hinj.ConsistencyChecks(), func(event hinj.ConsistencyEvent) {
+			select {
+			case inconsistencyChan <- event:
+			default:
+			}
+		})
+		defer e.HINJServer.StopMonitoringConsistency()
+	}
+
 	if err := e.Simulator.Start(); err != nil {
-		return err
+		return nil, err
 	}
 	defer e.Simulator.Shutdown(context.Background())
 
-	time.Sleep(time.Second * 5)
+	if err := e.waitUntilReady(ctx, "simulator", e.Simulator.Ready); err != nil {
+		return nil, err
+	}
+	simStart, _ := e.simTime(ctx)
 
 	if err := e.Autopilot.Start(); err != nil {
-		return err
+		return nil, err
 	}
 	defer e.Autopilot.Shutdown(context.Background())
 
 	e.rpcServer, err = controller.New(e.RPCAddr, e.Simulator)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	// workloads may change the rules mid-run, e.g. at a mode change
+	e.rpcServer.SetRuleSetter(e.HINJServer)
+	if err = e.rpcServer.Listen(); err != nil {
+		return nil, err
 	}
 
 	go func() {
 		// TODO -- handle error
-		e.rpcServer.Start()
+		e.rpcServer.Serve()
 	}()
 	defer e.rpcServer.Shutdown()
 
+	// everything below stops once the run ends
+	ctx, cancel := context.WithCancel(ctx)
+
+	modeReporterDone := e.doModeReporting(ctx)
+	defer func() { <-modeReporterDone }()
+
 	// there needs to be appropriate space in this channel to avoid deadlock
 	anomalyChan := make(chan detector.Anomaly, len(e.Detectors))
 	detectorProxy := detector.NewDetectorProxy(e.Detectors, anomalyChan)
-	modeExitChan := e.doModeReporting()
 	detectorProxy.Start()
-	defer func() { modeExitChan <- 1 }()
 	defer detectorProxy.Shutdown()
+	defer cancel()
 
 	e.Simulator.AddPostStepAction(
 		func() {
-			ctx, cc := context.WithTimeout(context.Background(), time.Millisecond*100)
+			stepCtx, cc := context.WithTimeout(ctx, time.Millisecond*100)
 			defer cc()
-			pos, err := e.Simulator.Position(ctx)
+			pos, err := e.Simulator.Position(stepCtx)
 			if err != nil {
 				return
 			}
 
-			ctx, cc = context.WithTimeout(context.Background(), time.Millisecond*100)
+			stepCtx, cc = context.WithTimeout(ctx, time.Millisecond*100)
 			defer cc()
-			time, err := e.Simulator.SimTime(ctx)
+			time, err := e.Simulator.SimTime(stepCtx)
 			if err != nil {
 				return
 			}
 
-			if e.TraceParameters.TraceSensors {
-				e.sampleSensors()
-			}
+			e.positionLock.Lock()
+			e.positions = append(e.positions, tracedPosition{
+				Iteration: e.Simulator.Iterations(),
+				Time:      time,
+				Position:  pos,
+			})
+			e.positionLock.Unlock()
 
-			detectorProxy.PositionChan() <- entities.TimestampedPosition{
-				Time:     time,
-				Position: pos,
+			// the detectors stop reading once the run ends
+			select {
+			case detectorProxy.PositionChan() <- entities.TimestampedPosition{Time: time, Position: pos}:
+			case <-ctx.Done():
 			}
 		},
 	)
+	failureActive := make([]bool, len(e.MissionFailurePlan))
+	// steps may still run as the run ends, so failureApplied is guarded
+	var failureLock sync.Mutex
+	failureApplied := make([]bool, len(e.MissionFailurePlan))
 	e.Simulator.AddPostStepAction(
 		func() {
-			// check if its time for a failure
-			for _, plan := range e.MissionFailurePlan {
-				if plan.FailureTime == e.Simulator.Iterations() {
-					e.HINJServer.FailSensor(plan.SensorFailure.SensorType, plan.SensorFailure.Instance)
+			failureLock.Lock()
+			defer failureLock.Unlock()
+
+			// check if its time for a failure to begin or end
+			iterations := e.Simulator.Iterations()
+			for i, plan := range e.MissionFailurePlan {
+				active := plan.ActiveAt(iterations)
+				if active && !failureActive[i] {
+					e.HINJServer.InjectFault(plan.SensorFailure)
+					failureApplied[i] = true
+				} else if !active && failureActive[i] {
+					e.HINJServer.RestoreSensor(plan.SensorFailure.SensorType, plan.SensorFailure.Instance)
 				}
+				failureActive[i] = active
 			}
 		},
 	)
 
-	time.Sleep(time.Second * 10)
+	if err := e.waitUntilReady(ctx, "autopilot", e.Autopilot.Ready); err != nil {
+		return nil, err
+	}
 
+	// never closed in REPL mode, where there is no workload
+	var workloadExited <-chan struct{}
+	var runningWorkload *workload
 	if !e.REPL {
-		cmd := executeWorkload(e.WorkloadCmd)
-		defer func() {
-			cmd.Process.Kill()
-			cmd.Process.Wait()
-		}()
+		runningWorkload, err = startWorkload(e.WorkloadCmd, e.WorkloadEnv, e.LogPrefix)
+		if err != nil {
+			return nil, fmt.Errorf("unable to start the workload: %s", err)
+		}
+		defer runningWorkload.stop()
+		workloadExited = runningWorkload.exited
 	}
-
 	rpcDone := e.rpcServer.Done()
 	keepGoing := true
-
-	// TODO: this can deadlock if a client calls Terminate, but then reports mode changes.
-	// It can also deadlock if the anomaly queue is saturated between a client terminating and shutting down detectors
 	for keepGoing {
 		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
 		case <-rpcDone:
 			keepGoing = false
-			e.MissionSuccessful = true
+			result.Terminated = true
+			result.DidPass, result.Explanation = e.rpcServer.Verdict()
 		case anomaly := <-anomalyChan:
-			ts := time.Now()
-			fmt.Printf("Anomaly detected: %s\n", anomaly.String())
-			outputFilePath := path.Join(e.OutputLocation, strconv.FormatInt(ts.Unix(), 10))
-			file, err := os.Create(outputFilePath)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "error saving trace: %s\n", err)
-			} else {
-				encoder := json.NewEncoder(file)
-				encoder.Encode(e.MissionFailurePlan)
-				file.Close()
-			}
-			e.MissionSuccessful = false
+			e.recordAnomaly(result, anomaly)
 			keepGoing = false
+		case <-workloadExited:
+			keepGoing = false
+			// a workload that terminates may exit before the run notices
+			select {
+			case <-rpcDone:
+				result.Terminated = true
+				result.DidPass, result.Explanation = e.rpcServer.Verdict()
+			default:
+				simTime, _ := e.simTime(ctx)
+				e.recordAnomaly(result, detector.Anomaly{
+					Time:     simTime,
+					Kind:     detector.ProgramFault,
+					Detector: "workload",
+					Exit:     runningWorkload.exit(),
+				})
+			}
+		case event := <-inconsistencyChan:
+			log.Printf(
+				"%s instances disagree by %f (outlier %d) since iteration %d\n",
+				event.SensorType,
+				event.MaxSpread,
+				event.Outlier,
+				event.StartIteration,
+			)
+			if e.ConsistencyAnomalies {
+				e.recordAnomaly(result, detector.Anomaly{
+					Time:     event.Start,
+					Kind:     detector.Inconsistency,
+					Detector: "consistency",
+				})
+				keepGoing = false
+			}
 		}
 	}
 
-	e.maybeSaveSensors()
+	// other detectors may have reported as the run ended
+	for drained := false; !drained; {
+		select {
+		case anomaly := <-anomalyChan:
+			e.recordAnomaly(result, anomaly)
+		default:
+			drained = true
+		}
+	}
 
-	return nil
+	e.modeLock.Lock()
+	result.ModeChanges = append([]ModeChange(nil), e.modeChanges...)
+	e.modeLock.Unlock()
+	result.Iterations = e.Simulator.Iterations()
+	if simEnd, err := e.simTime(ctx); err == nil && !simStart.IsZero() {
+		result.SimDuration = simEnd.Sub(simStart)
+	}
+	result.WallDuration = time.Since(wallStart)
+	failureLock.Lock()
+	for i, applied := range failureApplied {
+		if applied {
+			result.AppliedFailures = append(result.AppliedFailures, e.MissionFailurePlan[i])
+		}
+	}
+	failureLock.Unlock()
+
+	e.collectStats(result)
+
+	return result, nil
 }
 
-func (e *Executor) maybeSaveSensors() {
-	if !e.TraceParameters.TraceSensors {
-		return
+// the StartupTimeout used if none is set
+const defaultStartupTimeout = time.Minute
+
+// Waits for a component to become ready, for at most StartupTimeout.
+func (e *Executor) waitUntilReady(ctx context.Context, component string, ready func(context.Context) error) error {
+	timeout := e.StartupTimeout
+	if timeout == 0 {
+		timeout = defaultStartupTimeout
 	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
 
-	accelFile, err := os.Create(e.TraceParameters.AccelTraceOutput)
-	if err != nil {
-		log.Printf("unable to create accel trace: %s\n", err)
-		return
+	start := time.Now()
+	if err := ready(ctx); err != nil {
+		return fmt.Errorf("%s not ready after %s: %s", component, timeout, err)
 	}
-	accelEncoder := json.NewEncoder(accelFile)
-	accelEncoder.Encode(e.accelPackets)
-	accelFile.Close()
+	log.Printf("%s ready after %s\n", component, time.Since(start).Round(time.Millisecond))
+	return nil
+}
 
-	gpsFile, err := os.Create(e.TraceParameters.GPSTraceOutput)
-	if err != nil {
-		log.Printf("unable to create gps trace: %s\n", err)
-		return
+// Adds anomaly to result, filling in the iteration it was seen at.
+func (e *Executor) recordAnomaly(result *RunResult, anomaly detector.Anomaly) {
+	if anomaly.Iteration == 0 {
+		anomaly.Iteration = e.Simulator.Iterations()
 	}
-	gpsEncoder := json.NewEncoder(gpsFile)
-	gpsEncoder.Encode(e.gpsPackets)
-	gpsFile.Close()
+	fmt.Printf("Anomaly detected: %s\n", anomaly.String())
+	result.Anomalies = append(result.Anomalies, anomaly)
+}
 
-	gyroFile, err := os.Create(e.TraceParameters.GyroTraceOutput)
-	if err != nil {
-		log.Printf("unable to create gyro trace: %s\n", err)
-		return
+// Returns the simulator's time, or an error if it does not answer promptly.
+func (e *Executor) simTime(ctx context.Context) (time.Time, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Millisecond*100)
+	defer cancel()
+	return e.Simulator.SimTime(ctx)
+}
+
+// Returns the name of the run's files in the output location.
+func (e *Executor) runName() string {
+	if e.Name != "" {
+		return e.Name
 	}
-	gyroEncoder := json.NewEncoder(gyroFile)
-	gyroEncoder.Encode(e.gyroPackets)
-	gyroFile.Close()
+	// runs may end in the same second
+	return strconv.FormatInt(time.Now().UnixNano(), 10)
+}
 
-	baroFile, err := os.Create(e.TraceParameters.BarometerTraceOutput)
-	if err != nil {
-		log.Printf("unable to create baro trace: %s\n", err)
-		return
+// Completes result with HINJ's statistics.
+func (e *Executor) collectStats(result *RunResult) {
+	result.Sensors = e.HINJServer.Stats()
+	result.Inconsistencies = e.HINJServer.ConsistencyEvents()
+	result.VacuousFailures = vacuousFailures(e.MissionFailurePlan, result.Sensors)
+	for _, failure := range result.VacuousFailures {
+		log.Printf(
+			"vacuous run: the failure of %s %d never changed a packet\n",
+			failure.SensorFailure.SensorType,
+			failure.SensorFailure.Instance,
+		)
 	}
-	baroEncoder := json.NewEncoder(baroFile)
-	baroEncoder.Encode(e.baroPackets)
-	baroFile.Close()
+}
 
-	compassFile, err := os.Create(e.TraceParameters.CompassTraceOutput)
+// Writes result to the output location.
+func (e *Executor) saveResult(result *RunResult) {
+	outputFilePath := path.Join(e.OutputLocation, result.Name+".run.json")
+	file, err := os.Create(outputFilePath)
 	if err != nil {
-		log.Printf("unable to create compass trace: %s\n", err)
+		log.Printf("unable to save the run's result: %s\n", err)
 		return
 	}
-	compassEncoder := json.NewEncoder(compassFile)
-	compassEncoder.Encode(e.compassPackets)
-	compassFile.Close()
+	defer file.Close()
 
+	encoder := json.NewEncoder(file)
+	encoder.Encode(result)
 }
 
-func (e *Executor) clearSensors() {
-	e.accelPackets = make(map[uint64]hinj.AccelerometerPacket)
-	e.gyroPackets = make(map[uint64]hinj.GyroscopePacket)
-	e.baroPackets = make(map[uint64]hinj.BarometerPacket)
-	e.gpsPackets = make(map[uint64]hinj.GPSPacket)
-	e.compassPackets = make(map[uint64]hinj.CompassPacket)
+// Returns the failures in plans that never changed a packet of their sensor instance.
+func vacuousFailures(plans []FailurePlan, stats []hinj.SensorStats) []FailurePlan {
+	var vacuous []FailurePlan
+	for _, plan := range plans {
+		hit := false
+		for _, instanceStats := range stats {
+			if instanceStats.SensorType == plan.SensorFailure.SensorType &&
+				instanceStats.Instance == plan.SensorFailure.Instance &&
+				instanceStats.Faulted > 0 {
+				hit = true
+				break
+			}
+		}
+		if !hit {
+			vacuous = append(vacuous, plan)
+		}
+	}
+	return vacuous
 }
 
-func (e *Executor) sampleSensors() {
-	if e.rand.Float64() > .99 {
-		it := e.Simulator.Iterations()
-		e.accelPackets[it] = e.HINJServer.GetLastAccelReading()
-		e.baroPackets[it] = e.HINJServer.GetLastBarometerReading()
-		e.gpsPackets[it] = e.HINJServer.GetLastGPSReading()
-		e.gyroPackets[it] = e.HINJServer.GetLastGyroReading()
-		e.compassPackets[it] = e.HINJServer.GetLastCompassReading()
+// Returns where the run named runName writes the trace of each traced sensor type.
+func (e *Executor) traceOutputs(runName string) map[hinj.Sensor]string {
+	outputs := make(map[hinj.Sensor]string)
+	for _, packetType := range hinj.PacketTypes() {
+		outputPath := e.TraceParameters.Outputs[packetType.Name]
+		if !packetType.IsSensor || outputPath == "" {
+			continue
+		} else if e.TraceParameters.PerRun {
+			outputPath = path.Join(path.Dir(outputPath), runName, path.Base(outputPath))
+		}
+		outputs[packetType.ID] = outputPath
 	}
+	return outputs
 }
 
-func (e *Executor) doModeReporting() chan int {
-	keepGoing := true
-	exitCh := make(chan int)
+// Records mode changes, and passes them to ModeChangeHandler, until ctx is done.
+// Returns a channel that is closed once the reporter has stopped.
+func (e *Executor) doModeReporting(ctx context.Context) <-chan struct{} {
+	e.modeLock.Lock()
+	e.modeChanges = nil
+	e.modeLock.Unlock()
+
+	done := make(chan struct{})
 	go func() {
+		defer close(done)
 		modeCh := e.rpcServer.Mode()
-		for keepGoing {
+		for {
 			select {
-			case <-exitCh:
-				keepGoing = false
+			case <-ctx.Done():
+				return
 			case mode := <-modeCh:
+				iterations := e.Simulator.Iterations()
+				e.modeLock.Lock()
+				e.modeChanges = append(e.modeChanges, ModeChange{Iteration: iterations, Mode: mode})
+				e.modeLock.Unlock()
 				if e.ModeChangeHandler != nil {
-					iterations := e.Simulator.Iterations()
 					e.ModeChangeHandler(iterations, mode)
 				}
 			}
 		}
 	}()
-	return exitCh
-}
-
-func executeWorkload(workloadCmd string) *exec.Cmd {
-	log, err := util.GetLogger("workload ")
-	if err != nil {
-		log.Fatalf("Could not get a logger: %s", err)
-	}
-
-	cmd := exec.Command("sh", "-c", workloadCmd)
-	cmd.Env = os.Environ()
-	util.LogProcess(cmd, log)
-	cmd.Start()
-
-	return cmd
+	return done
 }
@@ -0,0 +1,363 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/obicons/avis/controller"
+	"github.com/obicons/avis/detector"
+	"github.com/obicons/avis/entities"
+	"github.com/obicons/avis/hinj"
+)
+
+func TestUnitFailurePlanPermanent(t *testing.T) {
+	plan := FailurePlan{FailureTime: 10}
+	if plan.ActiveAt(9) {
+		t.Fatalf("failure active before FailureTime")
+	} else if !plan.ActiveAt(10) || !plan.ActiveAt(100000) {
+		t.Fatalf("permanent failure not active after FailureTime")
+	}
+}
+
+func TestUnitFailurePlanDuration(t *testing.T) {
+	plan := FailurePlan{FailureTime: 10, Duration: 200}
+	if !plan.ActiveAt(10) || !plan.ActiveAt(209) {
+		t.Fatalf("failure not active during its duration")
+	} else if plan.ActiveAt(210) {
+		t.Fatalf("failure still active after its duration")
+	}
+}
+
+func TestUnitFailurePlanDutyCycle(t *testing.T) {
+	plan := FailurePlan{FailureTime: 100, OnTime: 50, OffTime: 50}
+	expected := map[uint64]bool{
+		99:  false,
+		100: true,
+		149: true,
+		150: false,
+		199: false,
+		200: true,
+	}
+	for iteration, active := range expected {
+		if plan.ActiveAt(iteration) != active {
+			t.Fatalf("expected ActiveAt(%d) = %t", iteration, active)
+		}
+	}
+}
+
+func TestUnitFailurePlanDutyCycleWithDuration(t *testing.T) {
+	plan := FailurePlan{FailureTime: 0, Duration: 120, OnTime: 50, OffTime: 50}
+	if !plan.ActiveAt(110) {
+		t.Fatalf("expected the failure to flicker back on at 110")
+	} else if plan.ActiveAt(120) {
+		t.Fatalf("expected the failure to end after its duration")
+	}
+}
+
+func TestUnitVacuousFailures(t *testing.T) {
+	gps0 := FailurePlan{SensorFailure: hinj.SensorFailure{SensorType: hinj.GPS, Instance: 0}}
+	gps1 := FailurePlan{SensorFailure: hinj.SensorFailure{SensorType: hinj.GPS, Instance: 1}}
+	baro0 := FailurePlan{SensorFailure: hinj.SensorFailure{SensorType: hinj.Barometer, Instance: 0}}
+	stats := []hinj.SensorStats{
+		{SensorType: hinj.GPS, Instance: 0, Packets: 10, Faulted: 5},
+		// sent packets, but none while failed
+		{SensorType: hinj.GPS, Instance: 1, Packets: 10},
+	}
+
+	vacuous := vacuousFailures([]FailurePlan{gps0, gps1, baro0}, stats)
+	if len(vacuous) != 2 || vacuous[0] != gps1 || vacuous[1] != baro0 {
+		t.Fatalf("expected GPS 1 and barometer 0 to be vacuous, found %+v", vacuous)
+	}
+}
+
+var expectedShutdownOrder = []string{"detector", "autopilot", "simulator"}
+
+func checkShutdownOrder(t *testing.T, log *shutdownLog) {
+	if actual := log.get(); !reflect.DeepEqual(actual, expectedShutdownOrder) {
+		t.Fatalf("expected components to shut down in the order %v, found %v", expectedShutdownOrder, actual)
+	}
+}
+
+func TestUnitExecuteTerminate(t *testing.T) {
+	e, log := newMockExecutor(t, false)
+	var modes []int
+	e.ModeChangeHandler = func(iterations uint64, mode int) { modes = append(modes, mode) }
+	done := executeInBackground(context.Background(), e)
+	client := dialMockExecutor(t, e)
+
+	ctx := context.Background()
+	if _, err := client.Step(ctx, &controller.StepRequest{}); err != nil {
+		t.Fatalf("Step() returned an unexpected error: %s", err)
+	} else if _, err = client.ModeChange(ctx, &controller.ModeChangeRequest{NextMode: 4}); err != nil {
+		t.Fatalf("ModeChange() returned an unexpected error: %s", err)
+	} else if _, err = client.Terminate(ctx, &controller.TerminateRequest{DidPass: true, Explanation: "landed"}); err != nil {
+		t.Fatalf("Terminate() returned an unexpected error: %s", err)
+	}
+
+	// a workload may keep talking after it terminates; none of this may block
+	lateRequests := make(chan struct{})
+	go func() {
+		client.Terminate(ctx, &controller.TerminateRequest{})
+		client.ModeChange(ctx, &controller.ModeChangeRequest{NextMode: 5})
+		client.Step(ctx, &controller.StepRequest{})
+		close(lateRequests)
+	}()
+
+	result, err := waitForExecute(t, done)
+	if err != nil {
+		t.Fatalf("Execute() returned an unexpected error: %s", err)
+	} else if !result.Successful() || !result.DidPass || result.Explanation != "landed" {
+		t.Fatalf("expected a terminated mission to be successful, found %+v", result)
+	} else if len(modes) == 0 || modes[0] != 4 {
+		t.Fatalf("expected the mode change to be reported, found %v", modes)
+	} else if len(result.ModeChanges) == 0 || result.ModeChanges[0] != (ModeChange{Iteration: 1, Mode: 4}) {
+		t.Fatalf("expected the mode change to be in the result, found %+v", result.ModeChanges)
+	} else if result.Iterations < 1 || result.SimDuration < time.Second {
+		t.Fatalf("expected the run to last at least a step, found %+v", result)
+	} else if _, err = os.Stat(path.Join(e.OutputLocation, result.Name+".run.json")); err != nil {
+		t.Fatalf("expected the result to be saved: %s", err)
+	}
+	select {
+	case <-lateRequests:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("requests made after Terminate() blocked")
+	}
+	checkShutdownOrder(t, log)
+}
+
+func TestUnitExecuteOverTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() returned an unexpected error: %s", err)
+	}
+	// a free port, hopefully still free once Execute listens on it
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	e, _ := newMockExecutor(t, false)
+	e.RPCAddr = fmt.Sprintf("tcp://127.0.0.1:%d", port)
+	done := executeInBackground(context.Background(), e)
+	client := dialMockExecutor(t, e)
+	if _, err = client.Terminate(context.Background(), &controller.TerminateRequest{DidPass: true}); err != nil {
+		t.Fatalf("Terminate() returned an unexpected error: %s", err)
+	} else if result, err := waitForExecute(t, done); err != nil || !result.Successful() {
+		t.Fatalf("expected a workload dialing over TCP to terminate the run, found %+v, %v", result, err)
+	}
+}
+
+func TestUnitExecuteAnomaly(t *testing.T) {
+	e, log := newMockExecutor(t, true)
+	applied := FailurePlan{SensorFailure: hinj.SensorFailure{SensorType: hinj.GPS}, FailureTime: 1}
+	tooLate := FailurePlan{SensorFailure: hinj.SensorFailure{SensorType: hinj.Compass}, FailureTime: 1 << 40}
+	e.MissionFailurePlan = []FailurePlan{applied, tooLate}
+	e.HINJRecordPath = path.Join(e.OutputLocation, "hinj.record")
+	e.TraceParameters = entities.SensorTraceParameters{
+		TraceSensors: true,
+		Outputs:      map[string]string{"GPS": path.Join(e.OutputLocation, "data", "gps.jsonl")},
+		PerRun:       true,
+	}
+	done := executeInBackground(context.Background(), e)
+	client := dialMockExecutor(t, e)
+
+	// the detector reports on every step, far more often than anyone reads
+	go func() {
+		for {
+			if _, err := client.Step(context.Background(), &controller.StepRequest{}); err != nil {
+				return
+			}
+		}
+	}()
+
+	result, err := waitForExecute(t, done)
+	if err != nil {
+		t.Fatalf("Execute() returned an unexpected error: %s", err)
+	} else if result.Successful() || result.Terminated || result.WorkloadCrashed() {
+		t.Fatalf("expected an anomaly to fail the mission")
+	} else if anomaly := result.Anomalies[0]; anomaly.Detector != "mock" || anomaly.Iteration == 0 {
+		t.Fatalf("expected the anomaly to name its detector and iteration, found %+v", anomaly)
+	} else if len(result.AppliedFailures) != 1 || result.AppliedFailures[0] != applied {
+		t.Fatalf("expected only the first failure to be applied, found %+v", result.AppliedFailures)
+	}
+	checkBundle(t, result, "hinj.trace", "sensors/gps.jsonl")
+	if _, err = os.Stat(path.Join(e.OutputLocation, "data", result.Name, "gps.jsonl")); err != nil {
+		t.Fatalf("expected the run to write its own trace: %s", err)
+	}
+	checkShutdownOrder(t, log)
+}
+
+// checks that the bug bundle of result holds what its manifest says
+// also checks that the bundle holds extraFiles; returns the manifest
+func checkBundle(t *testing.T, result *RunResult, extraFiles ...string) BundleManifest {
+	file, err := os.Open(path.Join(result.Bundle, BundleManifestName))
+	if err != nil {
+		t.Fatalf("expected a manifest in the bug bundle: %s", err)
+	}
+	defer file.Close()
+
+	var manifest BundleManifest
+	if err = json.NewDecoder(file).Decode(&manifest); err != nil {
+		t.Fatalf("Decode() returned an unexpected error: %s", err)
+	} else if len(manifest.Anomalies) != len(result.Anomalies) || len(manifest.CommandLine) == 0 {
+		t.Fatalf("unexpected manifest: %+v", manifest)
+	}
+
+	expected := []string{BundleFailurePlanName, "result.json", "positions.jsonl", "flight_logs/00000001.BIN"}
+	for _, name := range append(expected, extraFiles...) {
+		found := false
+		for _, file := range manifest.Files {
+			found = found || file.Path == name
+		}
+		if !found {
+			t.Fatalf("expected %s in the manifest, found %+v (missing %v)", name, manifest.Files, manifest.Missing)
+		} else if _, err = os.Stat(path.Join(result.Bundle, name)); err != nil {
+			t.Fatalf("expected %s in the bug bundle: %s", name, err)
+		}
+	}
+	return manifest
+}
+
+func TestUnitBundlesDoNotOverwrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "avis-bundle")
+	if err != nil {
+		t.Fatalf("TempDir() returned an unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	first, err := createUniqueDir(path.Join(dir, "run"))
+	if err != nil {
+		t.Fatalf("createUniqueDir() returned an unexpected error: %s", err)
+	}
+	second, err := createUniqueDir(path.Join(dir, "run"))
+	if err != nil {
+		t.Fatalf("createUniqueDir() returned an unexpected error: %s", err)
+	} else if first == second || path.Base(second) != "run-1" {
+		t.Fatalf("expected a second bundle named run-1, found %s and %s", first, second)
+	}
+}
+
+func TestUnitBundleEnvironment(t *testing.T) {
+	environ := []string{"PATH=/usr/bin", "AWS_SECRET_ACCESS_KEY=hunter2", "RMCK_DEBUG=1", "GITHUB_TOKEN=abc", "PATHS=x", "ARDUPILOT_SRC_PATH=/src"}
+	kept := bundleEnvironment(environ)
+	if !reflect.DeepEqual(kept, []string{"PATH=/usr/bin", "RMCK_DEBUG=1", "ARDUPILOT_SRC_PATH=/src"}) {
+		t.Fatalf("expected only the variables avis reads, found %v", kept)
+	}
+}
+
+func TestUnitBundleKeepsOwnLogLines(t *testing.T) {
+	dir, err := ioutil.TempDir("", "avis-bundle")
+	if err != nil {
+		t.Fatalf("TempDir() returned an unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	logPath := path.Join(dir, "avis.log")
+	before := "worker-1 px4 before the run\n"
+	lines := before + "worker-1 px4 ours\nworker-2 px4 theirs\nworker-1 gazebo also ours"
+	if err = ioutil.WriteFile(logPath, []byte(lines), 0666); err != nil {
+		t.Fatalf("WriteFile() returned an unexpected error: %s", err)
+	}
+
+	w := bundleWriter{dir: dir}
+	w.copyLinesFrom(logPath, int64(len(before)), "worker-1 ", "bundle.log", "the run's log")
+	if contents, err := ioutil.ReadFile(path.Join(dir, "bundle.log")); err != nil {
+		t.Fatalf("expected the log to be copied: %s (missing %v)", err, w.manifest.Missing)
+	} else if string(contents) != "worker-1 px4 ours\nworker-1 gazebo also ours" {
+		t.Fatalf("expected only the run's lines, found %q", contents)
+	}
+}
+
+func TestUnitExecuteWorkloadCrash(t *testing.T) {
+	e, log := newMockExecutor(t, false)
+	e.REPL = false
+	e.WorkloadCmd = "echo starting >&2; echo Traceback >&2; exit 3"
+
+	result, err := waitForExecute(t, executeInBackground(context.Background(), e))
+	if err != nil {
+		t.Fatalf("Execute() returned an unexpected error: %s", err)
+	} else if len(result.Anomalies) != 1 || !result.WorkloadCrashed() {
+		t.Fatalf("expected the crash to be the only anomaly, found %+v", result.Anomalies)
+	}
+	anomaly := result.Anomalies[0]
+	if anomaly.Kind != detector.ProgramFault || anomaly.Detector != "workload" || anomaly.Exit == nil {
+		t.Fatalf("expected a program fault from the workload, found %+v", anomaly)
+	} else if exit := anomaly.Exit; exit.ExitCode != 3 || exit.Signal != "" || !reflect.DeepEqual(exit.Output, []string{"starting", "Traceback"}) {
+		t.Fatalf("unexpected exit: %+v", exit)
+	}
+
+	// the run was not traced, so its bundle must say why
+	manifest := checkBundle(t, result)
+	tracesMissing := false
+	for _, reason := range manifest.Missing {
+		tracesMissing = tracesMissing || strings.HasPrefix(reason, "sensor traces: sensor tracing (-sensor.trace) was off")
+	}
+	if !tracesMissing {
+		t.Fatalf("expected the missing sensor traces to be explained, found %v", manifest.Missing)
+	}
+	checkShutdownOrder(t, log)
+}
+
+func TestUnitExecuteWorkloadKilled(t *testing.T) {
+	e, _ := newMockExecutor(t, false)
+	e.REPL = false
+	e.WorkloadCmd = "kill -KILL $$"
+
+	result, err := waitForExecute(t, executeInBackground(context.Background(), e))
+	if err != nil {
+		t.Fatalf("Execute() returned an unexpected error: %s", err)
+	} else if len(result.Anomalies) != 1 || result.Anomalies[0].Exit == nil {
+		t.Fatalf("expected the workload's death to be reported, found %+v", result.Anomalies)
+	} else if exit := result.Anomalies[0].Exit; exit.ExitCode != -1 || exit.Signal != "killed" {
+		t.Fatalf("expected the workload to be killed by a signal, found %+v", exit)
+	}
+}
+
+func TestUnitExecuteWithoutOutputLocation(t *testing.T) {
+	e, _ := newMockExecutor(t, false)
+	e.REPL = false
+	e.WorkloadCmd = "exit 1"
+	e.OutputLocation = ""
+
+	result, err := waitForExecute(t, executeInBackground(context.Background(), e))
+	if err != nil {
+		t.Fatalf("Execute() returned an unexpected error: %s", err)
+	} else if len(result.Anomalies) == 0 || result.Bundle != "" {
+		t.Fatalf("expected an anomaly without a bug bundle, found %+v", result)
+	} else if _, err = os.Stat(result.Name + ".run.json"); !os.IsNotExist(err) {
+		os.Remove(result.Name + ".run.json")
+		t.Fatalf("expected the result not to be saved in the working directory")
+	}
+}
+
+func TestUnitExecuteCancel(t *testing.T) {
+	e, log := newMockExecutor(t, false)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := executeInBackground(ctx, e)
+	dialMockExecutor(t, e)
+
+	cancel()
+	if _, err := waitForExecute(t, done); err != context.Canceled {
+		t.Fatalf("expected Execute() to return %s, found %v", context.Canceled, err)
+	}
+	checkShutdownOrder(t, log)
+}
+
+func TestUnitExecuteAutopilotNotReady(t *testing.T) {
+	e, log := newMockExecutor(t, false)
+	e.Autopilot.(*mockAutopilot).hang = true
+	e.StartupTimeout = 50 * time.Millisecond
+
+	_, err := waitForExecute(t, executeInBackground(context.Background(), e))
+	if err == nil || !strings.Contains(err.Error(), "autopilot not ready") {
+		t.Fatalf("expected Execute() to time out waiting for the autopilot, found %v", err)
+	}
+	checkShutdownOrder(t, log)
+}
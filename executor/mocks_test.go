@@ -0,0 +1,256 @@
+package executor
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/obicons/avis/controller"
+	"github.com/obicons/avis/detector"
+	"github.com/obicons/avis/entities"
+	"github.com/obicons/avis/hinj"
+	"github.com/obicons/avis/sim"
+	"github.com/obicons/avis/util"
+	"google.golang.org/grpc"
+)
+
+// records the order in which mocks shut down
+type shutdownLog struct {
+	sync.Mutex
+	components []string
+}
+
+func (l *shutdownLog) add(component string) {
+	l.Lock()
+	defer l.Unlock()
+	l.components = append(l.components, component)
+}
+
+func (l *shutdownLog) get() []string {
+	l.Lock()
+	defer l.Unlock()
+	return append([]string(nil), l.components...)
+}
+
+// implements sim.Sim without a simulator; each step runs the post-step actions
+type mockSim struct {
+	sync.Mutex
+	log        *shutdownLog
+	actions    []sim.StepActions
+	iterations uint64
+}
+
+func (s *mockSim) Start() error                    { return nil }
+func (s *mockSim) Ready(ctx context.Context) error { return nil }
+
+func (s *mockSim) Shutdown(ctx context.Context) error {
+	s.log.add("simulator")
+	return nil
+}
+
+func (s *mockSim) Step(ctx context.Context) error {
+	atomic.AddUint64(&s.iterations, 1)
+	s.Lock()
+	actions := s.actions
+	s.Unlock()
+	for _, action := range actions {
+		action()
+	}
+	return nil
+}
+
+func (s *mockSim) SimTime(ctx context.Context) (time.Time, error) {
+	return time.Unix(int64(s.Iterations()), 0), nil
+}
+
+func (s *mockSim) Position(ctx context.Context) (entities.Position, error) {
+	return entities.Position{}, nil
+}
+
+func (s *mockSim) AddPostStepAction(action sim.StepActions) {
+	s.Lock()
+	defer s.Unlock()
+	s.actions = append(s.actions, action)
+}
+
+func (s *mockSim) Iterations() uint64 {
+	return atomic.LoadUint64(&s.iterations)
+}
+
+// implements platforms.System without an autopilot
+type mockAutopilot struct {
+	log *shutdownLog
+	// where its flight logs are written
+	dir string
+	// if set, the autopilot never becomes ready
+	hang bool
+}
+
+func (a *mockAutopilot) Start() error { return nil }
+
+func (a *mockAutopilot) Ready(ctx context.Context) error {
+	if a.hang {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return nil
+}
+
+func (a *mockAutopilot) Shutdown(ctx context.Context) error {
+	a.log.add("autopilot")
+	return nil
+}
+
+// implements platforms.FlightLogger
+func (a *mockAutopilot) FlightLogs(since time.Time) ([]string, error) {
+	flightLog := path.Join(a.dir, "00000001.BIN")
+	return []string{flightLog}, ioutil.WriteFile(flightLog, []byte("dataflash"), 0666)
+}
+
+func (a *mockAutopilot) GetGazeboConfig() (*sim.GazeboConfig, error) { return nil, nil }
+func (a *mockAutopilot) MAVLinkAddr() string                         { return "udp:127.0.0.1:14550" }
+
+// reports an anomaly for every position it sees, if chatty is set
+type mockDetector struct {
+	log          *shutdownLog
+	chatty       bool
+	positionChan chan entities.TimestampedPosition
+	shutdownChan chan int
+	anomalyChan  chan<- detector.Anomaly
+}
+
+func (d *mockDetector) PositionChan() chan<- entities.TimestampedPosition { return d.positionChan }
+func (d *mockDetector) SetAnomalyChan(ch chan<- detector.Anomaly)         { d.anomalyChan = ch }
+
+func (d *mockDetector) Start() {
+	go func() {
+		for {
+			select {
+			case <-d.shutdownChan:
+				return
+			case pos := <-d.positionChan:
+				if d.chatty {
+					detector.Report(d.anomalyChan, detector.Anomaly{Time: pos.Time, Kind: detector.FreeFall, Detector: "mock"})
+				}
+			}
+		}
+	}()
+}
+
+func (d *mockDetector) Shutdown() {
+	d.log.add("detector")
+	d.shutdownChan <- 0
+}
+
+// Returns an executor whose components are all mocked, except for HINJ and the RPC server.
+func newMockExecutor(t *testing.T, chatty bool) (*Executor, *shutdownLog) {
+	dir, err := ioutil.TempDir("", "avis-executor")
+	if err != nil {
+		t.Fatalf("TempDir() returned an unexpected error: %s", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	hinjServer, err := hinj.NewHINJServer("unix://" + path.Join(dir, "hinj.sock"))
+	if err != nil {
+		t.Fatalf("NewHINJServer() returned an unexpected error: %s", err)
+	}
+
+	log := &shutdownLog{}
+	return &Executor{
+		HINJServer: hinjServer,
+		Simulator:  &mockSim{log: log},
+		Autopilot:  &mockAutopilot{log: log, dir: dir},
+		RPCAddr:    "unix://" + path.Join(dir, "rpc.sock"),
+		Detectors: []detector.Detector{
+			&mockDetector{
+				log:          log,
+				chatty:       chatty,
+				positionChan: make(chan entities.TimestampedPosition),
+				shutdownChan: make(chan int),
+			},
+		},
+		OutputLocation: dir,
+		REPL:           true,
+		StartupTimeout: time.Second,
+	}, log
+}
+
+// what Execute returned
+type execution struct {
+	result *RunResult
+	err    error
+}
+
+// Runs e in the background, and returns a channel that receives what Execute returns.
+func executeInBackground(ctx context.Context, e *Executor) <-chan execution {
+	done := make(chan execution, 1)
+	go func() {
+		result, err := e.ExecuteContext(ctx)
+		done <- execution{result, err}
+	}()
+	return done
+}
+
+// Connects to e's RPC server, as a workload would.
+func dialMockExecutor(t *testing.T, e *Executor) controller.SimulatorControllerClient {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	u, err := url.Parse(e.RPCAddr)
+	if err != nil {
+		t.Fatalf("Parse() returned an unexpected error: %s", err)
+	}
+	network, address, err := util.URLNetworkAddress(u)
+	if err != nil {
+		t.Fatalf("URLNetworkAddress() returned an unexpected error: %s", err)
+	}
+
+	// gRPC waits a second before retrying, so wait for Execute to listen first
+	err = util.WaitUntil(ctx, time.Millisecond, func() bool {
+		conn, err := net.Dial(network, address)
+		if err == nil {
+			conn.Close()
+		}
+		return err == nil
+	})
+	if err != nil {
+		t.Fatalf("the RPC server did not listen on %s: %s", e.RPCAddr, err)
+	}
+
+	// this version of gRPC cannot resolve unix targets itself
+	target, options := "passthrough:///"+address, []grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", addr)
+		}),
+	}
+	if network != "unix" {
+		// dial what a workload is given
+		if target, err = util.GRPCTarget(e.RPCAddr); err != nil {
+			t.Fatalf("GRPCTarget() returned an unexpected error: %s", err)
+		}
+		options = nil
+	}
+	conn, err := grpc.DialContext(ctx, target, append(options, grpc.WithInsecure(), grpc.WithBlock())...)
+	if err != nil {
+		t.Fatalf("DialContext() returned an unexpected error: %s", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return controller.NewSimulatorControllerClient(conn)
+}
+
+// Waits for Execute to return, failing the test if it does not in time.
+func waitForExecute(t *testing.T, done <-chan execution) (*RunResult, error) {
+	select {
+	case execution := <-done:
+		return execution.result, execution.err
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Execute() did not return")
+	}
+	return nil, nil
+}
@@ -0,0 +1,72 @@
+package executor
+
+import (
+	"time"
+
+	"github.com/obicons/avis/detector"
+	"github.com/obicons/avis/hinj"
+)
+
+// A mode change the workload reported.
+type ModeChange struct {
+	Iteration uint64
+	Mode      int
+}
+
+// The outcome of a run, returned by Execute and written to the output location.
+type RunResult struct {
+	// names the run's files in the output location
+	Name string
+	// the failures the run was asked to apply
+	FailurePlan []FailurePlan
+	// the failures that were injected at some point during the run
+	AppliedFailures []FailurePlan
+	// every anomaly reported, in the order it was reported
+	Anomalies []detector.Anomaly
+	// set if the workload ended the run by calling Terminate
+	Terminated bool
+	// what the workload passed to Terminate
+	DidPass     bool
+	Explanation string
+	// the workload's mode changes, in order
+	ModeChanges []ModeChange
+	// the number of times the simulator stepped
+	Iterations uint64
+	// how long the run took, in simulated and real time
+	SimDuration  time.Duration
+	WallDuration time.Duration
+	// statistics of every sensor instance HINJ heard from during the run
+	Sensors []hinj.SensorStats
+	// the planned failures that never changed a packet; a run with any is vacuous
+	VacuousFailures []FailurePlan
+	// the periods during which the instances of a sensor disagreed
+	Inconsistencies []hinj.ConsistencyEvent
+	// the directory the run's bug bundle was written to, if it had an anomaly
+	Bundle string
+}
+
+// Returns whether the workload finished without an anomaly.
+// Workloads do not all set DidPass, so it is not considered.
+func (r *RunResult) Successful() bool {
+	return r.Terminated && len(r.Anomalies) == 0
+}
+
+// Returns whether every anomaly of the run is a program fault, i.e. the workload
+// exited early. Such a run says nothing about whether the vehicle was safe.
+func (r *RunResult) WorkloadCrashed() bool {
+	for _, anomaly := range r.Anomalies {
+		if anomaly.Kind != detector.ProgramFault {
+			return false
+		}
+	}
+	return len(r.Anomalies) != 0
+}
+
+// Returns the iterations at which the mode changed.
+func (r *RunResult) ModeChangeIterations() []uint64 {
+	iterations := make([]uint64, len(r.ModeChanges))
+	for i, change := range r.ModeChanges {
+		iterations[i] = change.Iteration
+	}
+	return iterations
+}
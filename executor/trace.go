@@ -0,0 +1,170 @@
+package executor
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/obicons/avis/entities"
+	"github.com/obicons/avis/hinj"
+)
+
+// how often traces are flushed to disk, so that a crash loses at most this much
+const traceFlushInterval = time.Second
+
+// how many observations may wait for the writer before new ones are dropped
+const traceQueueSize = 4096
+
+// Streams the sensor packets HINJ sends back to one JSON Lines file per sensor type.
+// Each line is a hinj.Observation.
+// HINJ passes observations with its lock held, so they are only queued there;
+// a writer goroutine does the I/O.
+type sensorTracer struct {
+	sampling entities.SensorSampling
+	queue    chan hinj.Observation
+
+	lock sync.Mutex
+	// when each instance's last kept packet was sent, for rate sampling
+	lastKept map[hinj.Sensor]map[uint8]time.Time
+	// the observations kept while the queue was full
+	dropped uint64
+	closed  bool
+
+	// only the writer uses these once it starts
+	files    map[hinj.Sensor]*os.File
+	writers  map[hinj.Sensor]*bufio.Writer
+	encoders map[hinj.Sensor]*json.Encoder
+	// the first error writing a trace
+	err        error
+	writerDone chan struct{}
+}
+
+// Creates the trace of each sensor type in outputs.
+func newSensorTracer(outputs map[hinj.Sensor]string, sampling entities.SensorSampling) (*sensorTracer, error) {
+	tracer := &sensorTracer{
+		sampling:   sampling,
+		queue:      make(chan hinj.Observation, traceQueueSize),
+		lastKept:   make(map[hinj.Sensor]map[uint8]time.Time),
+		files:      make(map[hinj.Sensor]*os.File),
+		writers:    make(map[hinj.Sensor]*bufio.Writer),
+		encoders:   make(map[hinj.Sensor]*json.Encoder),
+		writerDone: make(chan struct{}),
+	}
+	for sensorType, outputPath := range outputs {
+		if err := os.MkdirAll(path.Dir(outputPath), 0777); err != nil {
+			tracer.closeFiles()
+			return nil, fmt.Errorf("unable to create %s trace: %s", sensorType, err)
+		}
+		file, err := os.Create(outputPath)
+		if err != nil {
+			tracer.closeFiles()
+			return nil, fmt.Errorf("unable to create %s trace: %s", sensorType, err)
+		}
+		writer := bufio.NewWriter(file)
+		tracer.files[sensorType] = file
+		tracer.writers[sensorType] = writer
+		tracer.encoders[sensorType] = json.NewEncoder(writer)
+		tracer.lastKept[sensorType] = make(map[uint8]time.Time)
+	}
+	go tracer.write()
+	return tracer, nil
+}
+
+// Queues observation for its sensor's trace if the sampling policy keeps it.
+// Never blocks: if the writer has fallen behind, the observation is dropped and counted.
+// Passed to HINJServer.ObservePackets.
+func (t *sensorTracer) observe(observation hinj.Observation) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.closed || t.lastKept[observation.SensorType] == nil || !t.keep(observation) {
+		return
+	}
+	select {
+	case t.queue <- observation:
+	default:
+		t.dropped++
+	}
+}
+
+// Returns whether the sampling policy keeps observation, and notes it if so.
+// must be called with t.lock held
+func (t *sensorTracer) keep(observation hinj.Observation) bool {
+	if t.sampling.EveryIterations != 0 && observation.Iteration%t.sampling.EveryIterations != 0 {
+		return false
+	}
+	if t.sampling.Rate != 0 {
+		period := time.Duration(float64(time.Second) / t.sampling.Rate)
+		last, seen := t.lastKept[observation.SensorType][observation.Instance]
+		if seen && observation.Time.Sub(last) < period {
+			return false
+		}
+		t.lastKept[observation.SensorType][observation.Instance] = observation.Time
+	}
+	return true
+}
+
+// Writes queued observations until the queue is closed, flushing periodically.
+func (t *sensorTracer) write() {
+	defer close(t.writerDone)
+	ticker := time.NewTicker(traceFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case observation, ok := <-t.queue:
+			if !ok {
+				t.flush()
+				return
+			}
+			err := t.encoders[observation.SensorType].Encode(observation)
+			if err != nil && t.err == nil {
+				t.err = err
+				log.Printf("unable to write %s trace: %s\n", observation.SensorType, err)
+			}
+		case <-ticker.C:
+			t.flush()
+		}
+	}
+}
+
+// must only be called by the writer
+func (t *sensorTracer) flush() {
+	for sensorType, writer := range t.writers {
+		if err := writer.Flush(); err != nil && t.err == nil {
+			t.err = err
+			log.Printf("unable to write %s trace: %s\n", sensorType, err)
+		}
+	}
+}
+
+// must only be called once the writer has stopped, or before it starts
+func (t *sensorTracer) closeFiles() {
+	for sensorType, file := range t.files {
+		if err := file.Close(); err != nil && t.err == nil {
+			t.err = err
+		}
+		delete(t.files, sensorType)
+	}
+}
+
+// Writes the queued observations and closes the traces. Observations passed afterwards are dropped.
+// Returns the first error writing a trace, or else an error if observations were dropped.
+func (t *sensorTracer) Close() error {
+	t.lock.Lock()
+	t.closed = true
+	close(t.queue)
+	dropped := t.dropped
+	t.lock.Unlock()
+
+	<-t.writerDone
+	t.closeFiles()
+	if t.err == nil && dropped != 0 {
+		return fmt.Errorf("dropped %d packets the writer could not keep up with", dropped)
+	}
+	return t.err
+}
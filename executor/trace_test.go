@@ -0,0 +1,139 @@
+package executor
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/obicons/avis/entities"
+	"github.com/obicons/avis/hinj"
+)
+
+// Traces a GPS packet from each of two instances at every millisecond for 100 iterations.
+// Returns the observations in the trace.
+func traceTestPackets(t *testing.T, sampling entities.SensorSampling) []hinj.Observation {
+	dir, err := ioutil.TempDir("", "avis-trace")
+	if err != nil {
+		t.Fatalf("TempDir() returned an unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tracePath := path.Join(dir, "data", "gps.jsonl")
+	tracer, err := newSensorTracer(map[hinj.Sensor]string{hinj.GPS: tracePath}, sampling)
+	if err != nil {
+		t.Fatalf("newSensorTracer() returned an unexpected error: %s", err)
+	}
+	start := time.Unix(100, 0)
+	for iteration := uint64(0); iteration < 100; iteration++ {
+		for instance := uint8(0); instance < 2; instance++ {
+			tracer.observe(hinj.Observation{
+				Iteration:  iteration,
+				Time:       start.Add(time.Duration(iteration) * time.Millisecond),
+				SensorType: hinj.GPS,
+				Instance:   instance,
+				Packet:     &hinj.GPSPacket{Instance: instance, Latitude: int32(iteration)},
+			})
+		}
+		// untraced types are dropped
+		tracer.observe(hinj.Observation{Iteration: iteration, SensorType: hinj.Barometer, Packet: &hinj.BarometerPacket{}})
+	}
+	if err = tracer.Close(); err != nil {
+		t.Fatalf("Close() returned an unexpected error: %s", err)
+	}
+
+	file, err := os.Open(tracePath)
+	if err != nil {
+		t.Fatalf("expected the trace to be written: %s", err)
+	}
+	defer file.Close()
+
+	var observations []hinj.Observation
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var observation hinj.Observation
+		if err := json.Unmarshal(scanner.Bytes(), &observation); err != nil {
+			t.Fatalf("Unmarshal() returned an unexpected error: %s", err)
+		}
+		observations = append(observations, observation)
+	}
+	return observations
+}
+
+func TestUnitSensorTracerKeepsEverything(t *testing.T) {
+	observations := traceTestPackets(t, entities.SensorSampling{})
+	if len(observations) != 200 {
+		t.Fatalf("expected every packet of both instances to be traced, found %d", len(observations))
+	} else if last := observations[199]; last.Iteration != 99 || last.Instance != 1 || last.SensorType != hinj.GPS {
+		t.Fatalf("unexpected last observation: %+v", last)
+	}
+}
+
+func TestUnitSensorTracerEveryIterations(t *testing.T) {
+	observations := traceTestPackets(t, entities.SensorSampling{EveryIterations: 10})
+	if len(observations) != 20 {
+		t.Fatalf("expected 10 iterations of both instances to be traced, found %d", len(observations))
+	}
+	for _, observation := range observations {
+		if observation.Iteration%10 != 0 {
+			t.Fatalf("traced a packet from iteration %d", observation.Iteration)
+		}
+	}
+}
+
+func TestUnitSensorTracerRate(t *testing.T) {
+	// 100 packets per second is a packet every 10ms, so 10 of each instance's 100
+	observations := traceTestPackets(t, entities.SensorSampling{Rate: 100})
+	if len(observations) != 20 {
+		t.Fatalf("expected 10 packets of each instance to be traced, found %d", len(observations))
+	}
+}
+
+func TestUnitSensorTracerDropsWhenBehind(t *testing.T) {
+	// a writer that never reads, with room for one observation
+	writerDone := make(chan struct{})
+	close(writerDone)
+	tracer := &sensorTracer{
+		queue:      make(chan hinj.Observation, 1),
+		lastKept:   map[hinj.Sensor]map[uint8]time.Time{hinj.GPS: {}},
+		writerDone: writerDone,
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for iteration := uint64(0); iteration < 3; iteration++ {
+			tracer.observe(hinj.Observation{Iteration: iteration, SensorType: hinj.GPS, Packet: &hinj.GPSPacket{}})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("observe() blocked on a full queue")
+	}
+
+	if tracer.dropped != 2 {
+		t.Fatalf("expected 2 observations to be dropped, found %d", tracer.dropped)
+	} else if err := tracer.Close(); err == nil {
+		t.Fatalf("expected Close() to report the dropped observations")
+	}
+}
+
+func TestUnitTraceOutputs(t *testing.T) {
+	e := Executor{TraceParameters: entities.SensorTraceParameters{
+		Outputs: map[string]string{"GPS": "gps.jsonl", "Barometer": "", "Mode": "mode.jsonl", "Unknown": "unknown.jsonl"},
+	}}
+	outputs := e.traceOutputs("run")
+	if len(outputs) != 1 || outputs[hinj.GPS] != "gps.jsonl" {
+		t.Fatalf("expected only registered sensor types with an output to be traced, found %v", outputs)
+	}
+
+	e.TraceParameters.Outputs["GPS"] = "data/gps.jsonl"
+	e.TraceParameters.PerRun = true
+	if outputs = e.traceOutputs("run"); outputs[hinj.GPS] != "data/run/gps.jsonl" {
+		t.Fatalf("expected the run's own trace next to the output, found %v", outputs)
+	}
+}
@@ -0,0 +1,100 @@
+package executor
+
+import (
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/obicons/avis/detector"
+	"github.com/obicons/avis/util"
+)
+
+// the number of lines of output a workload's ProgramFault keeps
+const workloadOutputTail = 20
+
+// how long to wait for the rest of a workload's output once it exits; children it started may
+// hold its stdout open for much longer
+const workloadOutputGrace = 500 * time.Millisecond
+
+// A running workload, watched so that a crash ends the run.
+type workload struct {
+	cmd *exec.Cmd
+	// closed once the workload has exited and its output has been collected
+	exited chan struct{}
+
+	lock   sync.Mutex
+	output []string
+	state  *os.ProcessState
+}
+
+// Starts workloadCmd in a shell with env added to the environment.
+// Its log lines begin with logPrefix.
+func startWorkload(workloadCmd string, env []string, logPrefix string) (*workload, error) {
+	log, err := util.GetLogger(logPrefix + "workload ")
+	if err != nil {
+		return nil, err
+	}
+
+	w := &workload{
+		cmd:    exec.Command("sh", "-c", workloadCmd),
+		exited: make(chan struct{}),
+	}
+	w.cmd.Env = append(os.Environ(), env...)
+	outputDone, err := util.WatchProcess(w.cmd, log, w.addOutput)
+	if err != nil {
+		return nil, err
+	} else if err = w.cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		// cmd.Wait would block until every child that shares the output exits
+		state, err := w.cmd.Process.Wait()
+		if err != nil {
+			log.Printf("unable to wait for the workload: %s\n", err)
+		}
+		select {
+		case <-outputDone:
+		case <-time.After(workloadOutputGrace):
+		}
+		w.lock.Lock()
+		w.state = state
+		w.lock.Unlock()
+		close(w.exited)
+	}()
+	return w, nil
+}
+
+// Keeps the last workloadOutputTail lines of output.
+func (w *workload) addOutput(line string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.output = append(w.output, line)
+	if len(w.output) > workloadOutputTail {
+		w.output = w.output[len(w.output)-workloadOutputTail:]
+	}
+}
+
+// Describes how the workload exited. Must only be called once exited is closed.
+func (w *workload) exit() *detector.ProgramExit {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	exit := &detector.ProgramExit{ExitCode: -1, Output: append([]string(nil), w.output...)}
+	if w.state == nil {
+		return exit
+	}
+	exit.ExitCode = w.state.ExitCode()
+	if status, ok := w.state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		exit.Signal = status.Signal().String()
+	}
+	return exit
+}
+
+// Kills the workload, if it is still running, and waits for it to exit.
+func (w *workload) stop() {
+	w.cmd.Process.Kill()
+	<-w.exited
+}
@@ -0,0 +1,26 @@
+package hinj
+
+// Battery packets have no instance or Ignore byte, so the battery is always
+// instance 0 and is corrupted rather than dropped.
+
+// Returns a fault that suddenly drops the reported voltage by volts.
+func BatteryVoltageSag(volts float64) FaultModel {
+	return FaultModel{Kind: FaultBias, Field: "Voltage", Magnitude: -volts}
+}
+
+// Returns a fault that drains an extra voltsPerPacket from the reported
+// voltage with every packet, on top of the simulated discharge.
+func BatteryDrain(voltsPerPacket float64) FaultModel {
+	return FaultModel{Kind: FaultDrift, Field: "Voltage", Magnitude: -voltsPerPacket}
+}
+
+// Returns a fault that holds the current sensor at its reading when the fault begins.
+func BatteryStuckCurrent() FaultModel {
+	return FaultModel{Kind: FaultStuck, Field: "Current"}
+}
+
+// Returns a fault that removes one cell from a pack of cells series cells,
+// stepping the reported voltage down by one cell's share.
+func BatteryCellFailure(cells int) FaultModel {
+	return FaultModel{Kind: FaultScale, Field: "Voltage", Magnitude: float64(cells-1) / float64(cells)}
+}
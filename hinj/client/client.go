@@ -0,0 +1,111 @@
+// Package client speaks the HINJ protocol from the firmware's side.
+// It is used by tests and by the fake autopilot to drive a HINJServer
+// without ArduPilot or PX4.
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/url"
+
+	"github.com/obicons/avis/hinj"
+	"github.com/obicons/avis/util"
+)
+
+// A streaming connection to a HINJ server.
+// A Client is not safe for use by multiple goroutines.
+type Client struct {
+	// the hello the server answered the handshake with
+	ServerHello hinj.Hello
+
+	conn     net.Conn
+	flusher  *bufio.Writer
+	reader   *hinj.HINJReader
+	writer   *hinj.HINJWriter
+	sequence uint32
+}
+
+// Opens a stream to the HINJ server at rawURL and performs the handshake.
+// rawURL is a unix (unix:///path/to.sock) or tcp (tcp://host:port) URL.
+func Dial(rawURL string) (*Client, error) {
+	conn, err := dial(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = conn.Write([]byte{hinj.StreamMagic}); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Dial(): %s", err)
+	}
+	serverHello, err := hinj.ClientHandshake(conn, hinj.LocalHello())
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Dial(): %s", err)
+	}
+
+	flusher := bufio.NewWriter(conn)
+	return &Client{
+		ServerHello: serverHello,
+		conn:        conn,
+		flusher:     flusher,
+		reader:      hinj.NewHINJReader(bufio.NewReader(conn)),
+		writer:      hinj.NewHINJWriter(flusher),
+	}, nil
+}
+
+// Sends msg and returns the server's (possibly altered) reply.
+// msg must be a pointer to a packet.
+func (c *Client) Send(msg interface{}) (interface{}, error) {
+	sequence := c.sequence
+	c.sequence++
+
+	if err := c.writer.WriteStreamMessage(sequence, msg); err != nil {
+		return nil, fmt.Errorf("Client.Send(): %s", err)
+	} else if err := c.flusher.Flush(); err != nil {
+		return nil, fmt.Errorf("Client.Send(): %s", err)
+	}
+
+	replySequence, reply, err := c.reader.ReadStreamMessage()
+	if err != nil {
+		return nil, fmt.Errorf("Client.Send(): %s", err)
+	} else if replySequence != sequence {
+		return nil, fmt.Errorf("Client.Send(): expected a reply to %d, got a reply to %d", sequence, replySequence)
+	}
+	return reply, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Sends msg over a one-shot connection to the HINJ server at rawURL.
+// Returns the server's (possibly altered) reply.
+func SendOneShot(rawURL string, msg interface{}) (interface{}, error) {
+	conn, err := dial(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err = hinj.NewHINJWriter(conn).WriteMessage(msg); err != nil {
+		return nil, fmt.Errorf("SendOneShot(): %s", err)
+	}
+	reply, err := hinj.NewHINJReader(conn).ReadMessage()
+	if err != nil {
+		return nil, fmt.Errorf("SendOneShot(): %s", err)
+	}
+	return reply, nil
+}
+
+func dial(rawURL string) (net.Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	network, address, err := util.URLNetworkAddress(u)
+	if err != nil {
+		return nil, err
+	}
+	return net.Dial(network, address)
+}
@@ -0,0 +1,99 @@
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/obicons/avis/hinj"
+)
+
+// starts a server listening on a fresh unix socket.
+// the returned function shuts the server down and removes the socket.
+func startTestServer(t *testing.T) (*hinj.HINJServer, string, func()) {
+	dir, err := ioutil.TempDir("", "hinj")
+	if err != nil {
+		t.Fatalf("TempDir() returned an unexpected error: %s", err)
+	}
+
+	addr := "unix://" + path.Join(dir, "hinj.sock")
+	server, err := hinj.NewHINJServer(addr)
+	if err != nil {
+		t.Fatalf("NewHINJServer() returned an unexpected error: %s", err)
+	} else if err = server.Start(); err != nil {
+		t.Fatalf("Start() returned an unexpected error: %s", err)
+	}
+
+	return server, addr, func() {
+		server.Shutdown()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestUnitClientSendOneShot(t *testing.T) {
+	server, addr, shutdown := startTestServer(t)
+	defer shutdown()
+
+	server.FailSensor(hinj.Barometer, 2)
+	reply, err := SendOneShot(addr, &hinj.BarometerPacket{Instance: 2, Pressure: 1000})
+	if err != nil {
+		t.Fatalf("SendOneShot() returned an unexpected error: %s", err)
+	} else if baro, ok := reply.(*hinj.BarometerPacket); !ok || baro.Ignore != 1 || baro.Pressure != 1000 {
+		t.Fatalf("unexpected reply: %+v", reply)
+	}
+}
+
+// flies the fake vehicle against a server with a fault injected into one
+// instance of every sensor type, and checks that exactly that instance changed.
+func TestUnitFakeVehicleEndToEnd(t *testing.T) {
+	server, addr, shutdown := startTestServer(t)
+	defer shutdown()
+
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial() returned an unexpected error: %s", err)
+	}
+	defer client.Close()
+	if client.ServerHello.Version != hinj.ProtocolVersion {
+		t.Fatalf("unexpected server hello: %+v", client.ServerHello)
+	}
+
+	vehicle := NewFakeVehicle()
+	for sensorType := range vehicle.Instances {
+		instance := vehicle.Instances[sensorType] - 1
+		if sensorType == hinj.Battery {
+			server.InjectFault(hinj.SensorFailure{SensorType: sensorType, Model: hinj.BatteryVoltageSag(1)})
+		} else {
+			server.FailSensor(sensorType, instance)
+		}
+	}
+
+	const seconds = 2
+	for tick := 0; tick < seconds*TickRate; tick++ {
+		for _, msg := range vehicle.Tick() {
+			if _, err := client.Send(msg); err != nil {
+				t.Fatalf("Send() returned an unexpected error: %s", err)
+			}
+		}
+	}
+
+	stats := server.Stats()
+	if len(stats) == 0 {
+		t.Fatalf("the server recorded no statistics")
+	}
+	for _, instanceStats := range stats {
+		failed := instanceStats.Instance == vehicle.Instances[instanceStats.SensorType]-1
+		expectedPackets := uint64(seconds * TickRate / tickDivisors[instanceStats.SensorType])
+		if instanceStats.Packets != expectedPackets {
+			t.Fatalf("%s %d: expected %d packets, found %d",
+				instanceStats.SensorType, instanceStats.Instance, expectedPackets, instanceStats.Packets)
+		} else if failed && instanceStats.Altered != instanceStats.Packets {
+			t.Fatalf("%s %d: the fault did not alter every packet: %+v",
+				instanceStats.SensorType, instanceStats.Instance, instanceStats)
+		} else if !failed && instanceStats.Altered != 0 {
+			t.Fatalf("%s %d: a healthy instance was altered: %+v",
+				instanceStats.SensorType, instanceStats.Instance, instanceStats)
+		}
+	}
+}
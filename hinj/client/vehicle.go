@@ -0,0 +1,165 @@
+package client
+
+import (
+	"math"
+	"time"
+
+	"github.com/obicons/avis/hinj"
+)
+
+// The fake vehicle flies a level circle at a constant speed and altitude.
+const (
+	homeLatitude    = 40.0
+	homeLongitude   = -83.0
+	circleRadius    = 20.0 // m
+	circleSpeed     = 5.0  // m/s
+	cruiseAltitude  = 250.0
+	standardGravity = 9.80665
+
+	// the rate the IMU is sampled at; slower sensors are multiples of it
+	TickRate = 400
+	tickTime = time.Second / TickRate
+)
+
+// The number of ticks between packets of each sensor type.
+var tickDivisors = map[hinj.Sensor]uint64{
+	hinj.Accelerometer: 1,
+	hinj.Gyroscope:     1,
+	hinj.Quaternion:    1,
+	hinj.Compass:       8,
+	hinj.Barometer:     8,
+	hinj.Battery:       8,
+	hinj.RCInputs:      8,
+	hinj.SensorReading: 8,
+	hinj.GPS:           40,
+}
+
+// Generates the sensor packets a healthy autopilot would send while flying.
+type FakeVehicle struct {
+	// the number of instances of each sensor type
+	Instances map[hinj.Sensor]uint8
+
+	ticks uint64
+}
+
+// Returns a vehicle with three of each sensor, one battery and one RC receiver.
+func NewFakeVehicle() *FakeVehicle {
+	return &FakeVehicle{
+		Instances: map[hinj.Sensor]uint8{
+			hinj.GPS:           3,
+			hinj.Accelerometer: 3,
+			hinj.Gyroscope:     3,
+			hinj.Compass:       3,
+			hinj.Barometer:     3,
+			hinj.Quaternion:    3,
+			hinj.SensorReading: 1,
+			hinj.Battery:       1,
+			hinj.RCInputs:      1,
+		},
+	}
+}
+
+// Advances the vehicle by one tick (1/TickRate seconds).
+// Returns the packets every sensor instance produces during the tick.
+func (v *FakeVehicle) Tick() []interface{} {
+	elapsed := time.Duration(v.ticks) * tickTime
+	var packets []interface{}
+	for _, sensorType := range []hinj.Sensor{
+		hinj.Accelerometer,
+		hinj.Gyroscope,
+		hinj.Quaternion,
+		hinj.Compass,
+		hinj.Barometer,
+		hinj.Battery,
+		hinj.RCInputs,
+		hinj.SensorReading,
+		hinj.GPS,
+	} {
+		if v.ticks%tickDivisors[sensorType] != 0 {
+			continue
+		}
+		for instance := uint8(0); instance < v.Instances[sensorType]; instance++ {
+			packets = append(packets, packet(sensorType, instance, elapsed))
+		}
+	}
+	v.ticks++
+	return packets
+}
+
+// Returns the packet sensorType's instance reports elapsed into the flight.
+func packet(sensorType hinj.Sensor, instance uint8, elapsed time.Duration) interface{} {
+	seconds := elapsed.Seconds()
+	rate := circleSpeed / circleRadius
+	angle := rate * seconds
+	// heading is tangent to the circle, flown clockwise from north
+	heading := math.Mod(angle+math.Pi/2, 2*math.Pi)
+
+	switch sensorType {
+	case hinj.Accelerometer:
+		// centripetal acceleration points toward the circle's center, to the vehicle's right
+		return &hinj.AccelerometerPacket{
+			Instance:      instance,
+			AccelerationY: float32(circleSpeed * rate),
+			AccelerationZ: -standardGravity,
+		}
+	case hinj.Gyroscope:
+		return &hinj.GyroscopePacket{Instance: instance, Z: float32(rate)}
+	case hinj.Quaternion:
+		return &hinj.QuaternionPacket{
+			Instance: instance,
+			W:        float32(math.Cos(heading / 2)),
+			Z:        float32(math.Sin(heading / 2)),
+		}
+	case hinj.Compass:
+		// a 500 mGauss field pointing north and down, seen from the vehicle's heading
+		return &hinj.CompassPacket{
+			Instance: instance,
+			Mag0:     float32(200 * math.Cos(heading)),
+			Mag1:     float32(-200 * math.Sin(heading)),
+			Mag2:     450,
+		}
+	case hinj.Barometer:
+		return &hinj.BarometerPacket{
+			Instance:    instance,
+			Pressure:    float32(101325 * math.Pow(1-2.25577e-5*cruiseAltitude, 5.25588)),
+			Temperature: 20,
+		}
+	case hinj.Battery:
+		return &hinj.BatteryPacket{
+			Voltage:  float32(12.6 - 0.001*seconds),
+			Current:  12,
+			Throttle: 0.5,
+		}
+	case hinj.RCInputs:
+		packet := hinj.RCInputsPacket{Instance: instance, ChannelCount: 8}
+		for i := 0; i < int(packet.ChannelCount); i++ {
+			packet.Channels[i] = 1500
+		}
+		return &packet
+	case hinj.SensorReading:
+		// a downward rangefinder
+		return &hinj.SensorReadingPacket{Instance: instance, Value: float32(cruiseAltitude)}
+	case hinj.GPS:
+		// the circle's center is circleRadius south of home
+		north := circleRadius * (math.Cos(angle) - 1)
+		east := circleRadius * math.Sin(angle)
+		velocityNorth := circleSpeed * math.Cos(heading)
+		velocityEast := circleSpeed * math.Sin(heading)
+		return &hinj.GPSPacket{
+			Instance:          instance,
+			TimeMicroSecond:   uint64(elapsed / time.Microsecond),
+			FixType:           3,
+			Latitude:          int32((homeLatitude + north/111319.5) * 1e7),
+			Longitude:         int32((homeLongitude + east/(111319.5*math.Cos(homeLatitude*math.Pi/180))) * 1e7),
+			Altitude:          int32(cruiseAltitude * 1000),
+			EPH:               80,
+			EPV:               120,
+			Velocity:          uint16(circleSpeed * 100),
+			VelocityNorth:     int16(math.Round(velocityNorth * 100)),
+			VelocityEast:      int16(math.Round(velocityEast * 100)),
+			CourseOverGround:  uint16(math.Round(heading*180/math.Pi*100)) % 36000,
+			SatellitesVisible: 12,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+package hinj
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"time"
+)
+
+/*
+ * The consistency monitor compares the instances of each redundant sensor
+ * as their packets leave the server, i.e. after any fault has been applied.
+ * For every reading it computes the spread: the largest Euclidean distance,
+ * over the compared fields, between the latest readings of any two instances.
+ * When the spread stays above the threshold for a whole window of readings,
+ * an instance has diverged for longer than a voting autopilot should take to
+ * notice, and the monitor records an event.
+ */
+
+// Describes how the instances of a redundant sensor are compared.
+type ConsistencyCheck struct {
+	// the fields compared, in the packet's native units
+	Fields []string
+
+	// the spread above which the instances disagree
+	Threshold float64
+
+	// the number of consecutive readings (of any instance) the instances must
+	// disagree for before an event is raised; an instance that has not reported
+	// within the window is left out of the comparison
+	Window uint64
+}
+
+// Records a period during which the instances of a sensor disagreed.
+type ConsistencyEvent struct {
+	SensorType Sensor
+
+	// the instance furthest from the others, or -1 if only two instances disagreed
+	Outlier int
+
+	// the largest spread seen during the event
+	MaxSpread float64
+
+	// when the instances began to disagree, and when they agreed again.
+	// End is zero if they still disagreed when the run ended.
+	Start          time.Time
+	End            time.Time
+	StartIteration uint64
+	EndIteration   uint64
+}
+
+// The latest reading of one instance.
+type instanceReading struct {
+	values    []float64
+	readingNo uint64
+}
+
+// Tracks the agreement of the instances of one sensor type.
+type sensorConsistency struct {
+	check    ConsistencyCheck
+	readings map[uint8]instanceReading
+	// the number of readings of any instance
+	readingNo uint64
+
+	// when the current run of disagreeing readings began and how long it is
+	disagreeing    uint64
+	onset          time.Time
+	onsetIteration uint64
+	// the index of the open event, or -1
+	open int
+}
+
+type consistencyMonitor struct {
+	sensors map[Sensor]*sensorConsistency
+	events  []ConsistencyEvent
+	// called with the server's lock held whenever an event is raised
+	handler func(ConsistencyEvent)
+}
+
+// Returns the consistency check registered for each sensor type.
+func ConsistencyChecks() map[Sensor]ConsistencyCheck {
+	checks := make(map[Sensor]ConsistencyCheck)
+	for _, packetType := range PacketTypes() {
+		if packetType.Consistency != nil {
+			checks[packetType.ID] = *packetType.Consistency
+		}
+	}
+	return checks
+}
+
+func newConsistencyMonitor(checks map[Sensor]ConsistencyCheck, handler func(ConsistencyEvent)) *consistencyMonitor {
+	monitor := consistencyMonitor{
+		sensors: make(map[Sensor]*sensorConsistency),
+		handler: handler,
+	}
+	for sensorType, check := range checks {
+		monitor.sensors[sensorType] = &sensorConsistency{
+			check:    check,
+			readings: make(map[uint8]instanceReading),
+			open:     -1,
+		}
+	}
+	return &monitor
+}
+
+// Forgets every reading and event, so the next run starts afresh.
+func (m *consistencyMonitor) reset() {
+	m.events = nil
+	for _, sensor := range m.sensors {
+		*sensor = sensorConsistency{
+			check:    sensor.check,
+			readings: make(map[uint8]instanceReading),
+			open:     -1,
+		}
+	}
+}
+
+// Compares msg, which left the server at now, with the other instances of its sensor.
+func (m *consistencyMonitor) observe(msg interface{}, now time.Time, iteration uint64) {
+	sensorType, instance, ok := packetSource(msg)
+	if !ok || m.sensors[sensorType] == nil {
+		return
+	}
+	val := reflect.ValueOf(msg).Elem()
+	if ignore := val.FieldByName("Ignore"); ignore.IsValid() && ignore.Uint() != 0 {
+		// the autopilot discards ignored readings
+		return
+	}
+
+	sensor := m.sensors[sensorType]
+	sensor.readingNo++
+	var values []float64
+	for _, name := range sensor.check.Fields {
+		for _, field := range lookupField(val, name) {
+			values = append(values, getNumeric(field.value))
+		}
+	}
+	sensor.readings[instance] = instanceReading{values: values, readingNo: sensor.readingNo}
+
+	spread, outlier := sensor.spread()
+	if spread <= sensor.check.Threshold {
+		if sensor.open != -1 {
+			m.events[sensor.open].End = now
+			m.events[sensor.open].EndIteration = iteration
+			sensor.open = -1
+		}
+		sensor.disagreeing = 0
+		return
+	}
+
+	if sensor.disagreeing == 0 {
+		sensor.onset, sensor.onsetIteration = now, iteration
+	}
+	sensor.disagreeing++
+	if sensor.open != -1 {
+		event := &m.events[sensor.open]
+		event.MaxSpread = math.Max(event.MaxSpread, spread)
+		event.Outlier = outlier
+	} else if sensor.disagreeing >= sensor.check.Window {
+		sensor.open = len(m.events)
+		m.events = append(m.events, ConsistencyEvent{
+			SensorType:     sensorType,
+			Outlier:        outlier,
+			MaxSpread:      spread,
+			Start:          sensor.onset,
+			StartIteration: sensor.onsetIteration,
+		})
+		if m.handler != nil {
+			m.handler(m.events[sensor.open])
+		}
+	}
+}
+
+// Returns the spread of the instances that reported within the window,
+// and the instance furthest from the others (or -1 if fewer than three reported).
+func (s *sensorConsistency) spread() (float64, int) {
+	var instances []uint8
+	for instance, reading := range s.readings {
+		if s.readingNo-reading.readingNo < s.check.Window {
+			instances = append(instances, instance)
+		}
+	}
+	sort.Slice(instances, func(i, j int) bool { return instances[i] < instances[j] })
+
+	spread, outlier, outlierDistance := 0.0, -1, 0.0
+	for _, instance := range instances {
+		total := 0.0
+		for _, other := range instances {
+			distance := euclidean(s.readings[instance].values, s.readings[other].values)
+			spread = math.Max(spread, distance)
+			total += distance
+		}
+		if len(instances) > 2 && total > outlierDistance {
+			outlier, outlierDistance = int(instance), total
+		}
+	}
+	return spread, outlier
+}
+
+// Returns the Euclidean distance between a and b, which have the same length.
+func euclidean(a, b []float64) float64 {
+	sum := 0.0
+	for i := range a {
+		sum += (a[i] - b[i]) * (a[i] - b[i])
+	}
+	return math.Sqrt(sum)
+}
+
+// Starts comparing the instances of the sensors in checks (see ConsistencyChecks()).
+// handler, if not nil, is called as each event is raised; it must not block
+// or call back into the server.
+// Events are cleared whenever the server starts.
+func (server *HINJServer) MonitorConsistency(checks map[Sensor]ConsistencyCheck, handler func(ConsistencyEvent)) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.consistency = newConsistencyMonitor(checks, handler)
+}
+
+// Stops comparing instances and forgets the monitor's events.
+func (server *HINJServer) StopMonitoringConsistency() {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.consistency = nil
+}
+
+// Returns the events the consistency monitor raised since the server started.
+func (server *HINJServer) ConsistencyEvents() []ConsistencyEvent {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	if server.consistency == nil {
+		return nil
+	}
+	return append([]ConsistencyEvent(nil), server.consistency.events...)
+}
+
+// Compares msg with the other instances of its sensor, if the monitor is on.
+// must be called with server.lock held
+func (server *HINJServer) checkConsistency(msg interface{}) {
+	if server.consistency == nil {
+		return
+	}
+	iteration := uint64(0)
+	if server.iterations != nil {
+		iteration = server.iterations()
+	}
+	server.consistency.observe(msg, time.Now(), iteration)
+}
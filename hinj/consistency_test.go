@@ -0,0 +1,109 @@
+package hinj
+
+import (
+	"testing"
+	"time"
+)
+
+var testBaroCheck = map[Sensor]ConsistencyCheck{
+	Barometer: {Fields: []string{"Pressure"}, Threshold: 10, Window: 6},
+}
+
+// sends one reading from each of three barometers, the last offset by offset
+func observeBarometers(monitor *consistencyMonitor, iteration uint64, offset float32) {
+	for instance := uint8(0); instance < 3; instance++ {
+		msg := &BarometerPacket{Instance: instance, Pressure: 1000}
+		if instance == 2 {
+			msg.Pressure += offset
+		}
+		monitor.observe(msg, time.Unix(int64(iteration), 0), iteration)
+	}
+}
+
+func TestUnitConsistencyMonitorRaisesEvent(t *testing.T) {
+	var raised []ConsistencyEvent
+	monitor := newConsistencyMonitor(testBaroCheck, func(event ConsistencyEvent) { raised = append(raised, event) })
+
+	observeBarometers(monitor, 1, 5)
+	observeBarometers(monitor, 2, 50)
+	if len(raised) != 0 {
+		t.Fatalf("expected no event before the window filled, found %+v", raised)
+	}
+	for iteration := uint64(3); iteration < 6; iteration++ {
+		observeBarometers(monitor, iteration, 50)
+	}
+	if len(raised) != 1 {
+		t.Fatalf("expected one event, found %+v", raised)
+	} else if raised[0].Outlier != 2 || raised[0].StartIteration != 2 || raised[0].MaxSpread != 50 {
+		t.Fatalf("unexpected event: %+v", raised[0])
+	}
+
+	observeBarometers(monitor, 6, 80)
+	observeBarometers(monitor, 7, 0)
+	if len(monitor.events) != 1 {
+		t.Fatalf("expected a single event, found %+v", monitor.events)
+	} else if event := monitor.events[0]; event.MaxSpread != 80 || event.EndIteration != 7 {
+		t.Fatalf("expected the event to end at iteration 7 with a spread of 80, found %+v", event)
+	}
+}
+
+func TestUnitConsistencyMonitorIgnoresBriefAndIgnoredDisagreement(t *testing.T) {
+	monitor := newConsistencyMonitor(testBaroCheck, nil)
+	for iteration := uint64(0); iteration < 10; iteration++ {
+		// a spike every other round never fills the window
+		observeBarometers(monitor, iteration, float32(iteration%2)*100)
+		// the autopilot discards ignored readings, so they never disagree
+		monitor.observe(&BarometerPacket{Instance: 1, Ignore: 1, Pressure: 0}, time.Now(), iteration)
+	}
+	if len(monitor.events) != 0 {
+		t.Fatalf("expected no events, found %+v", monitor.events)
+	}
+}
+
+func TestUnitConsistencyMonitorDropsSilentInstances(t *testing.T) {
+	monitor := newConsistencyMonitor(testBaroCheck, nil)
+	observeBarometers(monitor, 0, 100)
+	// instance 2 falls silent, and its last reading ages out of the window
+	for i := uint64(0); i < 10; i++ {
+		monitor.observe(&BarometerPacket{Instance: uint8(i % 2), Pressure: 1000}, time.Now(), i)
+	}
+	if spread, _ := monitor.sensors[Barometer].spread(); spread != 0 {
+		t.Fatalf("expected the silent instance to be left out, found a spread of %f", spread)
+	}
+}
+
+func TestUnitServerConsistencyEvents(t *testing.T) {
+	server, shutdown := startTestServer(t)
+	defer shutdown()
+
+	server.MonitorConsistency(testBaroCheck, nil)
+	server.InjectFault(SensorFailure{SensorType: Barometer, Instance: 0, Model: FaultModel{Kind: FaultBias, Magnitude: 500}})
+	for i := 0; i < 4; i++ {
+		sendOneShot(t, server, &BarometerPacket{Instance: 0, Pressure: 100000})
+		sendOneShot(t, server, &BarometerPacket{Instance: 1, Pressure: 100000})
+	}
+
+	events := server.ConsistencyEvents()
+	if len(events) != 1 || events[0].SensorType != Barometer || events[0].MaxSpread != 500 {
+		t.Fatalf("expected one barometer event, found %+v", events)
+	} else if events[0].Outlier != -1 {
+		t.Fatalf("expected no outlier between two instances, found %d", events[0].Outlier)
+	}
+
+	server.StopMonitoringConsistency()
+	if events := server.ConsistencyEvents(); events != nil {
+		t.Fatalf("expected no events once the monitor stopped, found %+v", events)
+	}
+}
+
+func TestUnitRegisteredConsistencyChecks(t *testing.T) {
+	checks := ConsistencyChecks()
+	for _, sensorType := range []Sensor{GPS, Accelerometer, Gyroscope, Compass, Barometer} {
+		if check, ok := checks[sensorType]; !ok || check.Threshold <= 0 || check.Window == 0 {
+			t.Fatalf("expected a consistency check for %s, found %+v", sensorType, check)
+		}
+	}
+	if _, ok := checks[Battery]; ok {
+		t.Fatalf("expected no consistency check for the battery")
+	}
+}
@@ -1,28 +1,50 @@
 package hinj
 
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
 type Sensor uint8
 
 const (
-	GPS           Sensor = iota
-	SensorReading        // currently unused
-	RCInputs             // currently unused
-	Quaternion           // currently unused
+	GPS Sensor = iota
+	SensorReading
+	RCInputs
+	Quaternion
 	Accelerometer
 	Gyroscope
 	Battery
 	Compass
 	Barometer
 	Mode
+
+	// never registered; returned alongside errors
 	BadType
 )
 
 const (
 	msgPreambleSize = 5
+
+	// size of a streamed message's preamble: type, size and sequence number
+	streamPreambleSize = 9
+
+	// sent as the first byte of a connection to open a stream
+	StreamMagic = 0xFF
 )
 
+// The byte order of every multi-byte value HINJ sends or receives, including
+// packet fields, preambles, the handshake and trace files. Firmware running on
+// a big-endian target must swap its values, whatever machine avis runs on.
+// It is part of the protocol, so it is not exported for anyone to change.
+var wireByteOrder = binary.LittleEndian
+
 type SensorFailure struct {
 	SensorType Sensor
 	Instance   uint8
+	Model      FaultModel
 }
 
 type GPSPacket struct {
@@ -80,6 +102,65 @@ type CompassPacket struct {
 	Mag2     float32
 }
 
+// Number of channels carried by an RCInputsPacket.
+const RCChannels = 16
+
+type RCInputsPacket struct {
+	Instance     uint8
+	Ignore       uint8
+	ChannelCount uint8
+	// PWM pulse widths, in microseconds
+	Channels [RCChannels]uint16
+}
+
+type QuaternionPacket struct {
+	Instance uint8
+	Ignore   uint8
+	W        float32
+	X        float32
+	Y        float32
+	Z        float32
+}
+
+// A reading from a sensor without a dedicated packet type (e.g. a rangefinder).
+// Kind identifies the sensor to the firmware; avis does not interpret it.
+type SensorReadingPacket struct {
+	Instance uint8
+	Ignore   uint8
+	Kind     uint8
+	Value    float32
+}
+
 type ModePacket struct {
 	Mode uint32
 }
+
+// Returns the name the sensor type was registered with.
+func (s Sensor) String() string {
+	if packetType, ok := LookupPacketType(s); ok {
+		return packetType.Name
+	}
+	return "unknown"
+}
+
+// Returns the sensor type with the given name (e.g. "Barometer"), ignoring case.
+func ParseSensor(name string) (Sensor, error) {
+	for _, packetType := range PacketTypes() {
+		if strings.EqualFold(packetType.Name, name) {
+			return packetType.ID, nil
+		}
+	}
+	return BadType, fmt.Errorf("ParseSensor(): unknown sensor type %s", name)
+}
+
+// Returns the sensor type and instance that produced msg.
+// ok is false if msg is not a sensor packet.
+func packetSource(msg interface{}) (sensorType Sensor, instance uint8, ok bool) {
+	packetType, ok := packetTypeOf(msg)
+	if !ok || !packetType.IsSensor {
+		return BadType, 0, false
+	} else if packetType.hasInstance {
+		instance = uint8(reflect.ValueOf(msg).Elem().FieldByName("Instance").Uint())
+	}
+	return packetType.ID, instance, true
+}
@@ -0,0 +1,266 @@
+package hinj
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"strings"
+)
+
+// The kind of corruption applied to the packets of a failed sensor.
+type FaultKind uint8
+
+const (
+	// Marks every reading as ignored (the sensor disappears).
+	FaultIgnore FaultKind = iota
+	// Adds Magnitude to each affected field.
+	FaultBias
+	// Adds Magnitude * (packets since onset) to each affected field.
+	FaultDrift
+	// Adds zero-mean Gaussian noise with standard deviation Magnitude.
+	FaultNoise
+	// Holds each affected field at the value it had when the fault began.
+	FaultStuck
+	// Multiplies each affected field by Magnitude.
+	FaultScale
+	// Sets each affected field to Magnitude.
+	FaultSet
+	// Drags GPS fixes away at Magnitude m/s toward Bearing (see gps.go).
+	FaultSpoof
+	// Replays GPS fixes delayed by Magnitude seconds (see gps.go).
+	FaultMeaconing
+	// Delivers each packet Magnitude iterations late (see timing.go).
+	FaultDelay
+	// Drops each packet with probability Magnitude (see timing.go).
+	FaultDrop
+	// Delivers packets out of order from a window of Magnitude packets (see timing.go).
+	FaultReorder
+
+	// the number of fault kinds; must remain last
+	faultKindCount
+)
+
+// Describes how a failed sensor's packets are rewritten.
+// The zero value is FaultIgnore, which matches the original failure behavior.
+type FaultModel struct {
+	Kind FaultKind
+
+	// Name of the packet field to corrupt (e.g. "AccelerationX").
+	// Array fields may be indexed (e.g. "Channels[2]"); otherwise every element is corrupted.
+	// If empty, every measurement field of the packet is corrupted.
+	Field string
+
+	// Bias offset, drift per packet, noise standard deviation, gain or set value.
+	// Measured in the packet's native units.
+	// For FaultSpoof, the horizontal drag rate in m/s; for FaultMeaconing, the delay in seconds.
+	// For FaultDelay, the delay in iterations; for FaultDrop, the drop probability;
+	// for FaultReorder, the window size in packets.
+	Magnitude float64
+
+	// For FaultSpoof: the direction of the drag in degrees clockwise from north,
+	// and the rate the reported altitude climbs in m/s.
+	Bearing float64
+	Climb   float64
+
+	// Seeds the random number generator used by FaultNoise, FaultDrop and FaultReorder.
+	Seed int64
+}
+
+// A numeric value inside a packet, and the name used to remember it.
+type packetValue struct {
+	key   string
+	value reflect.Value
+}
+
+// Tracks an active fault on one sensor instance.
+type faultState struct {
+	model   FaultModel
+	packets uint64
+	rand    *rand.Rand
+	held    map[string]float64
+
+	// the GPS time of the first spoofed fix, and the fixes a meaconer has captured
+	spoofOnset uint64
+	history    []GPSPacket
+
+	// the current simulator iteration, if the server knows it
+	iteration     uint64
+	haveIteration bool
+	// packets held back by a timing fault, and the last packet let through
+	pending       []heldPacket
+	lastDelivered interface{}
+}
+
+func newFaultState(model FaultModel) *faultState {
+	return &faultState{
+		model: model,
+		rand:  rand.New(rand.NewSource(model.Seed)),
+	}
+}
+
+// Rewrites msg according to the fault model.
+// msg must be a pointer to a packet produced by sensorType.
+func (f *faultState) apply(sensorType Sensor, msg interface{}) {
+	val := reflect.Indirect(reflect.ValueOf(msg))
+	if f.model.Kind == FaultIgnore {
+		if ignore := val.FieldByName("Ignore"); ignore.IsValid() {
+			ignore.SetUint(1)
+		}
+		return
+	} else if f.model.Kind == FaultSpoof || f.model.Kind == FaultMeaconing {
+		if gps, ok := msg.(*GPSPacket); ok {
+			f.applyGPS(gps)
+		}
+		return
+	} else if f.model.Kind == FaultDelay || f.model.Kind == FaultDrop || f.model.Kind == FaultReorder {
+		f.applyTiming(msg)
+		return
+	}
+
+	f.packets++
+	for _, name := range f.fields(sensorType) {
+		for _, field := range lookupField(val, name) {
+			setNumeric(field.value, f.corrupt(field.key, getNumeric(field.value)))
+		}
+	}
+}
+
+// Returns the numeric values of packet named by name.
+// name is a field name, optionally indexed (e.g. "Channels[2]").
+// An unindexed array names every element.
+func lookupField(packet reflect.Value, name string) []packetValue {
+	index := -1
+	if open := strings.Index(name, "["); open != -1 && strings.HasSuffix(name, "]") {
+		if _, err := fmt.Sscanf(name[open:], "[%d]", &index); err != nil || index < 0 {
+			return nil
+		}
+		name = name[:open]
+	}
+
+	field := packet.FieldByName(name)
+	if !field.IsValid() {
+		return nil
+	} else if field.Kind() != reflect.Array {
+		if index != -1 {
+			return nil
+		}
+		return []packetValue{{key: name, value: field}}
+	} else if index != -1 {
+		if index >= field.Len() {
+			return nil
+		}
+		return []packetValue{{key: fmt.Sprintf("%s[%d]", name, index), value: field.Index(index)}}
+	}
+
+	values := make([]packetValue, field.Len())
+	for i := range values {
+		values[i] = packetValue{key: fmt.Sprintf("%s[%d]", name, i), value: field.Index(i)}
+	}
+	return values
+}
+
+// Returns the names of the fields this fault corrupts.
+func (f *faultState) fields(sensorType Sensor) []string {
+	if f.model.Field != "" {
+		return []string{f.model.Field}
+	}
+	if packetType, ok := LookupPacketType(sensorType); ok {
+		return packetType.MeasurementFields
+	}
+	return nil
+}
+
+// Returns the corrupted value of the named field.
+func (f *faultState) corrupt(name string, value float64) float64 {
+	switch f.model.Kind {
+	case FaultBias:
+		return value + f.model.Magnitude
+	case FaultDrift:
+		return value + f.model.Magnitude*float64(f.packets)
+	case FaultNoise:
+		return value + f.rand.NormFloat64()*f.model.Magnitude
+	case FaultStuck:
+		if f.held == nil {
+			f.held = make(map[string]float64)
+		}
+		if held, ok := f.held[name]; ok {
+			return held
+		}
+		f.held[name] = value
+		return value
+	case FaultScale:
+		return value * f.model.Magnitude
+	case FaultSet:
+		return f.model.Magnitude
+	}
+	return value
+}
+
+// Returns the value of a numeric field as a float64.
+func getNumeric(field reflect.Value) float64 {
+	switch field.Kind() {
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(field.Int())
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(field.Uint())
+	case reflect.Float32, reflect.Float64:
+		return field.Float()
+	}
+	return 0
+}
+
+// Stores value into a numeric field, rounding and saturating for integers.
+func setNumeric(field reflect.Value, value float64) {
+	bits := float64(field.Type().Bits())
+	switch field.Kind() {
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		limit := math.Pow(2, bits-1)
+		field.SetInt(int64(math.Max(-limit, math.Min(limit-1, math.Round(value)))))
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		limit := math.Pow(2, bits)
+		field.SetUint(uint64(math.Max(0, math.Min(limit-1, math.Round(value)))))
+	case reflect.Float32, reflect.Float64:
+		field.SetFloat(value)
+	}
+}
+
+// Returns the fault kind with the given name (e.g. "bias").
+func ParseFaultKind(name string) (FaultKind, error) {
+	for kind := FaultIgnore; kind < faultKindCount; kind++ {
+		if kind.String() == strings.ToLower(name) {
+			return kind, nil
+		}
+	}
+	return FaultIgnore, fmt.Errorf("ParseFaultKind(): unknown fault kind %s", name)
+}
+
+func (k FaultKind) String() string {
+	switch k {
+	case FaultIgnore:
+		return "ignore"
+	case FaultBias:
+		return "bias"
+	case FaultDrift:
+		return "drift"
+	case FaultNoise:
+		return "noise"
+	case FaultStuck:
+		return "stuck"
+	case FaultScale:
+		return "scale"
+	case FaultSet:
+		return "set"
+	case FaultSpoof:
+		return "spoof"
+	case FaultMeaconing:
+		return "meaconing"
+	case FaultDelay:
+		return "delay"
+	case FaultDrop:
+		return "drop"
+	case FaultReorder:
+		return "reorder"
+	}
+	return "unknown"
+}
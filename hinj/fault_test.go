@@ -0,0 +1,364 @@
+package hinj
+
+import (
+	"math"
+	"testing"
+)
+
+func TestUnitFaultIgnore(t *testing.T) {
+	gps := GPSPacket{Instance: 1, Latitude: 42}
+	newFaultState(FaultModel{}).apply(GPS, &gps)
+	if gps.Ignore != 1 {
+		t.Fatalf("expected Ignore = 1, found %d", gps.Ignore)
+	} else if gps.Latitude != 42 {
+		t.Fatalf("FaultIgnore modified Latitude: %d", gps.Latitude)
+	}
+}
+
+func TestUnitFaultBias(t *testing.T) {
+	accel := AccelerometerPacket{AccelerationX: 1, AccelerationY: 2, AccelerationZ: 3}
+	newFaultState(FaultModel{Kind: FaultBias, Magnitude: 0.5}).apply(Accelerometer, &accel)
+	if accel.Ignore != 0 {
+		t.Fatalf("FaultBias set Ignore")
+	} else if accel.AccelerationX != 1.5 || accel.AccelerationY != 2.5 || accel.AccelerationZ != 3.5 {
+		t.Fatalf("unexpected biased packet: %+v", accel)
+	}
+}
+
+func TestUnitFaultBiasSingleField(t *testing.T) {
+	gyro := GyroscopePacket{X: 1, Y: 1, Z: 1}
+	newFaultState(FaultModel{Kind: FaultBias, Field: "Y", Magnitude: 1}).apply(Gyroscope, &gyro)
+	if gyro.X != 1 || gyro.Y != 2 || gyro.Z != 1 {
+		t.Fatalf("unexpected biased packet: %+v", gyro)
+	}
+}
+
+func TestUnitFaultDrift(t *testing.T) {
+	fault := newFaultState(FaultModel{Kind: FaultDrift, Magnitude: 10})
+	for i := 1; i <= 3; i++ {
+		baro := BarometerPacket{Pressure: 100}
+		fault.apply(Barometer, &baro)
+		if expected := float32(100 + 10*i); baro.Pressure != expected {
+			t.Fatalf("packet %d: expected Pressure = %f, found %f", i, expected, baro.Pressure)
+		}
+	}
+}
+
+func TestUnitFaultNoiseIsSeeded(t *testing.T) {
+	model := FaultModel{Kind: FaultNoise, Magnitude: 1, Seed: 7}
+	first, second := newFaultState(model), newFaultState(model)
+	for i := 0; i < 10; i++ {
+		a, b := CompassPacket{Mag0: 1}, CompassPacket{Mag0: 1}
+		first.apply(Compass, &a)
+		second.apply(Compass, &b)
+		if a != b {
+			t.Fatalf("noise with the same seed diverged: %+v vs %+v", a, b)
+		}
+	}
+}
+
+func TestUnitFaultStuck(t *testing.T) {
+	fault := newFaultState(FaultModel{Kind: FaultStuck})
+	first := GPSPacket{Latitude: 10, Longitude: 20, SatellitesVisible: 5}
+	fault.apply(GPS, &first)
+	second := GPSPacket{Latitude: 11, Longitude: 21, SatellitesVisible: 6}
+	fault.apply(GPS, &second)
+	if second.Latitude != 10 || second.Longitude != 20 {
+		t.Fatalf("FaultStuck did not hold the first values: %+v", second)
+	} else if second.SatellitesVisible != 6 {
+		t.Fatalf("FaultStuck modified a non-measurement field")
+	}
+}
+
+func TestUnitFaultScaleSaturates(t *testing.T) {
+	gps := GPSPacket{VelocityNorth: math.MaxInt16 / 2, VelocityEast: -100}
+	newFaultState(FaultModel{Kind: FaultScale, Magnitude: 4}).apply(GPS, &gps)
+	if gps.VelocityNorth != math.MaxInt16 {
+		t.Fatalf("expected VelocityNorth to saturate, found %d", gps.VelocityNorth)
+	} else if gps.VelocityEast != -400 {
+		t.Fatalf("expected VelocityEast = -400, found %d", gps.VelocityEast)
+	}
+}
+
+func TestUnitCheckAndFailMatchesInstance(t *testing.T) {
+	server, err := NewHINJServer("unix:///tmp/unused.sock")
+	if err != nil {
+		t.Fatalf("NewHINJServer() returned an unexpected error: %s", err)
+	}
+	server.InjectFault(SensorFailure{
+		SensorType: Accelerometer,
+		Instance:   1,
+		Model:      FaultModel{Kind: FaultBias, Magnitude: 1},
+	})
+
+	healthy := AccelerometerPacket{Instance: 0, AccelerationX: 1}
+	server.checkAndFail(&healthy)
+	if healthy.AccelerationX != 1 {
+		t.Fatalf("checkAndFail() modified the wrong instance")
+	}
+
+	failed := AccelerometerPacket{Instance: 1, AccelerationX: 1}
+	server.checkAndFail(&failed)
+	if failed.AccelerationX != 2 {
+		t.Fatalf("checkAndFail() did not modify the failed instance")
+	}
+}
+
+func TestUnitParseFaultKind(t *testing.T) {
+	kind, err := ParseFaultKind("Drift")
+	if err != nil {
+		t.Fatalf("ParseFaultKind() returned an unexpected error: %s", err)
+	} else if kind != FaultDrift {
+		t.Fatalf("expected FaultDrift, found %s", kind)
+	}
+	if _, err := ParseFaultKind("melt"); err == nil {
+		t.Fatalf("expected ParseFaultKind() to reject an unknown kind")
+	}
+}
+
+func TestUnitRestoreSensor(t *testing.T) {
+	server, err := NewHINJServer("unix:///tmp/unused.sock")
+	if err != nil {
+		t.Fatalf("NewHINJServer() returned an unexpected error: %s", err)
+	}
+	server.FailSensor(GPS, 0)
+	server.RestoreSensor(GPS, 0)
+
+	gps := GPSPacket{Instance: 0}
+	server.checkAndFail(&gps)
+	if gps.Ignore != 0 {
+		t.Fatalf("checkAndFail() failed a restored sensor")
+	}
+
+	server.FailSensor(GPS, 0)
+	server.checkAndFail(&gps)
+	if gps.Ignore != 1 {
+		t.Fatalf("checkAndFail() did not fail a sensor that was failed again")
+	}
+}
+
+func TestUnitBatteryFaults(t *testing.T) {
+	sag := BatteryPacket{Voltage: 12.6, Current: 10}
+	newFaultState(BatteryVoltageSag(1)).apply(Battery, &sag)
+	if math.Abs(float64(sag.Voltage)-11.6) > 1e-5 || sag.Current != 10 {
+		t.Fatalf("unexpected sagged battery: %+v", sag)
+	}
+
+	drain := newFaultState(BatteryDrain(0.5))
+	for i := 1; i <= 2; i++ {
+		battery := BatteryPacket{Voltage: 12}
+		drain.apply(Battery, &battery)
+		if expected := float32(12 - 0.5*float64(i)); battery.Voltage != expected {
+			t.Fatalf("expected drained voltage %f, found %f", expected, battery.Voltage)
+		}
+	}
+
+	stuck := newFaultState(BatteryStuckCurrent())
+	first, second := BatteryPacket{Current: 5, Voltage: 12}, BatteryPacket{Current: 20, Voltage: 11}
+	stuck.apply(Battery, &first)
+	stuck.apply(Battery, &second)
+	if second.Current != 5 || second.Voltage != 11 {
+		t.Fatalf("unexpected battery with a stuck current sensor: %+v", second)
+	}
+
+	cell := BatteryPacket{Voltage: 12}
+	newFaultState(BatteryCellFailure(3)).apply(Battery, &cell)
+	if cell.Voltage != 8 {
+		t.Fatalf("expected one of three cells to fail, found voltage %f", cell.Voltage)
+	}
+}
+
+func TestUnitCheckAndFailBattery(t *testing.T) {
+	server, err := NewHINJServer("unix:///tmp/unused.sock")
+	if err != nil {
+		t.Fatalf("NewHINJServer() returned an unexpected error: %s", err)
+	}
+	server.InjectFault(SensorFailure{SensorType: Battery, Model: BatteryVoltageSag(2)})
+
+	battery := BatteryPacket{Voltage: 12}
+	server.checkAndFail(&battery)
+	if battery.Voltage != 10 {
+		t.Fatalf("checkAndFail() did not sag the battery: %+v", battery)
+	}
+}
+
+func TestUnitRCFaults(t *testing.T) {
+	freeze := newFaultState(RCStickFreeze())
+	first := RCInputsPacket{Channels: [RCChannels]uint16{1500, 1500, 1100, 1500}}
+	freeze.apply(RCInputs, &first)
+	second := RCInputsPacket{Channels: [RCChannels]uint16{1900, 1200, 1800, 1500}}
+	freeze.apply(RCInputs, &second)
+	if second.Channels != first.Channels {
+		t.Fatalf("sticks did not freeze: %v", second.Channels)
+	}
+
+	lost := RCInputsPacket{Channels: [RCChannels]uint16{1500, 1500, 1100, 1500}}
+	newFaultState(RCChannelLoss(2)).apply(RCInputs, &lost)
+	if lost.Channels[2] != 0 || lost.Channels[1] != 1500 {
+		t.Fatalf("unexpected channels after losing channel 2: %v", lost.Channels)
+	}
+
+	wild := RCInputsPacket{}
+	newFaultState(RCOutOfRange(0, 2500)).apply(RCInputs, &wild)
+	if wild.Channels[0] != 2500 {
+		t.Fatalf("expected channel 0 = 2500, found %d", wild.Channels[0])
+	}
+
+	bad := RCInputsPacket{Channels: [RCChannels]uint16{1500}}
+	newFaultState(RCOutOfRange(RCChannels, 2500)).apply(RCInputs, &bad)
+	if bad.Channels[0] != 1500 {
+		t.Fatalf("an out of bounds channel modified the packet")
+	}
+}
+
+func TestUnitCheckAndFailNewPacketTypes(t *testing.T) {
+	server, err := NewHINJServer("unix:///tmp/unused.sock")
+	if err != nil {
+		t.Fatalf("NewHINJServer() returned an unexpected error: %s", err)
+	}
+	server.FailSensor(RCInputs, 0)
+	server.FailSensor(Quaternion, 1)
+	server.FailSensor(SensorReading, 0)
+
+	rc, quaternion, reading := RCInputsPacket{}, QuaternionPacket{Instance: 1}, SensorReadingPacket{}
+	server.checkAndFail(&rc)
+	server.checkAndFail(&quaternion)
+	server.checkAndFail(&reading)
+	if rc.Ignore != 1 || quaternion.Ignore != 1 || reading.Ignore != 1 {
+		t.Fatalf("checkAndFail() did not fail every new packet type")
+	}
+}
+
+func TestUnitGPSSpoof(t *testing.T) {
+	spoof := newFaultState(GPSSpoof(10, 90, 1))
+	first := GPSPacket{TimeMicroSecond: 5e6, Latitude: 400000000, Longitude: -800000000, Altitude: 100000}
+	spoof.apply(GPS, &first)
+	if first.Latitude != 400000000 || first.Longitude != -800000000 || first.Altitude != 100000 {
+		t.Fatalf("the spoofer moved the position at onset: %+v", first)
+	} else if first.VelocityEast != 1000 || first.VelocityDown != -100 {
+		t.Fatalf("unexpected spoofed velocity at onset: %+v", first)
+	}
+
+	// 10 seconds later, the fix is 100 m east and 10 m higher
+	later := GPSPacket{TimeMicroSecond: 15e6, Latitude: 400000000, Longitude: -800000000, Altitude: 100000}
+	spoof.apply(GPS, &later)
+	if later.Latitude != 400000000 {
+		t.Fatalf("an eastward spoof changed the latitude: %d", later.Latitude)
+	}
+	expectedLongitude := -800000000 + 100/(earthRadiusMeters*math.Cos(40*math.Pi/180))*180/math.Pi*1e7
+	if math.Abs(float64(later.Longitude)-expectedLongitude) > 1 {
+		t.Fatalf("expected longitude %f, found %d", expectedLongitude, later.Longitude)
+	} else if later.Altitude != 110000 {
+		t.Fatalf("expected altitude 110000 mm, found %d", later.Altitude)
+	} else if later.Velocity != 1000 || later.CourseOverGround != 9000 {
+		t.Fatalf("the ground track disagrees with the velocity: %+v", later)
+	}
+}
+
+func TestUnitGPSMeaconing(t *testing.T) {
+	meacon := newFaultState(GPSMeaconing(2))
+	for second := uint64(0); second < 5; second++ {
+		gps := GPSPacket{Instance: 1, TimeMicroSecond: second * 1e6, Latitude: int32(second)}
+		meacon.apply(GPS, &gps)
+
+		expected := int32(0)
+		if second >= 2 {
+			expected = int32(second - 2)
+		}
+		if gps.Latitude != expected {
+			t.Fatalf("second %d: expected the fix from second %d, found %d", second, expected, gps.Latitude)
+		} else if gps.TimeMicroSecond != second*1e6 || gps.Instance != 1 {
+			t.Fatalf("second %d: the replayed fix lost its timestamp or instance: %+v", second, gps)
+		}
+	}
+}
+
+func TestUnitPacketDelay(t *testing.T) {
+	delay := newFaultState(PacketDelay(2))
+	for iteration := uint64(0); iteration < 6; iteration++ {
+		baro := BarometerPacket{Pressure: float32(iteration)}
+		delay.setIteration(iteration)
+		delay.apply(Barometer, &baro)
+		if iteration < 2 && baro.Ignore != 1 {
+			t.Fatalf("iteration %d: a packet arrived before the delay elapsed: %+v", iteration, baro)
+		} else if iteration >= 2 && (baro.Ignore != 0 || baro.Pressure != float32(iteration-2)) {
+			t.Fatalf("iteration %d: expected the packet from iteration %d, found %+v", iteration, iteration-2, baro)
+		}
+	}
+}
+
+func TestUnitPacketDelayLosesNothing(t *testing.T) {
+	// two packets per iteration, so two are due at once
+	delay := newFaultState(PacketDelay(1))
+	var delivered []float32
+	for i := 0; i < 8; i++ {
+		baro := BarometerPacket{Pressure: float32(i)}
+		delay.setIteration(uint64(i / 2))
+		delay.apply(Barometer, &baro)
+		if baro.Ignore == 0 {
+			delivered = append(delivered, baro.Pressure)
+		}
+	}
+	for i, pressure := range delivered {
+		if pressure != float32(i) {
+			t.Fatalf("expected every packet in order, found %v", delivered)
+		}
+	}
+	if len(delivered) != 6 {
+		t.Fatalf("expected all but the last iteration's packets, found %v", delivered)
+	}
+}
+
+func TestUnitPacketDelayWithoutIgnore(t *testing.T) {
+	delay := newFaultState(PacketDelay(1))
+	first, second := BatteryPacket{Voltage: 12}, BatteryPacket{Voltage: 11}
+	delay.apply(Battery, &first)
+	delay.apply(Battery, &second)
+	if second.Voltage != 12 {
+		t.Fatalf("expected the delayed battery packet, found %+v", second)
+	}
+}
+
+func TestUnitPacketDropIsSeeded(t *testing.T) {
+	first, second := newFaultState(PacketDrop(0.5, 3)), newFaultState(PacketDrop(0.5, 3))
+	dropped := 0
+	for i := 0; i < 1000; i++ {
+		a, b := GyroscopePacket{X: float32(i)}, GyroscopePacket{X: float32(i)}
+		first.apply(Gyroscope, &a)
+		second.apply(Gyroscope, &b)
+		if a != b {
+			t.Fatalf("drops with the same seed diverged: %+v vs %+v", a, b)
+		} else if a.Ignore == 1 {
+			dropped++
+		}
+	}
+	if dropped < 400 || dropped > 600 {
+		t.Fatalf("expected about half of the packets to drop, found %d of 1000", dropped)
+	}
+}
+
+func TestUnitPacketReorder(t *testing.T) {
+	reorder := newFaultState(PacketReorder(3, 1))
+	seen := make(map[float32]bool)
+	inOrder := true
+	last := float32(-1)
+	for i := 0; i < 100; i++ {
+		accel := AccelerometerPacket{AccelerationX: float32(i)}
+		reorder.apply(Accelerometer, &accel)
+		if accel.Ignore == 1 {
+			continue
+		} else if seen[accel.AccelerationX] {
+			t.Fatalf("packet %f was delivered twice", accel.AccelerationX)
+		}
+		seen[accel.AccelerationX] = true
+		if accel.AccelerationX < last {
+			inOrder = false
+		}
+		last = accel.AccelerationX
+	}
+	if inOrder {
+		t.Fatalf("every packet was delivered in order")
+	} else if len(seen) != 98 {
+		t.Fatalf("expected all but the 2 packets still in the window to be delivered, found %d", len(seen))
+	}
+}
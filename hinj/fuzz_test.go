@@ -0,0 +1,95 @@
+package hinj
+
+import (
+	"bytes"
+	"testing"
+)
+
+// seeds a fuzz target with a well-formed encoding of every packet type
+func addSeedMessages(f *testing.F, preambleSize int) {
+	for _, packetType := range PacketTypes() {
+		encoded, err := encodeMessage(packetType.New(), preambleSize)
+		if err != nil {
+			f.Fatalf("encodeMessage() returned an unexpected error: %s", err)
+		}
+		f.Add(encoded)
+	}
+}
+
+// Checks that msg survives being encoded and decoded again.
+// Signaling NaNs may be quieted on the first decode, so msg itself must be decoded.
+func checkRoundTrip(t *testing.T, msg interface{}) {
+	sensorType, encoded, err := encodePayload(msg)
+	if err != nil {
+		t.Fatalf("encodePayload() rejected a decoded message: %s", err)
+	}
+	decoded, err := decodeMessage(sensorType, encoded)
+	if err != nil {
+		t.Fatalf("decodeMessage() rejected an encoded message: %s", err)
+	}
+	_, reencoded, _ := encodePayload(decoded)
+	if !bytes.Equal(encoded, reencoded) {
+		t.Fatalf("%s message %x re-encoded as %x", sensorType, encoded, reencoded)
+	}
+}
+
+// ReadMessage() must never panic, and anything it accepts must round trip.
+func FuzzReadMessage(f *testing.F) {
+	addSeedMessages(f, msgPreambleSize)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		msg, err := NewHINJReader(bytes.NewReader(data)).ReadMessage()
+		if err != nil {
+			return
+		}
+		checkRoundTrip(t, msg)
+	})
+}
+
+// ReadStreamMessage() must never panic or loop forever, whatever the stream holds.
+func FuzzReadStreamMessage(f *testing.F) {
+	addSeedMessages(f, streamPreambleSize)
+	f.Add([]byte{StreamMagic, 0, 0, 0, 0})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		reader := NewHINJReader(bytes.NewReader(data))
+		for i := 0; i <= len(data); i++ {
+			if _, _, err := reader.ReadStreamMessage(); err != nil {
+				return
+			}
+		}
+		t.Fatalf("read more messages than there are bytes in the stream")
+	})
+}
+
+// Any payload of the right size decodes, and the packet it decodes to can be
+// written and read back over a stream.
+func FuzzWriteMessage(f *testing.F) {
+	f.Add(uint8(GPS), uint32(7), bytes.Repeat([]byte{0x5A}, 64))
+	f.Add(uint8(RCInputs), uint32(0), bytes.Repeat([]byte{0xFF}, 64))
+	f.Fuzz(func(t *testing.T, typeByte uint8, seq uint32, data []byte) {
+		packetTypes := PacketTypes()
+		packetType := packetTypes[int(typeByte)%len(packetTypes)]
+		sensorType, size := packetType.ID, packetType.Size()
+		if len(data) < size {
+			return
+		}
+
+		msg, err := decodeMessage(sensorType, data[:size])
+		if err != nil {
+			t.Fatalf("decodeMessage() rejected a %s payload of the right size: %s", sensorType, err)
+		}
+		checkRoundTrip(t, msg)
+
+		var stream bytes.Buffer
+		if err := NewHINJWriter(&stream).WriteStreamMessage(seq, msg); err != nil {
+			t.Fatalf("WriteStreamMessage() returned an unexpected error: %s", err)
+		}
+		readSeq, readMsg, err := NewHINJReader(&stream).ReadStreamMessage()
+		if err != nil {
+			t.Fatalf("ReadStreamMessage() could not read a written %s message: %s", sensorType, err)
+		} else if readSeq != seq {
+			t.Fatalf("expected sequence number %d, found %d", seq, readSeq)
+		} else if readType, _ := MessageType(readMsg); readType != sensorType {
+			t.Fatalf("wrote a %s message, read a %s message", sensorType, readType)
+		}
+	})
+}
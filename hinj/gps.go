@@ -0,0 +1,108 @@
+package hinj
+
+import (
+	"math"
+	"reflect"
+)
+
+// GPS attacks rewrite whole fixes rather than single fields, so that the
+// position, velocity and course stay consistent with one another and the
+// autopilot cannot reject them with a simple cross-check.
+// Units follow GPSPacket: latitude and longitude in degE7, altitude in mm,
+// velocities in cm/s (VelocityDown is positive down) and course in cdeg.
+
+const earthRadiusMeters = 6378137.0
+
+// Returns a spoofing attack that drags the reported position away at
+// metersPerSecond toward bearingDegrees (clockwise from north), while the
+// reported altitude climbs at climbMetersPerSecond.
+func GPSSpoof(metersPerSecond, bearingDegrees, climbMetersPerSecond float64) FaultModel {
+	return FaultModel{Kind: FaultSpoof, Magnitude: metersPerSecond, Bearing: bearingDegrees, Climb: climbMetersPerSecond}
+}
+
+// Returns a meaconing attack that rebroadcasts the fixes from delaySeconds ago.
+// Replayed fixes carry the current timestamp, as a receiver would report them.
+func GPSMeaconing(delaySeconds float64) FaultModel {
+	return FaultModel{Kind: FaultMeaconing, Magnitude: delaySeconds}
+}
+
+func (f *faultState) applyGPS(gps *GPSPacket) {
+	if f.model.Kind == FaultSpoof {
+		f.spoof(gps)
+	} else {
+		f.meacon(gps)
+	}
+}
+
+// Offsets gps along the spoofed trajectory.
+func (f *faultState) spoof(gps *GPSPacket) {
+	if f.packets == 0 {
+		f.spoofOnset = gps.TimeMicroSecond
+	}
+	f.packets++
+
+	elapsed := 0.0
+	if gps.TimeMicroSecond > f.spoofOnset {
+		elapsed = float64(gps.TimeMicroSecond-f.spoofOnset) / 1e6
+	}
+
+	bearing := f.model.Bearing * math.Pi / 180
+	northRate := f.model.Magnitude * math.Cos(bearing)
+	eastRate := f.model.Magnitude * math.Sin(bearing)
+
+	// offset the position by how far the spoofer has dragged it so far
+	latitude := float64(gps.Latitude) / 1e7 * math.Pi / 180
+	dLatitude := northRate * elapsed / earthRadiusMeters
+	dLongitude := eastRate * elapsed / (earthRadiusMeters * math.Max(math.Cos(latitude), 1e-6))
+	setGPSField(gps, "Latitude", float64(gps.Latitude)+dLatitude*180/math.Pi*1e7)
+	setGPSField(gps, "Longitude", float64(gps.Longitude)+dLongitude*180/math.Pi*1e7)
+	setGPSField(gps, "Altitude", float64(gps.Altitude)+f.model.Climb*elapsed*1000)
+
+	// the reported velocity must agree with the drag
+	setGPSField(gps, "VelocityNorth", float64(gps.VelocityNorth)+northRate*100)
+	setGPSField(gps, "VelocityEast", float64(gps.VelocityEast)+eastRate*100)
+	setGPSField(gps, "VelocityDown", float64(gps.VelocityDown)-f.model.Climb*100)
+	updateGroundTrack(gps)
+}
+
+// Replaces gps with the newest captured fix that is at least the delay old.
+func (f *faultState) meacon(gps *GPSPacket) {
+	f.history = append(f.history, *gps)
+
+	delay := uint64(f.model.Magnitude * 1e6)
+	replay := 0
+	for i := range f.history {
+		if f.history[i].TimeMicroSecond+delay > gps.TimeMicroSecond {
+			break
+		}
+		replay = i
+	}
+
+	// older fixes can never be replayed again
+	f.history = f.history[replay:]
+
+	replayed := f.history[0]
+	replayed.Instance = gps.Instance
+	replayed.Ignore = gps.Ignore
+	replayed.TimeMicroSecond = gps.TimeMicroSecond
+	*gps = replayed
+}
+
+// Recomputes the ground speed and course over ground from the NED velocities.
+func updateGroundTrack(gps *GPSPacket) {
+	north, east := float64(gps.VelocityNorth), float64(gps.VelocityEast)
+	setGPSField(gps, "Velocity", math.Hypot(north, east))
+	if north == 0 && east == 0 {
+		return
+	}
+	course := math.Atan2(east, north) * 180 / math.Pi
+	if course < 0 {
+		course += 360
+	}
+	setGPSField(gps, "CourseOverGround", math.Mod(course*100, 36000))
+}
+
+// Stores value into the named field, rounding and saturating.
+func setGPSField(gps *GPSPacket, name string, value float64) {
+	setNumeric(reflect.ValueOf(gps).Elem().FieldByName(name), value)
+}
@@ -0,0 +1,172 @@
+package hinj
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+/*
+ * Every stream opens with a handshake so that a firmware build that has
+ * drifted from avis is refused up front instead of silently misparsing.
+ *
+ * After StreamMagic, the client sends a hello:
+ *   version (2 bytes) | count (1 byte) | count * (type (1 byte) | packed size (4 bytes))
+ * The server answers with its own hello, then a status byte. If the status
+ * is handshakeRefused, it is followed by a 2-byte length and a message
+ * explaining why, and the server hangs up.
+ */
+
+// The version of the HINJ protocol spoken by this package.
+// Bump it whenever the wire format changes.
+const ProtocolVersion uint16 = 1
+
+const (
+	handshakeAccepted = 0
+	handshakeRefused  = 1
+)
+
+type Hello struct {
+	Version uint16
+	// the packed size of each packet type the peer sends
+	PacketSizes map[Sensor]uint32
+}
+
+// Returns the hello describing this build of avis.
+func LocalHello() Hello {
+	hello := Hello{Version: ProtocolVersion, PacketSizes: make(map[Sensor]uint32)}
+	for _, packetType := range PacketTypes() {
+		hello.PacketSizes[packetType.ID] = uint32(packetType.Size())
+	}
+	return hello
+}
+
+// Returns an error describing why a peer sending peer cannot talk to local.
+func CheckCompatible(local, peer Hello) error {
+	if local.Version != peer.Version {
+		return fmt.Errorf("protocol version mismatch: avis speaks %d, peer speaks %d", local.Version, peer.Version)
+	}
+
+	for _, sensorType := range sortedTypes(peer.PacketSizes) {
+		localSize, ok := local.PacketSizes[sensorType]
+		if !ok {
+			return fmt.Errorf("peer sends packet type %d (%s), which avis does not support", sensorType, sensorType)
+		} else if peerSize := peer.PacketSizes[sensorType]; peerSize != localSize {
+			return fmt.Errorf(
+				"packet type %d (%s) is %d bytes on the peer but %d bytes in avis",
+				sensorType,
+				sensorType,
+				peerSize,
+				localSize,
+			)
+		}
+	}
+	return nil
+}
+
+func WriteHello(writer io.Writer, hello Hello) error {
+	types := sortedTypes(hello.PacketSizes)
+	if len(types) > 255 {
+		return fmt.Errorf("WriteHello(): too many packet types: %d", len(types))
+	}
+
+	bytes := make([]byte, 3+5*len(types))
+	wireByteOrder.PutUint16(bytes[0:2], hello.Version)
+	bytes[2] = byte(len(types))
+	for i, sensorType := range types {
+		entry := bytes[3+5*i:]
+		entry[0] = byte(sensorType)
+		wireByteOrder.PutUint32(entry[1:5], hello.PacketSizes[sensorType])
+	}
+
+	_, err := writer.Write(bytes)
+	return err
+}
+
+func ReadHello(reader io.Reader) (Hello, error) {
+	var header [3]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		return Hello{}, fmt.Errorf("ReadHello(): %s", err)
+	}
+
+	hello := Hello{
+		Version:     wireByteOrder.Uint16(header[0:2]),
+		PacketSizes: make(map[Sensor]uint32),
+	}
+	entries := make([]byte, 5*int(header[2]))
+	if _, err := io.ReadFull(reader, entries); err != nil {
+		return Hello{}, fmt.Errorf("ReadHello(): %s", err)
+	}
+	for i := 0; i < len(entries); i += 5 {
+		hello.PacketSizes[Sensor(entries[i])] = wireByteOrder.Uint32(entries[i+1 : i+5])
+	}
+	return hello, nil
+}
+
+// Performs the client's half of the handshake on a freshly opened stream.
+// Returns the server's hello, or an error if the server refused us.
+func ClientHandshake(conn io.ReadWriter, hello Hello) (Hello, error) {
+	if err := WriteHello(conn, hello); err != nil {
+		return Hello{}, err
+	}
+
+	serverHello, err := ReadHello(conn)
+	if err != nil {
+		return Hello{}, err
+	}
+
+	var status [1]byte
+	if _, err := io.ReadFull(conn, status[:]); err != nil {
+		return serverHello, fmt.Errorf("ClientHandshake(): reading status: %s", err)
+	} else if status[0] == handshakeAccepted {
+		return serverHello, nil
+	}
+
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return serverHello, fmt.Errorf("ClientHandshake(): reading refusal: %s", err)
+	}
+	explanation := make([]byte, wireByteOrder.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, explanation); err != nil {
+		return serverHello, fmt.Errorf("ClientHandshake(): reading refusal: %s", err)
+	}
+	return serverHello, fmt.Errorf("HINJ server refused the connection: %s", explanation)
+}
+
+// Performs the server's half of the handshake.
+// Returns the client's hello, or an error if the client is incompatible.
+func serverHandshake(reader io.Reader, writer io.Writer) (Hello, error) {
+	clientHello, err := ReadHello(reader)
+	if err != nil {
+		return Hello{}, err
+	}
+
+	local := LocalHello()
+	if err := WriteHello(writer, local); err != nil {
+		return clientHello, err
+	}
+
+	incompatible := CheckCompatible(local, clientHello)
+	if incompatible == nil {
+		_, err = writer.Write([]byte{handshakeAccepted})
+		return clientHello, err
+	}
+
+	explanation := []byte(incompatible.Error())
+	reply := make([]byte, 3+len(explanation))
+	reply[0] = handshakeRefused
+	wireByteOrder.PutUint16(reply[1:3], uint16(len(explanation)))
+	copy(reply[3:], explanation)
+	writer.Write(reply)
+	return clientHello, incompatible
+}
+
+// Returns the types in sizes in ascending order.
+func sortedTypes(sizes map[Sensor]uint32) []Sensor {
+	types := make([]Sensor, 0, len(sizes))
+	for sensorType := range sizes {
+		types = append(types, sensorType)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
@@ -0,0 +1,99 @@
+package hinj
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestUnitHelloRoundTrip(t *testing.T) {
+	var buffer bytes.Buffer
+	local := LocalHello()
+	if err := WriteHello(&buffer, local); err != nil {
+		t.Fatalf("WriteHello() returned an unexpected error: %s", err)
+	}
+	hello, err := ReadHello(&buffer)
+	if err != nil {
+		t.Fatalf("ReadHello() returned an unexpected error: %s", err)
+	} else if hello.Version != local.Version || len(hello.PacketSizes) != len(local.PacketSizes) {
+		t.Fatalf("expected %+v, found %+v", local, hello)
+	}
+	for sensorType, size := range local.PacketSizes {
+		if hello.PacketSizes[sensorType] != size {
+			t.Fatalf("%s: expected size %d, found %d", sensorType, size, hello.PacketSizes[sensorType])
+		}
+	}
+}
+
+func TestUnitCheckCompatible(t *testing.T) {
+	local := LocalHello()
+	if err := CheckCompatible(local, local); err != nil {
+		t.Fatalf("CheckCompatible() refused an identical peer: %s", err)
+	}
+
+	// a peer may send a subset of the packet types
+	subset := Hello{Version: ProtocolVersion, PacketSizes: map[Sensor]uint32{GPS: local.PacketSizes[GPS]}}
+	if err := CheckCompatible(local, subset); err != nil {
+		t.Fatalf("CheckCompatible() refused a peer sending a subset: %s", err)
+	}
+
+	oldVersion := Hello{Version: ProtocolVersion + 1}
+	if err := CheckCompatible(local, oldVersion); err == nil {
+		t.Fatalf("CheckCompatible() accepted a mismatched version")
+	}
+
+	drifted := Hello{Version: ProtocolVersion, PacketSizes: map[Sensor]uint32{GPS: local.PacketSizes[GPS] + 4}}
+	if err := CheckCompatible(local, drifted); err == nil || !strings.Contains(err.Error(), "GPS") {
+		t.Fatalf("expected CheckCompatible() to name the drifted packet, found %v", err)
+	}
+
+	unknown := Hello{Version: ProtocolVersion, PacketSizes: map[Sensor]uint32{BadType: 1}}
+	if err := CheckCompatible(local, unknown); err == nil {
+		t.Fatalf("CheckCompatible() accepted an unknown packet type")
+	}
+}
+
+func TestUnitServerRefusesIncompatibleStream(t *testing.T) {
+	server, shutdown := startTestServer(t)
+	defer shutdown()
+
+	conn, err := net.Dial(server.Addr.Network(), server.Addr.String())
+	if err != nil {
+		t.Fatalf("Dial() returned an unexpected error: %s", err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte{StreamMagic})
+	hello := LocalHello()
+	hello.PacketSizes[Accelerometer]++
+	if _, err := ClientHandshake(conn, hello); err == nil {
+		t.Fatalf("the server accepted a stream with a drifted packet")
+	} else if !strings.Contains(err.Error(), "Accelerometer") {
+		t.Fatalf("the refusal did not name the drifted packet: %s", err)
+	}
+}
+
+func TestUnitServerRejectsUnannouncedPackets(t *testing.T) {
+	server, shutdown := startTestServer(t)
+	defer shutdown()
+
+	conn, err := net.Dial(server.Addr.Network(), server.Addr.String())
+	if err != nil {
+		t.Fatalf("Dial() returned an unexpected error: %s", err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte{StreamMagic})
+	hello := Hello{Version: ProtocolVersion, PacketSizes: map[Sensor]uint32{GPS: LocalHello().PacketSizes[GPS]}}
+	if _, err := ClientHandshake(conn, hello); err != nil {
+		t.Fatalf("ClientHandshake() returned an unexpected error: %s", err)
+	}
+
+	if err := NewHINJWriter(conn).WriteStreamMessage(0, &BarometerPacket{}); err != nil {
+		t.Fatalf("WriteStreamMessage() returned an unexpected error: %s", err)
+	}
+	if _, _, err := NewHINJReader(conn).ReadStreamMessage(); err == nil {
+		t.Fatalf("the server answered a packet type the client did not announce")
+	}
+}
@@ -0,0 +1,55 @@
+package hinj
+
+import "time"
+
+// A sensor packet as the server sent it back, after any fault, rule or replay was applied.
+type Observation struct {
+	// the simulator's iteration, if the server has an iteration source
+	Iteration  uint64
+	Time       time.Time
+	SensorType Sensor
+	Instance   uint8
+	// set if an injected fault or a rule changed the packet
+	Faulted bool
+	// a copy of the packet, e.g. *GPSPacket; observers may keep it
+	Packet interface{}
+}
+
+// Passes every sensor packet the server sends back to observer, in the order they are sent.
+// observer runs with the server's lock held, so it must be quick and must not call the server.
+func (server *HINJServer) ObservePackets(observer func(Observation)) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.observer = observer
+}
+
+// Stops passing packets to the observer.
+func (server *HINJServer) StopObservingPackets() {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.observer = nil
+}
+
+// Passes msg to the observer, if there is one.
+// must be called with server.lock held
+func (server *HINJServer) observe(msg interface{}, faulted bool) {
+	if server.observer == nil {
+		return
+	}
+	sensorType, instance, ok := packetSource(msg)
+	if !ok {
+		return
+	}
+
+	observation := Observation{
+		Time:       time.Now(),
+		SensorType: sensorType,
+		Instance:   instance,
+		Faulted:    faulted,
+		Packet:     copyPacket(msg),
+	}
+	if server.iterations != nil {
+		observation.Iteration = server.iterations()
+	}
+	server.observer(observation)
+}
@@ -0,0 +1,28 @@
+package hinj
+
+import "testing"
+
+func TestUnitServerObservePackets(t *testing.T) {
+	server, shutdown := startTestServer(t)
+	defer shutdown()
+
+	var observations []Observation
+	server.SetIterationSource(func() uint64 { return 7 })
+	server.ObservePackets(func(observation Observation) { observations = append(observations, observation) })
+	server.InjectFault(SensorFailure{SensorType: Barometer, Instance: 1, Model: FaultModel{Kind: FaultBias, Magnitude: 1}})
+	sendOneShot(t, server, &BarometerPacket{Instance: 0, Pressure: 100})
+	sendOneShot(t, server, &BarometerPacket{Instance: 1, Pressure: 100})
+
+	server.StopObservingPackets()
+	sendOneShot(t, server, &BarometerPacket{Instance: 0, Pressure: 100})
+
+	if len(observations) != 2 {
+		t.Fatalf("expected 2 observations, found %+v", observations)
+	}
+	healthy, failed := observations[0], observations[1]
+	if healthy.Instance != 0 || healthy.Faulted || healthy.Iteration != 7 || healthy.SensorType != Barometer {
+		t.Fatalf("unexpected observation of the healthy barometer: %+v", healthy)
+	} else if packet := failed.Packet.(*BarometerPacket); !failed.Faulted || packet.Pressure == 100 {
+		t.Fatalf("expected the observer to see the faulted packet, found %+v", failed)
+	}
+}
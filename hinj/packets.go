@@ -0,0 +1,153 @@
+package hinj
+
+// Registers the packet types built into HINJ.
+// Instance counts and fault magnitudes describe the vehicles we test (see cmd/avis).
+func init() {
+	MustRegisterPacketType(PacketType{
+		ID:                GPS,
+		Name:              "GPS",
+		Packet:            &GPSPacket{},
+		IsSensor:          true,
+		MeasurementFields: []string{"Latitude", "Longitude", "Altitude", "VelocityNorth", "VelocityEast", "VelocityDown"},
+		Instances:         3,
+		Explore:           true,
+		FaultMagnitudes: map[FaultKind]float64{
+			FaultBias:    500,
+			FaultDrift:   5,
+			FaultNoise:   200,
+			FaultScale:   1.5,
+			FaultDelay:   200,
+			FaultDrop:    0.5,
+			FaultReorder: 3,
+		},
+		// ~10 m of horizontal disagreement for about two seconds of fixes
+		Consistency: &ConsistencyCheck{Fields: []string{"Latitude", "Longitude"}, Threshold: 1000, Window: 30},
+	})
+	MustRegisterPacketType(PacketType{
+		ID:                SensorReading,
+		Name:              "SensorReading",
+		Packet:            &SensorReadingPacket{},
+		IsSensor:          true,
+		MeasurementFields: []string{"Value"},
+	})
+	MustRegisterPacketType(PacketType{
+		ID:                RCInputs,
+		Name:              "RCInputs",
+		Packet:            &RCInputsPacket{},
+		IsSensor:          true,
+		MeasurementFields: []string{"Channels"},
+		Instances:         1,
+		Faults: []FaultModel{
+			{Kind: FaultIgnore},
+			RCStickFreeze(),
+			// channel 2 is the throttle
+			RCChannelLoss(2),
+			RCOutOfRange(2, 2500),
+		},
+	})
+	MustRegisterPacketType(PacketType{
+		ID:                Quaternion,
+		Name:              "Quaternion",
+		Packet:            &QuaternionPacket{},
+		IsSensor:          true,
+		MeasurementFields: []string{"W", "X", "Y", "Z"},
+	})
+	MustRegisterPacketType(PacketType{
+		ID:                Accelerometer,
+		Name:              "Accelerometer",
+		Packet:            &AccelerometerPacket{},
+		IsSensor:          true,
+		MeasurementFields: []string{"AccelerationX", "AccelerationY", "AccelerationZ"},
+		Instances:         3,
+		Explore:           true,
+		FaultMagnitudes: map[FaultKind]float64{
+			FaultBias:    0.5,
+			FaultDrift:   0.001,
+			FaultNoise:   1,
+			FaultScale:   1.5,
+			FaultDelay:   5,
+			FaultDrop:    0.2,
+			FaultReorder: 4,
+		},
+		// about a second at the IMU rate
+		Consistency: &ConsistencyCheck{Fields: []string{"AccelerationX", "AccelerationY", "AccelerationZ"}, Threshold: 1, Window: 1200},
+	})
+	MustRegisterPacketType(PacketType{
+		ID:                Gyroscope,
+		Name:              "Gyroscope",
+		Packet:            &GyroscopePacket{},
+		IsSensor:          true,
+		MeasurementFields: []string{"X", "Y", "Z"},
+		Instances:         3,
+		Explore:           true,
+		FaultMagnitudes: map[FaultKind]float64{
+			FaultBias:    0.05,
+			FaultDrift:   0.0001,
+			FaultNoise:   0.1,
+			FaultScale:   1.5,
+			FaultDelay:   5,
+			FaultDrop:    0.2,
+			FaultReorder: 4,
+		},
+		Consistency: &ConsistencyCheck{Fields: []string{"X", "Y", "Z"}, Threshold: 0.1, Window: 1200},
+	})
+	MustRegisterPacketType(PacketType{
+		ID:                Battery,
+		Name:              "Battery",
+		Packet:            &BatteryPacket{},
+		IsSensor:          true,
+		MeasurementFields: []string{"Voltage", "Current"},
+		Instances:         1,
+		Faults: []FaultModel{
+			BatteryVoltageSag(1.0),
+			BatteryDrain(0.001),
+			BatteryStuckCurrent(),
+			BatteryCellFailure(3),
+		},
+	})
+	MustRegisterPacketType(PacketType{
+		ID:                Compass,
+		Name:              "Compass",
+		Packet:            &CompassPacket{},
+		IsSensor:          true,
+		MeasurementFields: []string{"Mag0", "Mag1", "Mag2"},
+		Instances:         3,
+		Explore:           true,
+		FaultMagnitudes: map[FaultKind]float64{
+			FaultBias:    100,
+			FaultDrift:   0.1,
+			FaultNoise:   50,
+			FaultScale:   1.5,
+			FaultDelay:   50,
+			FaultDrop:    0.5,
+			FaultReorder: 3,
+		},
+		Consistency: &ConsistencyCheck{Fields: []string{"Mag0", "Mag1", "Mag2"}, Threshold: 150, Window: 300},
+	})
+	MustRegisterPacketType(PacketType{
+		ID:                Barometer,
+		Name:              "Barometer",
+		Packet:            &BarometerPacket{},
+		IsSensor:          true,
+		MeasurementFields: []string{"Pressure"},
+		Instances:         3,
+		Explore:           true,
+		FaultMagnitudes: map[FaultKind]float64{
+			FaultBias:  50,
+			FaultDrift: 0.05,
+			FaultNoise: 20,
+			FaultScale: 1.5,
+			// a slow I2C barometer lags far behind the IMU
+			FaultDelay:   100,
+			FaultDrop:    0.5,
+			FaultReorder: 3,
+		},
+		// ~8 m of altitude
+		Consistency: &ConsistencyCheck{Fields: []string{"Pressure"}, Threshold: 100, Window: 150},
+	})
+	MustRegisterPacketType(PacketType{
+		ID:     Mode,
+		Name:   "Mode",
+		Packet: &ModePacket{},
+	})
+}
@@ -0,0 +1,24 @@
+package hinj
+
+import "fmt"
+
+// Returns a fault that freezes every stick at its position when the fault begins.
+func RCStickFreeze() FaultModel {
+	return FaultModel{Kind: FaultStuck, Field: "Channels"}
+}
+
+// Returns a fault that drops the given channel (indexed from 0), as if its
+// wire came loose and the receiver reported no pulse.
+func RCChannelLoss(channel int) FaultModel {
+	return FaultModel{Kind: FaultSet, Field: rcChannelField(channel), Magnitude: 0}
+}
+
+// Returns a fault that reports pwm microseconds on the given channel.
+// Values outside of roughly 900-2100 are out of range for most receivers.
+func RCOutOfRange(channel int, pwm uint16) FaultModel {
+	return FaultModel{Kind: FaultSet, Field: rcChannelField(channel), Magnitude: float64(pwm)}
+}
+
+func rcChannelField(channel int) string {
+	return fmt.Sprintf("Channels[%d]", channel)
+}
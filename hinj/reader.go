@@ -9,8 +9,15 @@ import (
 
 type HINJReader struct {
 	reader io.Reader
+
+	// bytes discarded while resynchronizing a stream
+	skipped uint64
 }
 
+// A stream gives up resynchronizing after discarding this many bytes.
+const maxResyncBytes = 1 << 16
+
+// Reads a message sent over a one-shot connection.
 func (h *HINJReader) ReadMessage() (interface{}, error) {
 	sensorType, err := h.readMessageType()
 	if err != nil {
@@ -22,70 +29,101 @@ func (h *HINJReader) ReadMessage() (interface{}, error) {
 		return nil, err
 	}
 
-	msgBytes := make([]byte, msgSize)
-	count, err := h.reader.Read(msgBytes)
+	payloadSize, err := checkMessageSize(sensorType, msgSize, msgPreambleSize)
 	if err != nil {
-		return nil, err
-	} else if count != int(msgSize-msgPreambleSize) {
-		return nil, fmt.Errorf("ReadMessage(): bad Read() of length %d for type %d", count, sensorType)
+		return nil, fmt.Errorf("ReadMessage(): %s", err)
 	}
 
-	switch sensorType {
-	case GPS:
-		gpsPacket := GPSPacket{}
-		if err := util.ReadPackedStruct(msgBytes, &gpsPacket); err != nil {
-			return nil, fmt.Errorf("ReadMessage(): reading GPS: %s\n", err)
-		}
-		return &gpsPacket, nil
-	case Accelerometer:
-		accelerometerPacket := AccelerometerPacket{}
-		if err := util.ReadPackedStruct(msgBytes, &accelerometerPacket); err != nil {
-			return nil, fmt.Errorf("ReadMessage(): reading accelerometer: %s\n", err)
-		}
-		return &accelerometerPacket, nil
-	case Gyroscope:
-		gyroPacket := GyroscopePacket{}
-		if err := util.ReadPackedStruct(msgBytes, &gyroPacket); err != nil {
-			return nil, fmt.Errorf("ReadMessage(): reading gyro: %s\n", err)
-		}
-		return &gyroPacket, nil
-	case Battery:
-		batteryPacket := BatteryPacket{}
-		if err := util.ReadPackedStruct(msgBytes, &batteryPacket); err != nil {
-			return nil, fmt.Errorf("ReadMessage(): reading battery: %s\n", err)
-		}
-		return &batteryPacket, nil
-	case Barometer:
-		barometerPacket := BarometerPacket{}
-		if err := util.ReadPackedStruct(msgBytes, &barometerPacket); err != nil {
-			return nil, fmt.Errorf("ReadMessage(): reading barometer: %s\n", err)
-		}
-		return &barometerPacket, nil
-	case Mode:
-		modePacket := ModePacket{}
-		if err := util.ReadPackedStruct(msgBytes, &modePacket); err != nil {
-			return nil, fmt.Errorf("ReadMessage(): reading mode: %s\n", err)
+	msgBytes := make([]byte, payloadSize)
+	if _, err := io.ReadFull(h.reader, msgBytes); err != nil {
+		return nil, fmt.Errorf("ReadMessage(): reading %s: %s", sensorType, err)
+	}
+
+	return decodeMessage(sensorType, msgBytes)
+}
+
+// Reads a message sent over a stream.
+// Returns the message's sequence number along with the message.
+// If a frame is corrupt, the reader discards bytes until it finds the next
+// plausible frame (see SkippedBytes()).
+func (h *HINJReader) ReadStreamMessage() (uint32, interface{}, error) {
+	var preamble [streamPreambleSize]byte
+	if _, err := io.ReadFull(h.reader, preamble[:]); err != nil {
+		return 0, nil, err
+	}
+
+	skipped := 0
+	for !validStreamPreamble(preamble) {
+		if skipped == maxResyncBytes {
+			return 0, nil, fmt.Errorf("ReadStreamMessage(): no valid frame in %d bytes", skipped)
 		}
-		return &modePacket, nil
-	case Compass:
-		compassPacket := CompassPacket{}
-		if err := util.ReadPackedStruct(msgBytes, &compassPacket); err != nil {
-			return nil, fmt.Errorf("ReadMessage(): reading compass: %s\n", err)
+
+		// slide the preamble forward by one byte
+		copy(preamble[:], preamble[1:])
+		if _, err := io.ReadFull(h.reader, preamble[streamPreambleSize-1:]); err != nil {
+			return 0, nil, fmt.Errorf("ReadStreamMessage(): resynchronizing: %s", err)
 		}
-		return &compassPacket, nil
-	default:
-		return nil, fmt.Errorf("ReadMessage(): unsupported type: %d", sensorType)
+		skipped++
+		h.skipped++
+	}
+
+	sensorType := Sensor(preamble[0])
+	msgSize := wireByteOrder.Uint32(preamble[1:5])
+	seq := wireByteOrder.Uint32(preamble[5:9])
+	msgBytes := make([]byte, msgSize-streamPreambleSize)
+	if _, err := io.ReadFull(h.reader, msgBytes); err != nil {
+		return seq, nil, fmt.Errorf("ReadStreamMessage(): reading %s: %s", sensorType, err)
 	}
+
+	msg, err := decodeMessage(sensorType, msgBytes)
+	return seq, msg, err
+}
+
+// Returns the number of bytes discarded while resynchronizing a stream.
+func (h *HINJReader) SkippedBytes() uint64 {
+	return h.skipped
+}
+
+// Returns whether preamble starts a frame: a known type and that type's exact size.
+func validStreamPreamble(preamble [streamPreambleSize]byte) bool {
+	_, err := checkMessageSize(Sensor(preamble[0]), wireByteOrder.Uint32(preamble[1:5]), streamPreambleSize)
+	return err == nil
+}
+
+// Checks that msgSize is the size of a message of sensorType after a preamble of preambleSize bytes.
+// Returns the size of the message's payload.
+func checkMessageSize(sensorType Sensor, msgSize uint32, preambleSize int) (int, error) {
+	packetType, ok := LookupPacketType(sensorType)
+	if !ok {
+		return 0, fmt.Errorf("unknown type %d", sensorType)
+	}
+	payloadSize := packetType.Size()
+	if uint64(msgSize) != uint64(payloadSize+preambleSize) {
+		return 0, fmt.Errorf("%s message has size %d, expected %d", sensorType, msgSize, payloadSize+preambleSize)
+	}
+	return payloadSize, nil
+}
+
+// Decodes the body of a message of the given type.
+func decodeMessage(sensorType Sensor, msgBytes []byte) (interface{}, error) {
+	if _, err := checkMessageSize(sensorType, uint32(len(msgBytes)), 0); err != nil {
+		return nil, fmt.Errorf("ReadMessage(): %s", err)
+	}
+
+	// checkMessageSize() only accepts registered types
+	packetType, _ := LookupPacketType(sensorType)
+	packet := packetType.New()
+	if err := util.ReadPackedStruct(msgBytes, packet, wireByteOrder); err != nil {
+		return nil, fmt.Errorf("ReadMessage(): reading %s: %s", sensorType, err)
+	}
+	return packet, nil
 }
 
 func (h *HINJReader) readMessageType() (Sensor, error) {
 	var typeByte [1]byte
-	count, err := h.reader.Read(typeByte[:])
-	if err != nil {
+	if _, err := io.ReadFull(h.reader, typeByte[:]); err != nil {
 		return BadType, fmt.Errorf("readMessageType(): %s", err)
-	} else if count != len(typeByte) {
-		return BadType, fmt.Errorf("readMessageType(): could not read a complete type")
-	} else if typeByte[0] > uint8(Mode) {
+	} else if _, ok := LookupPacketType(Sensor(typeByte[0])); !ok {
 		return BadType, fmt.Errorf("readMessageType(): unknown type")
 	}
 	return Sensor(typeByte[0]), nil
@@ -93,13 +131,10 @@ func (h *HINJReader) readMessageType() (Sensor, error) {
 
 func (h *HINJReader) readMessageSize() (uint32, error) {
 	var sizeBytes [4]byte
-	count, err := h.reader.Read(sizeBytes[:])
-	if err != nil {
+	if _, err := io.ReadFull(h.reader, sizeBytes[:]); err != nil {
 		return 0, fmt.Errorf("readMessageSize(): %s", err)
-	} else if count != len(sizeBytes) {
-		return 0, fmt.Errorf("readMessageSize(): could not read a complete size")
 	}
-	return util.HostByteOrder.Uint32(sizeBytes[:]), nil
+	return wireByteOrder.Uint32(sizeBytes[:]), nil
 }
 
 func NewHINJReader(reader io.Reader) *HINJReader {
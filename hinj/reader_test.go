@@ -2,7 +2,9 @@ package hinj
 
 import (
 	"bytes"
+	"io"
 	"testing"
+	"testing/iotest"
 
 	"github.com/obicons/avis/util"
 )
@@ -153,7 +155,7 @@ func TestUnitReadMessageTypeUnknown(t *testing.T) {
 func TestUnitReadMessageSizeNormal(t *testing.T) {
 	var msgSizeBytes [4]byte
 	expectedMsgSize := uint32(16)
-	util.HostByteOrder.PutUint32(msgSizeBytes[:], expectedMsgSize)
+	wireByteOrder.PutUint32(msgSizeBytes[:], expectedMsgSize)
 	buffer := bytes.NewBuffer(msgSizeBytes[:])
 	hinjReader := NewHINJReader(buffer)
 	actualMsgSize, err := hinjReader.readMessageSize()
@@ -167,7 +169,7 @@ func TestUnitReadMessageSizeNormal(t *testing.T) {
 func TestUnitReadMessageSizeError(t *testing.T) {
 	var msgSizeBytes [4]byte
 	expectedMsgSize := uint32(16)
-	util.HostByteOrder.PutUint32(msgSizeBytes[:], expectedMsgSize)
+	wireByteOrder.PutUint32(msgSizeBytes[:], expectedMsgSize)
 	buffer := bytes.NewBuffer(msgSizeBytes[0:2])
 	hinjReader := NewHINJReader(buffer)
 	_, err := hinjReader.readMessageSize()
@@ -181,8 +183,8 @@ func TestUnitReadMessageGPS(t *testing.T) {
 	size, _ := util.PackedStructSize(&gps)
 	msgBytes := make([]byte, msgPreambleSize+size)
 	msgBytes[0] = byte(GPS)
-	util.HostByteOrder.PutUint32(msgBytes[1:5], uint32(size+msgPreambleSize))
-	util.PackedStructToBytes(msgBytes[5:], &gps)
+	wireByteOrder.PutUint32(msgBytes[1:5], uint32(size+msgPreambleSize))
+	util.PackedStructToBytes(msgBytes[5:], &gps, wireByteOrder)
 	buffer := bytes.NewBuffer(msgBytes)
 	reader := NewHINJReader(buffer)
 	gpsInterface, err := reader.ReadMessage()
@@ -201,8 +203,8 @@ func TestUnitReadMessageAccelerometer(t *testing.T) {
 	size, _ := util.PackedStructSize(&accel)
 	msgBytes := make([]byte, msgPreambleSize+size)
 	msgBytes[0] = byte(Accelerometer)
-	util.HostByteOrder.PutUint32(msgBytes[1:5], uint32(size+msgPreambleSize))
-	util.PackedStructToBytes(msgBytes[5:], &accel)
+	wireByteOrder.PutUint32(msgBytes[1:5], uint32(size+msgPreambleSize))
+	util.PackedStructToBytes(msgBytes[5:], &accel, wireByteOrder)
 	buffer := bytes.NewBuffer(msgBytes)
 	reader := NewHINJReader(buffer)
 	accelInterface, err := reader.ReadMessage()
@@ -221,8 +223,8 @@ func TestUnitReadMessageGyro(t *testing.T) {
 	size, _ := util.PackedStructSize(&gyro)
 	msgBytes := make([]byte, msgPreambleSize+size)
 	msgBytes[0] = byte(Gyroscope)
-	util.HostByteOrder.PutUint32(msgBytes[1:5], uint32(size+msgPreambleSize))
-	util.PackedStructToBytes(msgBytes[5:], &gyro)
+	wireByteOrder.PutUint32(msgBytes[1:5], uint32(size+msgPreambleSize))
+	util.PackedStructToBytes(msgBytes[5:], &gyro, wireByteOrder)
 	buffer := bytes.NewBuffer(msgBytes)
 	reader := NewHINJReader(buffer)
 	gyroInterface, err := reader.ReadMessage()
@@ -241,8 +243,8 @@ func TestUnitReadMessageBattery(t *testing.T) {
 	size, _ := util.PackedStructSize(&battery)
 	msgBytes := make([]byte, msgPreambleSize+size)
 	msgBytes[0] = byte(Battery)
-	util.HostByteOrder.PutUint32(msgBytes[1:5], uint32(size+msgPreambleSize))
-	util.PackedStructToBytes(msgBytes[5:], &battery)
+	wireByteOrder.PutUint32(msgBytes[1:5], uint32(size+msgPreambleSize))
+	util.PackedStructToBytes(msgBytes[5:], &battery, wireByteOrder)
 	buffer := bytes.NewBuffer(msgBytes)
 	reader := NewHINJReader(buffer)
 	batteryInterface, err := reader.ReadMessage()
@@ -261,8 +263,8 @@ func TestUnitReadMessageBarometer(t *testing.T) {
 	size, _ := util.PackedStructSize(&baro)
 	msgBytes := make([]byte, msgPreambleSize+size)
 	msgBytes[0] = byte(Barometer)
-	util.HostByteOrder.PutUint32(msgBytes[1:5], uint32(size+msgPreambleSize))
-	util.PackedStructToBytes(msgBytes[5:], &baro)
+	wireByteOrder.PutUint32(msgBytes[1:5], uint32(size+msgPreambleSize))
+	util.PackedStructToBytes(msgBytes[5:], &baro, wireByteOrder)
 	buffer := bytes.NewBuffer(msgBytes)
 	reader := NewHINJReader(buffer)
 	baroInterface, err := reader.ReadMessage()
@@ -281,8 +283,8 @@ func TestUnitReadMessageMode(t *testing.T) {
 	size, _ := util.PackedStructSize(&mode)
 	msgBytes := make([]byte, msgPreambleSize+size)
 	msgBytes[0] = byte(Mode)
-	util.HostByteOrder.PutUint32(msgBytes[1:5], uint32(size+msgPreambleSize))
-	util.PackedStructToBytes(msgBytes[5:], &mode)
+	wireByteOrder.PutUint32(msgBytes[1:5], uint32(size+msgPreambleSize))
+	util.PackedStructToBytes(msgBytes[5:], &mode, wireByteOrder)
 	buffer := bytes.NewBuffer(msgBytes)
 	reader := NewHINJReader(buffer)
 	modeInterface, err := reader.ReadMessage()
@@ -295,3 +297,132 @@ func TestUnitReadMessageMode(t *testing.T) {
 		t.Fatalf("ReadMessage() returned a Mode packet with incorrect settings")
 	}
 }
+
+func TestUnitReadMessageRCInputs(t *testing.T) {
+	rc := RCInputsPacket{ChannelCount: 8}
+	rc.Channels[2] = 1500
+	rc.Channels[RCChannels-1] = 2000
+	size, _ := util.PackedStructSize(&rc)
+	msgBytes := make([]byte, msgPreambleSize+size)
+	msgBytes[0] = byte(RCInputs)
+	wireByteOrder.PutUint32(msgBytes[1:5], uint32(size+msgPreambleSize))
+	util.PackedStructToBytes(msgBytes[5:], &rc, wireByteOrder)
+	buffer := bytes.NewBuffer(msgBytes)
+	reader := NewHINJReader(buffer)
+	rcInterface, err := reader.ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage() returned an unexpected error: %s", err)
+	}
+	if realRC, ok := rcInterface.(*RCInputsPacket); !ok {
+		t.Fatalf("ReadMessage() did not return the expected type")
+	} else if *realRC != rc {
+		t.Fatalf("ReadMessage() returned an RC inputs packet with incorrect settings")
+	}
+}
+
+func TestUnitReadMessageQuaternion(t *testing.T) {
+	quaternion := QuaternionPacket{Instance: 1, W: 1.0, Z: 0.5}
+	size, _ := util.PackedStructSize(&quaternion)
+	msgBytes := make([]byte, msgPreambleSize+size)
+	msgBytes[0] = byte(Quaternion)
+	wireByteOrder.PutUint32(msgBytes[1:5], uint32(size+msgPreambleSize))
+	util.PackedStructToBytes(msgBytes[5:], &quaternion, wireByteOrder)
+	buffer := bytes.NewBuffer(msgBytes)
+	reader := NewHINJReader(buffer)
+	quaternionInterface, err := reader.ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage() returned an unexpected error: %s", err)
+	}
+	if realQuaternion, ok := quaternionInterface.(*QuaternionPacket); !ok {
+		t.Fatalf("ReadMessage() did not return the expected type")
+	} else if *realQuaternion != quaternion {
+		t.Fatalf("ReadMessage() returned a Quaternion packet with incorrect settings")
+	}
+}
+
+func TestUnitReadMessageSensorReading(t *testing.T) {
+	reading := SensorReadingPacket{Instance: 2, Kind: 7, Value: 12.5}
+	size, _ := util.PackedStructSize(&reading)
+	msgBytes := make([]byte, msgPreambleSize+size)
+	msgBytes[0] = byte(SensorReading)
+	wireByteOrder.PutUint32(msgBytes[1:5], uint32(size+msgPreambleSize))
+	util.PackedStructToBytes(msgBytes[5:], &reading, wireByteOrder)
+	buffer := bytes.NewBuffer(msgBytes)
+	reader := NewHINJReader(buffer)
+	readingInterface, err := reader.ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage() returned an unexpected error: %s", err)
+	}
+	if realReading, ok := readingInterface.(*SensorReadingPacket); !ok {
+		t.Fatalf("ReadMessage() did not return the expected type")
+	} else if *realReading != reading {
+		t.Fatalf("ReadMessage() returned a SensorReading packet with incorrect settings")
+	}
+}
+
+func TestUnitReadMessageRejectsWrongSize(t *testing.T) {
+	var msgBytes [msgPreambleSize]byte
+	msgBytes[0] = byte(GPS)
+	// a corrupt size must be rejected before anything is allocated
+	wireByteOrder.PutUint32(msgBytes[1:5], 0xFFFFFFFF)
+	if _, err := NewHINJReader(bytes.NewBuffer(msgBytes[:])).ReadMessage(); err == nil {
+		t.Fatalf("ReadMessage() accepted a corrupt size")
+	}
+}
+
+func TestUnitReadMessageSplitAcrossReads(t *testing.T) {
+	encoded, err := encodeMessage(&CompassPacket{Instance: 2, Mag1: 3}, msgPreambleSize)
+	if err != nil {
+		t.Fatalf("encodeMessage() returned an unexpected error: %s", err)
+	}
+
+	// deliver one byte at a time, as a slow socket might
+	msg, err := NewHINJReader(iotest.OneByteReader(bytes.NewBuffer(encoded))).ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage() returned an unexpected error: %s", err)
+	} else if compass, ok := msg.(*CompassPacket); !ok || compass.Instance != 2 || compass.Mag1 != 3 {
+		t.Fatalf("ReadMessage() returned an unexpected message: %+v", msg)
+	}
+}
+
+func TestUnitReadStreamMessageResyncs(t *testing.T) {
+	var stream bytes.Buffer
+	writer := NewHINJWriter(&stream)
+	writer.WriteStreamMessage(1, &GyroscopePacket{X: 1})
+	stream.Write([]byte{byte(Gyroscope), 0xde, 0xad, 0xbe, 0xef, 0, 0})
+	writer.WriteStreamMessage(2, &GyroscopePacket{X: 2})
+
+	reader := NewHINJReader(&stream)
+	for _, expected := range []uint32{1, 2} {
+		seq, msg, err := reader.ReadStreamMessage()
+		if err != nil {
+			t.Fatalf("ReadStreamMessage() returned an unexpected error: %s", err)
+		} else if gyro, ok := msg.(*GyroscopePacket); seq != expected || !ok || gyro.X != float32(expected) {
+			t.Fatalf("expected gyro message %d, found %d: %+v", expected, seq, msg)
+		}
+	}
+	if reader.SkippedBytes() != 7 {
+		t.Fatalf("expected 7 skipped bytes, found %d", reader.SkippedBytes())
+	}
+	if _, _, err := reader.ReadStreamMessage(); err != io.EOF {
+		t.Fatalf("expected io.EOF at the end of the stream, found %v", err)
+	}
+}
+
+func TestUnitReadStreamMessageGivesUp(t *testing.T) {
+	garbage := bytes.Repeat([]byte{0xAB}, 2*maxResyncBytes)
+	if _, _, err := NewHINJReader(bytes.NewBuffer(garbage)).ReadStreamMessage(); err == nil || err == io.EOF {
+		t.Fatalf("expected ReadStreamMessage() to give up on garbage, found %v", err)
+	}
+}
+
+func TestUnitWireFormatIsLittleEndian(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewHINJWriter(&buf).WriteStreamMessage(0x0A0B0C0D, &ModePacket{Mode: 0x01020304}); err != nil {
+		t.Fatalf("WriteStreamMessage() returned an unexpected error: %s", err)
+	}
+	expected := []byte{byte(Mode), 13, 0, 0, 0, 0x0D, 0x0C, 0x0B, 0x0A, 0x04, 0x03, 0x02, 0x01}
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Fatalf("expected %x, found %x", expected, buf.Bytes())
+	}
+}
@@ -0,0 +1,179 @@
+package hinj
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/obicons/avis/util"
+)
+
+/*
+ * Every packet type HINJ understands is described once by a PacketType and
+ * registered here. The codec, handshake, statistics, failure injection,
+ * rules, tracing and the explorer's search space all consult the registry,
+ * so a new sensor needs no changes outside its registration.
+ *
+ * A packet is a struct of primitives (or arrays thereof), packed in field
+ * order. By convention, a sensor packet may start with:
+ *   - Instance uint8: which of several identical sensors sent it
+ *   - Ignore uint8:   set to 1 to make the autopilot discard the reading
+ * A packet without an Instance field always comes from instance 0, and one
+ * without an Ignore field cannot be dropped (only corrupted).
+ *
+ * The built-in types use IDs below BadType. Other packages may register
+ * their own sensors with IDs from FirstCustomSensor up to (but excluding)
+ * StreamMagic, typically from an init function.
+ */
+
+// The first ID available to packet types registered outside this package.
+const FirstCustomSensor Sensor = 0x80
+
+// Describes a packet type to every layer of HINJ.
+type PacketType struct {
+	ID   Sensor
+	Name string
+
+	// a pointer to a zero packet (e.g. &GPSPacket{})
+	Packet interface{}
+
+	// whether the packet carries a sensor reading (and so can be failed)
+	IsSensor bool
+
+	// the fields that hold measurements; value faults corrupt these
+	MeasurementFields []string
+
+	// the number of instances of the sensor on the vehicle; zero if the explorer never fails it
+	Instances uint8
+
+	// whether the explorer fails every instance with each kind in -fault.models
+	Explore bool
+
+	// the magnitude of each fault kind the explorer tries: in the packet's native units
+	// for value faults, iterations for delay, a fraction for drop and packets for reorder
+	FaultMagnitudes map[FaultKind]float64
+
+	// faults specific to this sensor that the explorer tries one at a time
+	Faults []FaultModel
+
+	// how the consistency monitor compares instances; nil if it does not
+	Consistency *ConsistencyCheck
+
+	goType      reflect.Type
+	size        int
+	hasInstance bool
+	hasIgnore   bool
+}
+
+var registry = struct {
+	sync.RWMutex
+	byID     map[Sensor]*PacketType
+	byGoType map[reflect.Type]*PacketType
+}{
+	byID:     make(map[Sensor]*PacketType),
+	byGoType: make(map[reflect.Type]*PacketType),
+}
+
+// Registers a packet type.
+// It is an error to register an ID or Go type twice.
+func RegisterPacketType(packetType PacketType) error {
+	if packetType.ID == BadType || packetType.ID >= StreamMagic {
+		return fmt.Errorf("RegisterPacketType(): %s: reserved ID %d", packetType.Name, packetType.ID)
+	} else if packetType.Name == "" {
+		return fmt.Errorf("RegisterPacketType(): packet type %d has no name", packetType.ID)
+	}
+
+	value := reflect.ValueOf(packetType.Packet)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("RegisterPacketType(): %s: Packet must point to a struct", packetType.Name)
+	}
+	size, err := util.PackedStructSize(packetType.Packet)
+	if err != nil {
+		return fmt.Errorf("RegisterPacketType(): %s: %s", packetType.Name, err)
+	}
+	if err = util.PackedStructToBytes(make([]byte, size), packetType.Packet, wireByteOrder); err != nil {
+		return fmt.Errorf("RegisterPacketType(): %s: %s", packetType.Name, err)
+	}
+
+	packetType.goType = value.Type()
+	packetType.size = size
+	packetType.hasInstance = isByteField(value.Elem(), "Instance")
+	packetType.hasIgnore = isByteField(value.Elem(), "Ignore")
+	fields := packetType.MeasurementFields
+	if packetType.Consistency != nil {
+		fields = append(fields[:len(fields):len(fields)], packetType.Consistency.Fields...)
+	}
+	for _, field := range fields {
+		if len(lookupField(value.Elem(), field)) == 0 {
+			return fmt.Errorf("RegisterPacketType(): %s has no field %s", packetType.Name, field)
+		}
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+	if existing, ok := registry.byID[packetType.ID]; ok {
+		return fmt.Errorf("RegisterPacketType(): %s: ID %d is taken by %s", packetType.Name, packetType.ID, existing.Name)
+	} else if existing, ok := registry.byGoType[packetType.goType]; ok {
+		return fmt.Errorf("RegisterPacketType(): %s: %s is already registered as %s", packetType.Name, packetType.goType, existing.Name)
+	}
+	registry.byID[packetType.ID] = &packetType
+	registry.byGoType[packetType.goType] = &packetType
+	return nil
+}
+
+// Registers a packet type, and panics if it cannot be registered.
+func MustRegisterPacketType(packetType PacketType) {
+	if err := RegisterPacketType(packetType); err != nil {
+		panic(err)
+	}
+}
+
+// Returns the registered packet type with the given ID.
+func LookupPacketType(id Sensor) (*PacketType, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	packetType, ok := registry.byID[id]
+	return packetType, ok
+}
+
+// Returns every registered packet type, ordered by ID.
+func PacketTypes() []*PacketType {
+	registry.RLock()
+	defer registry.RUnlock()
+	packetTypes := make([]*PacketType, 0, len(registry.byID))
+	for _, packetType := range registry.byID {
+		packetTypes = append(packetTypes, packetType)
+	}
+	sort.Slice(packetTypes, func(i, j int) bool { return packetTypes[i].ID < packetTypes[j].ID })
+	return packetTypes
+}
+
+// Returns the registered packet type of msg, which must be a pointer to a packet.
+func packetTypeOf(msg interface{}) (*PacketType, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	packetType, ok := registry.byGoType[reflect.TypeOf(msg)]
+	return packetType, ok
+}
+
+// Returns the packed size of the packet, excluding any preamble.
+func (p *PacketType) Size() int {
+	return p.size
+}
+
+// Returns whether packets of this type can be dropped by setting Ignore.
+func (p *PacketType) CanIgnore() bool {
+	return p.hasIgnore
+}
+
+// Returns a pointer to a new zero packet of this type.
+func (p *PacketType) New() interface{} {
+	return reflect.New(p.goType.Elem()).Interface()
+}
+
+// Returns whether packet has a uint8 field with the given name.
+func isByteField(packet reflect.Value, name string) bool {
+	field := packet.FieldByName(name)
+	return field.IsValid() && field.Kind() == reflect.Uint8
+}
@@ -0,0 +1,102 @@
+package hinj
+
+import (
+	"bytes"
+	"testing"
+)
+
+// a rangefinder, registered the way a package outside hinj would
+type testRangefinderPacket struct {
+	Instance uint8
+	Ignore   uint8
+	Distance float32
+	Quality  uint8
+}
+
+const testRangefinder = FirstCustomSensor + 1
+
+func init() {
+	MustRegisterPacketType(PacketType{
+		ID:                testRangefinder,
+		Name:              "TestRangefinder",
+		Packet:            &testRangefinderPacket{},
+		IsSensor:          true,
+		MeasurementFields: []string{"Distance"},
+		Instances:         2,
+	})
+}
+
+func TestUnitRegisteredPacketRoundTrip(t *testing.T) {
+	msg := &testRangefinderPacket{Instance: 1, Distance: 12.5, Quality: 90}
+	var buf bytes.Buffer
+	if err := NewHINJWriter(&buf).WriteStreamMessage(3, msg); err != nil {
+		t.Fatalf("WriteStreamMessage() returned an unexpected error: %s", err)
+	}
+
+	seq, decoded, err := NewHINJReader(&buf).ReadStreamMessage()
+	if err != nil {
+		t.Fatalf("ReadStreamMessage() returned an unexpected error: %s", err)
+	} else if seq != 3 {
+		t.Fatalf("expected sequence number 3, found %d", seq)
+	}
+	rangefinder, ok := decoded.(*testRangefinderPacket)
+	if !ok || *rangefinder != *msg {
+		t.Fatalf("expected %+v, found %+v", msg, decoded)
+	}
+
+	if testRangefinder.String() != "TestRangefinder" {
+		t.Fatalf("expected the registered name, found %s", testRangefinder)
+	} else if sensorType, err := ParseSensor("testrangefinder"); err != nil || sensorType != testRangefinder {
+		t.Fatalf("ParseSensor() returned %d, %v", sensorType, err)
+	}
+}
+
+func TestUnitRegisteredPacketFaultsAndStats(t *testing.T) {
+	server, shutdown := startTestServer(t)
+	defer shutdown()
+
+	server.InjectFault(SensorFailure{SensorType: testRangefinder, Instance: 1, Model: FaultModel{Kind: FaultBias, Magnitude: 2}})
+	healthy := sendOneShot(t, server, &testRangefinderPacket{Instance: 0, Distance: 10}).(*testRangefinderPacket)
+	biased := sendOneShot(t, server, &testRangefinderPacket{Instance: 1, Distance: 10}).(*testRangefinderPacket)
+	if healthy.Distance != 10 {
+		t.Fatalf("expected the healthy rangefinder to be untouched, found %+v", healthy)
+	} else if biased.Distance != 12 {
+		t.Fatalf("expected a biased distance of 12, found %+v", biased)
+	}
+
+	server.FailSensor(testRangefinder, 0)
+	if ignored := sendOneShot(t, server, &testRangefinderPacket{Instance: 0}).(*testRangefinderPacket); ignored.Ignore != 1 {
+		t.Fatalf("expected the failed rangefinder to be ignored, found %+v", ignored)
+	}
+
+	if stats := server.InstanceStats(testRangefinder, 1); stats == nil || stats.Packets != 1 || stats.Altered != 1 {
+		t.Fatalf("unexpected statistics for the biased rangefinder: %+v", stats)
+	}
+	if last, ok := server.GetLastReading(testRangefinder).(*testRangefinderPacket); !ok || last.Instance != 0 {
+		t.Fatalf("unexpected last reading: %+v", server.GetLastReading(testRangefinder))
+	}
+}
+
+func TestUnitRegisterPacketTypeRejectsConflicts(t *testing.T) {
+	type unusedPacket struct{ Value float32 }
+	type pointerPacket struct{ Next *int }
+
+	conflicts := map[string]PacketType{
+		"duplicate ID":      {ID: GPS, Name: "Duplicate", Packet: &unusedPacket{}},
+		"duplicate Go type": {ID: FirstCustomSensor + 2, Name: "Duplicate", Packet: &GPSPacket{}},
+		"reserved ID":       {ID: StreamMagic, Name: "Reserved", Packet: &unusedPacket{}},
+		"bad type ID":       {ID: BadType, Name: "Reserved", Packet: &unusedPacket{}},
+		"no name":           {ID: FirstCustomSensor + 3, Packet: &unusedPacket{}},
+		"non-pointer":       {ID: FirstCustomSensor + 4, Name: "Value", Packet: unusedPacket{}},
+		"unpackable field":  {ID: FirstCustomSensor + 5, Name: "Pointer", Packet: &pointerPacket{}},
+		"unknown field":     {ID: FirstCustomSensor + 6, Name: "Field", Packet: &unusedPacket{}, MeasurementFields: []string{"Missing"}},
+	}
+	for name, packetType := range conflicts {
+		if err := RegisterPacketType(packetType); err == nil {
+			t.Fatalf("RegisterPacketType() accepted a packet type with a %s", name)
+		}
+	}
+	if _, ok := LookupPacketType(FirstCustomSensor + 2); ok {
+		t.Fatalf("a rejected packet type was registered")
+	}
+}
@@ -0,0 +1,234 @@
+package hinj
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+/*
+ * Rules let a fault scenario be written as data instead of Go. A rule file
+ * is JSON:
+ *
+ *   {"Rules": [{
+ *     "Name":      "baro reads high near the ground",
+ *     "Sensor":    "Barometer",
+ *     "Instances": [0, 1],
+ *     "When":      [{"Field": "Pressure", "Op": ">", "Value": 100000}],
+ *     "Actions":   [{"Type": "offset", "Field": "Pressure", "Value": -500}],
+ *     "Window":    {"Start": 1000, "End": 5000}
+ *   }]}
+ *
+ * A rule matches a packet of its sensor type whose instance is listed (or any
+ * instance, if none are) and which satisfies every predicate in When.
+ * Predicates compare a single field (e.g. "Channels[2]") using ==, !=, <, <=,
+ * > or >=. The actions of every matching rule are applied in file order:
+ *   - drop:   marks the packet as ignored
+ *   - set:    sets Field to Value
+ *   - offset: adds Value to Field
+ *   - scale:  multiplies Field by Value
+ *   - hold:   holds Field at its value when the rule began to match
+ * An unindexed array field names every element.
+ *
+ * A rule is only active from iteration Window.Start until (but excluding)
+ * Window.End; an End of zero never closes. Windows are measured in simulator
+ * iterations when the server has an iteration source, and in packets of the
+ * rule's sensor type otherwise.
+ */
+
+type RuleSet struct {
+	Rules []*Rule
+}
+
+type Rule struct {
+	Name      string
+	Sensor    string
+	Instances []uint8
+	When      []Predicate
+	Actions   []Action
+	Window    Window
+
+	sensorType Sensor
+	packets    uint64
+	// values held by hold actions, by instance then field
+	held map[uint8]map[string]float64
+}
+
+type Predicate struct {
+	Field string
+	Op    string
+	Value float64
+}
+
+type Action struct {
+	Type  string
+	Field string
+	Value float64
+}
+
+type Window struct {
+	Start uint64
+	End   uint64
+}
+
+// Reads and validates a rule file.
+func LoadRules(reader io.Reader) (*RuleSet, error) {
+	decoder := json.NewDecoder(reader)
+	decoder.DisallowUnknownFields()
+
+	var rules RuleSet
+	if err := decoder.Decode(&rules); err != nil {
+		return nil, fmt.Errorf("LoadRules(): %s", err)
+	}
+	for i, rule := range rules.Rules {
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("LoadRules(): rule %d (%s): %s", i, rule.Name, err)
+		}
+	}
+	return &rules, nil
+}
+
+// Resolves the rule's sensor type and checks its predicates and actions against it.
+func (r *Rule) validate() error {
+	var err error
+	if r.sensorType, err = ParseSensor(r.Sensor); err != nil {
+		return err
+	}
+	packetType, _ := LookupPacketType(r.sensorType)
+	if !packetType.IsSensor {
+		return fmt.Errorf("%s packets are not sensor readings", r.sensorType)
+	} else if r.Window.End != 0 && r.Window.End <= r.Window.Start {
+		return fmt.Errorf("window ends at %d, before it starts at %d", r.Window.End, r.Window.Start)
+	}
+
+	packet := reflect.ValueOf(packetType.Packet).Elem()
+	for _, predicate := range r.When {
+		if len(lookupField(packet, predicate.Field)) != 1 {
+			return fmt.Errorf("%s has no single field %s", r.sensorType, predicate.Field)
+		} else if _, ok := comparisons[predicate.Op]; !ok {
+			return fmt.Errorf("unknown comparison %s", predicate.Op)
+		}
+	}
+
+	if len(r.Actions) == 0 {
+		return fmt.Errorf("no actions")
+	}
+	for _, action := range r.Actions {
+		switch action.Type {
+		case "drop":
+			if !packetType.CanIgnore() {
+				return fmt.Errorf("%s packets cannot be dropped", r.sensorType)
+			}
+		case "set", "offset", "scale", "hold":
+			if len(lookupField(packet, action.Field)) == 0 {
+				return fmt.Errorf("%s has no field %s", r.sensorType, action.Field)
+			}
+		default:
+			return fmt.Errorf("unknown action %s", action.Type)
+		}
+	}
+	return nil
+}
+
+var comparisons = map[string]func(a, b float64) bool{
+	"==": func(a, b float64) bool { return a == b },
+	"!=": func(a, b float64) bool { return a != b },
+	"<":  func(a, b float64) bool { return a < b },
+	"<=": func(a, b float64) bool { return a <= b },
+	">":  func(a, b float64) bool { return a > b },
+	">=": func(a, b float64) bool { return a >= b },
+}
+
+// Applies every matching rule to msg.
+// iteration is the current simulator iteration, if haveIteration is set.
+// Returns whether any rule matched.
+func (rules *RuleSet) apply(msg interface{}, iteration uint64, haveIteration bool) bool {
+	sensorType, instance, ok := packetSource(msg)
+	if !ok {
+		return false
+	}
+
+	matched := false
+	for _, rule := range rules.Rules {
+		if rule.sensorType != sensorType {
+			continue
+		}
+		rule.packets++
+		if !haveIteration {
+			iteration = rule.packets - 1
+		}
+		if rule.matches(msg, instance, iteration) {
+			rule.rewrite(msg, instance)
+			matched = true
+		} else {
+			delete(rule.held, instance)
+		}
+	}
+	return matched
+}
+
+func (r *Rule) matches(msg interface{}, instance uint8, iteration uint64) bool {
+	if iteration < r.Window.Start || (r.Window.End != 0 && iteration >= r.Window.End) {
+		return false
+	}
+
+	if len(r.Instances) != 0 {
+		listed := false
+		for _, listedInstance := range r.Instances {
+			listed = listed || listedInstance == instance
+		}
+		if !listed {
+			return false
+		}
+	}
+
+	packet := reflect.ValueOf(msg).Elem()
+	for _, predicate := range r.When {
+		value := getNumeric(lookupField(packet, predicate.Field)[0].value)
+		if !comparisons[predicate.Op](value, predicate.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Rule) rewrite(msg interface{}, instance uint8) {
+	packet := reflect.ValueOf(msg).Elem()
+	for _, action := range r.Actions {
+		if action.Type == "drop" {
+			packet.FieldByName("Ignore").SetUint(1)
+			continue
+		}
+
+		for _, field := range lookupField(packet, action.Field) {
+			value := getNumeric(field.value)
+			switch action.Type {
+			case "set":
+				value = action.Value
+			case "offset":
+				value += action.Value
+			case "scale":
+				value *= action.Value
+			case "hold":
+				value = r.hold(instance, field.key, value)
+			}
+			setNumeric(field.value, value)
+		}
+	}
+}
+
+// Returns the value held for the named field, holding value if there is none yet.
+func (r *Rule) hold(instance uint8, key string, value float64) float64 {
+	if r.held == nil {
+		r.held = make(map[uint8]map[string]float64)
+	}
+	if r.held[instance] == nil {
+		r.held[instance] = make(map[string]float64)
+	}
+	if held, ok := r.held[instance][key]; ok {
+		return held
+	}
+	r.held[instance][key] = value
+	return value
+}
@@ -0,0 +1,116 @@
+package hinj
+
+import (
+	"strings"
+	"testing"
+)
+
+func loadTestRules(t *testing.T, text string) *RuleSet {
+	rules, err := LoadRules(strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("LoadRules() returned an unexpected error: %s", err)
+	}
+	return rules
+}
+
+func TestUnitLoadRulesRejectsBadRules(t *testing.T) {
+	bad := []string{
+		`{"Rules": [{"Sensor": "Altimeter", "Actions": [{"Type": "drop"}]}]}`,
+		`{"Rules": [{"Sensor": "GPS", "Actions": [{"Type": "melt"}]}]}`,
+		`{"Rules": [{"Sensor": "GPS", "Actions": [{"Type": "set", "Field": "Speed"}]}]}`,
+		`{"Rules": [{"Sensor": "GPS", "When": [{"Field": "Latitude", "Op": "~"}], "Actions": [{"Type": "drop"}]}]}`,
+		`{"Rules": [{"Sensor": "RCInputs", "When": [{"Field": "Channels", "Op": "<"}], "Actions": [{"Type": "drop"}]}]}`,
+		`{"Rules": [{"Sensor": "Battery", "Actions": [{"Type": "drop"}]}]}`,
+		`{"Rules": [{"Sensor": "GPS", "Actions": []}]}`,
+		`{"Rules": [{"Sensor": "GPS", "Actions": [{"Type": "drop"}], "Window": {"Start": 10, "End": 5}}]}`,
+		`{"Rules": [{"Sensor": "GPS", "Actons": [{"Type": "drop"}]}]}`,
+	}
+	for _, text := range bad {
+		if _, err := LoadRules(strings.NewReader(text)); err == nil {
+			t.Fatalf("LoadRules() accepted %s", text)
+		}
+	}
+}
+
+func TestUnitRulesMatchAndRewrite(t *testing.T) {
+	rules := loadTestRules(t, `{"Rules": [
+		{"Sensor": "barometer", "Instances": [1],
+		 "When": [{"Field": "Pressure", "Op": ">", "Value": 1000}],
+		 "Actions": [{"Type": "offset", "Field": "Pressure", "Value": -100}, {"Type": "set", "Field": "Temperature", "Value": 99}]},
+		{"Sensor": "RCInputs", "Actions": [{"Type": "scale", "Field": "Channels[2]", "Value": 2}]},
+		{"Sensor": "GPS", "When": [{"Field": "SatellitesVisible", "Op": "<", "Value": 6}], "Actions": [{"Type": "drop"}]}
+	]}`)
+
+	wrongInstance := BarometerPacket{Instance: 0, Pressure: 2000}
+	if rules.apply(&wrongInstance, 0, false) || wrongInstance.Pressure != 2000 {
+		t.Fatalf("a rule rewrote an unlisted instance: %+v", wrongInstance)
+	}
+	low := BarometerPacket{Instance: 1, Pressure: 500}
+	if rules.apply(&low, 0, false) || low.Pressure != 500 {
+		t.Fatalf("a rule rewrote a packet that failed its predicate: %+v", low)
+	}
+	high := BarometerPacket{Instance: 1, Pressure: 2000}
+	if !rules.apply(&high, 0, false) || high.Pressure != 1900 || high.Temperature != 99 {
+		t.Fatalf("unexpected rewritten barometer: %+v", high)
+	}
+
+	rc := RCInputsPacket{Channels: [RCChannels]uint16{1500, 1500, 1100}}
+	rules.apply(&rc, 0, false)
+	if rc.Channels[2] != 2200 || rc.Channels[1] != 1500 {
+		t.Fatalf("unexpected rewritten channels: %v", rc.Channels)
+	}
+
+	weak, strong := GPSPacket{SatellitesVisible: 4}, GPSPacket{SatellitesVisible: 10}
+	rules.apply(&weak, 0, false)
+	rules.apply(&strong, 0, false)
+	if weak.Ignore != 1 || strong.Ignore != 0 {
+		t.Fatalf("expected only the weak fix to drop: %+v %+v", weak, strong)
+	}
+}
+
+func TestUnitRulesWindowAndHold(t *testing.T) {
+	rules := loadTestRules(t, `{"Rules": [
+		{"Sensor": "Compass", "Actions": [{"Type": "hold", "Field": "Mag0"}], "Window": {"Start": 10, "End": 20}}
+	]}`)
+
+	for iteration := uint64(0); iteration < 30; iteration++ {
+		compass := CompassPacket{Mag0: float32(iteration)}
+		rules.apply(&compass, iteration, true)
+		expected := float32(iteration)
+		if iteration >= 10 && iteration < 20 {
+			expected = 10
+		}
+		if compass.Mag0 != expected {
+			t.Fatalf("iteration %d: expected Mag0 = %f, found %f", iteration, expected, compass.Mag0)
+		}
+	}
+}
+
+func TestUnitServerAppliesRules(t *testing.T) {
+	server, shutdown := startTestServer(t)
+	defer shutdown()
+
+	server.SetRules(loadTestRules(t, `{"Rules": [
+		{"Sensor": "Gyroscope", "Actions": [{"Type": "set", "Field": "Z", "Value": 1}]}
+	]}`))
+	reply := sendOneShot(t, server, &GyroscopePacket{Z: 0.1})
+	if gyro, ok := reply.(*GyroscopePacket); !ok || gyro.Z != 1 {
+		t.Fatalf("the server did not apply its rules: %+v", reply)
+	} else if stats := server.InstanceStats(Gyroscope, 0); stats == nil || stats.Faulted != 1 || stats.Altered != 1 {
+		t.Fatalf("unexpected statistics for a rewritten packet: %+v", stats)
+	}
+}
+
+func TestUnitServerIgnoresNoOpRules(t *testing.T) {
+	server, shutdown := startTestServer(t)
+	defer shutdown()
+
+	// the rule matches, but Z is already 1
+	server.SetRules(loadTestRules(t, `{"Rules": [
+		{"Sensor": "Gyroscope", "Actions": [{"Type": "set", "Field": "Z", "Value": 1}]}
+	]}`))
+	sendOneShot(t, server, &GyroscopePacket{Z: 1})
+	if stats := server.InstanceStats(Gyroscope, 0); stats == nil || stats.Packets != 1 || stats.Faulted != 0 || stats.Altered != 0 {
+		t.Fatalf("expected a packet the rule left as it was not to count as faulted: %+v", stats)
+	}
+}
@@ -1,35 +1,69 @@
 package hinj
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/url"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/obicons/avis/util"
 )
 
 /*
  * The HINJ server is responsible for:
  *   1. Reading incoming hardware packets
- *   2. Applying modification rules
+ *   2. Applying modification rules (injected faults, and the rules in rules.go)
  *   3. Performing those modifications
+ *
+ * Clients talk to the server in one of two modes:
+ *   - one-shot: each connection carries exactly one message and its reply.
+ *   - streaming: the client sends StreamMagic as the first byte and
+ *     performs the handshake in handshake.go, then sends any number of
+ *     framed messages, each tagged with a sequence number that the reply
+ *     echoes back.
+ * A stream is served until the client hangs up.
+ *
+ * The server listens on a unix socket (unix:///path/to.sock) or on TCP
+ * (tcp://host:port), so avis and the autopilot need not share a filesystem.
+ *
+ * Every connection is served on its own goroutine, so several autopilots
+ * (or several threads of one autopilot) can be served in parallel.
+ * All failure, last-reading and counter state is guarded by lock, and each
+ * message is recorded and modified while holding it, so a packet never
+ * observes a half-applied failure.
+ * It is safe to call the exported methods from any goroutine.
+ *
+ * The server can record every packet it sends back to a trace, and can
+ * replay a trace in place of the live readings (see trace.go). The trace is
+ * written from its own goroutine, so the lock is never held while waiting on it.
  */
 type HINJServer struct {
-	Addr                     net.Addr
-	Listener                 net.Listener
-	shutdownChan             chan int
-	shutdownAckChan          chan int
-	failureStateBySensorType map[Sensor]map[uint8]bool
-	enableFailureChan        chan SensorFailure
-	gyroReadings             int
-	accelReadings            int
-	gpsReadings              int
-	compassReadings          int
-	baroReadings             int
-	lastAccelReading         AccelerometerPacket
-	lastGPSReading           GPSPacket
-	lastGyroReading          GyroscopePacket
-	lastCompassReading       CompassPacket
-	lastBaroReading          BarometerPacket
+	Addr     net.Addr
+	Listener net.Listener
+
+	shutdownChan    chan int
+	shutdownAckChan chan int
+
+	// tracks the goroutines serving connections
+	connWaitGroup sync.WaitGroup
+
+	// guards every field below
+	lock                     sync.Mutex
+	conns                    map[net.Conn]bool
+	failureStateBySensorType map[Sensor]map[uint8]*faultState
+	statsBySensorType        map[Sensor]map[uint8]*SensorStats
+	lastReadings             map[Sensor]interface{}
+	iterations               func() uint64
+	recorder                 *traceRecorder
+	replayQueues             map[Sensor]map[uint8][]TraceRecord
+	rules                    *RuleSet
+	consistency              *consistencyMonitor
+	observer                 func(Observation)
 }
 
 type URLAddr url.URL
@@ -38,6 +72,8 @@ func NewHINJServer(rawURL string) (*HINJServer, error) {
 	tmpURL, err := url.Parse(rawURL)
 	if err != nil {
 		return nil, err
+	} else if _, _, err = util.URLNetworkAddress(tmpURL); err != nil {
+		return nil, err
 	}
 
 	server := HINJServer{
@@ -47,8 +83,10 @@ func NewHINJServer(rawURL string) (*HINJServer, error) {
 		shutdownChan: make(chan int, 1),
 
 		shutdownAckChan:          make(chan int),
-		enableFailureChan:        make(chan SensorFailure),
-		failureStateBySensorType: make(map[Sensor]map[uint8]bool),
+		conns:                    make(map[net.Conn]bool),
+		failureStateBySensorType: make(map[Sensor]map[uint8]*faultState),
+		statsBySensorType:        make(map[Sensor]map[uint8]*SensorStats),
+		lastReadings:             make(map[Sensor]interface{}),
 	}
 
 	return &server, nil
@@ -62,6 +100,14 @@ func (server *HINJServer) Start() error {
 		return fmt.Errorf("Start(): %s", err)
 	}
 
+	// statistics describe a single run, so start counting afresh
+	server.lock.Lock()
+	server.statsBySensorType = make(map[Sensor]map[uint8]*SensorStats)
+	if server.consistency != nil {
+		server.consistency.reset()
+	}
+	server.lock.Unlock()
+
 	// run the server's event loop
 	go server.work()
 
@@ -69,75 +115,273 @@ func (server *HINJServer) Start() error {
 }
 
 // Stops the server.
+// Open connections are closed, and Shutdown waits for their goroutines to exit.
 // It is an error to call this function on a server that is not running.
 // It is alright to recycle the server after calling this function.
 func (server *HINJServer) Shutdown() {
 	server.shutdownChan <- 0
 	server.Listener.Close()
 	<-server.shutdownAckChan
-	server.reportStats()
+
+	// no new connections can arrive now that work() has exited
+	server.lock.Lock()
+	for conn := range server.conns {
+		conn.Close()
+	}
+	server.lock.Unlock()
+	server.connWaitGroup.Wait()
+
 	server.resetFailures()
 }
 
 // Causes all future reads of the provided sensor category and instance to fail.
 func (server *HINJServer) FailSensor(sensorType Sensor, instanceNo uint8) {
-	if server.failureStateBySensorType[sensorType] == nil {
-		server.failureStateBySensorType[sensorType] = make(map[uint8]bool)
+	server.InjectFault(SensorFailure{SensorType: sensorType, Instance: instanceNo})
+}
+
+// Causes all future reads of failure's sensor category and instance to be
+// rewritten according to failure.Model.
+// Replaces any fault already active on that instance.
+func (server *HINJServer) InjectFault(failure SensorFailure) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	if server.failureStateBySensorType[failure.SensorType] == nil {
+		server.failureStateBySensorType[failure.SensorType] = make(map[uint8]*faultState)
 	}
-	server.failureStateBySensorType[sensorType][instanceNo] = true
+	server.failureStateBySensorType[failure.SensorType][failure.Instance] = newFaultState(failure.Model)
 }
 
-// Resets the failure state
+// Stops failing the provided sensor category and instance.
+// Future reads pass through unmodified until the instance is failed again.
+func (server *HINJServer) RestoreSensor(sensorType Sensor, instanceNo uint8) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	delete(server.failureStateBySensorType[sensorType], instanceNo)
+}
+
+// Applies rules to every packet from now on, on top of any injected faults.
+// Replaces any rules already in effect; nil removes them.
+func (server *HINJServer) SetRules(rules *RuleSet) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.rules = rules
+}
+
+// Resets the failure state and removes any rules
 func (server *HINJServer) resetFailures() {
-	server.failureStateBySensorType = make(map[Sensor]map[uint8]bool)
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.failureStateBySensorType = make(map[Sensor]map[uint8]*faultState)
+	server.rules = nil
+}
+
+// Returns a copy of the last packet of the given type the server received,
+// or nil if it has not received one.
+func (server *HINJServer) GetLastReading(sensorType Sensor) interface{} {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	if reading, ok := server.lastReadings[sensorType]; ok {
+		return copyPacket(reading)
+	}
+	return nil
 }
 
 func (server *HINJServer) GetLastAccelReading() AccelerometerPacket {
-	return server.lastAccelReading
+	if reading, ok := server.GetLastReading(Accelerometer).(*AccelerometerPacket); ok {
+		return *reading
+	}
+	return AccelerometerPacket{}
 }
 
 func (server *HINJServer) GetLastGPSReading() GPSPacket {
-	return server.lastGPSReading
+	if reading, ok := server.GetLastReading(GPS).(*GPSPacket); ok {
+		return *reading
+	}
+	return GPSPacket{}
 }
 
 func (server *HINJServer) GetLastGyroReading() GyroscopePacket {
-	return server.lastGyroReading
+	if reading, ok := server.GetLastReading(Gyroscope).(*GyroscopePacket); ok {
+		return *reading
+	}
+	return GyroscopePacket{}
 }
 
 func (server *HINJServer) GetLastCompassReading() CompassPacket {
-	return server.lastCompassReading
+	if reading, ok := server.GetLastReading(Compass).(*CompassPacket); ok {
+		return *reading
+	}
+	return CompassPacket{}
 }
 
 func (server *HINJServer) GetLastBarometerReading() BarometerPacket {
-	return server.lastBaroReading
+	if reading, ok := server.GetLastReading(Barometer).(*BarometerPacket); ok {
+		return *reading
+	}
+	return BarometerPacket{}
+}
+
+func (server *HINJServer) GetLastBatteryReading() BatteryPacket {
+	if reading, ok := server.GetLastReading(Battery).(*BatteryPacket); ok {
+		return *reading
+	}
+	return BatteryPacket{}
+}
+
+// Sets the function used to stamp recorded packets with the simulator's iteration.
+func (server *HINJServer) SetIterationSource(iterations func() uint64) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.iterations = iterations
+}
+
+// Records every packet sent back to the autopilot to writer, until StopRecording() is called.
+// writer is written from another goroutine, so a slow disk does not hold up the autopilot.
+func (server *HINJServer) StartRecording(writer io.Writer) error {
+	traceWriter, err := NewTraceWriter(writer)
+	if err != nil {
+		return err
+	}
+
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.recorder = newTraceRecorder(traceWriter)
+	return nil
+}
+
+// Stops recording, and waits for the trace to be written and flushed.
+// It is safe to call this function when the server is not recording.
+func (server *HINJServer) StopRecording() error {
+	server.lock.Lock()
+	recorder := server.recorder
+	server.recorder = nil
+	server.lock.Unlock()
+
+	if recorder == nil {
+		return nil
+	}
+	return recorder.close()
+}
+
+// Replays the trace read from reader in place of live readings.
+// Each sensor instance is fed its recorded packets in order; once an
+// instance's recording runs out, its live readings pass through again.
+// Failures are not applied to replayed packets, since the trace already
+// holds the packets as the autopilot saw them.
+func (server *HINJServer) StartReplay(reader io.Reader) error {
+	traceReader, err := NewTraceReader(reader)
+	if err != nil {
+		return err
+	}
+
+	queues := make(map[Sensor]map[uint8][]TraceRecord)
+	for {
+		record, err := traceReader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("StartReplay(): %s", err)
+		}
+
+		msg, err := record.Message()
+		if err != nil {
+			return fmt.Errorf("StartReplay(): %s", err)
+		}
+		sensorType, instance, ok := packetSource(msg)
+		if !ok {
+			continue
+		}
+		if queues[sensorType] == nil {
+			queues[sensorType] = make(map[uint8][]TraceRecord)
+		}
+		queues[sensorType][instance] = append(queues[sensorType][instance], record)
+	}
+
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.replayQueues = queues
+	return nil
 }
 
-func (server *HINJServer) recordStats(msg interface{}) {
-	switch msg.(type) {
-	case *GPSPacket:
-		server.gpsReadings++
-		server.lastGPSReading = *(msg.(*GPSPacket))
-	case *AccelerometerPacket:
-		server.accelReadings++
-		server.lastAccelReading = *(msg.(*AccelerometerPacket))
-	case *GyroscopePacket:
-		server.gyroReadings++
-		server.lastGyroReading = *(msg.(*GyroscopePacket))
-	case *BarometerPacket:
-		server.baroReadings++
-		server.lastBaroReading = *(msg.(*BarometerPacket))
-	case *CompassPacket:
-		server.compassReadings++
-		server.lastCompassReading = *(msg.(*CompassPacket))
+// Stops replaying; live readings pass through again.
+func (server *HINJServer) StopReplay() {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.replayQueues = nil
+}
+
+// Records msg and applies any failure (or replayed packet) to it.
+func (server *HINJServer) process(msg interface{}) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.recordLastReading(msg)
+	original := copyPacket(msg)
+	faulted := false
+	if !server.replay(msg) {
+		faulted = server.checkAndFail(msg)
+		if server.rules != nil {
+			iteration, haveIteration := uint64(0), server.iterations != nil
+			if haveIteration {
+				iteration = server.iterations()
+			}
+			faulted = server.rules.apply(msg, iteration, haveIteration) || faulted
+		}
 	}
+	// a fault or rule that leaves the packet as it was (e.g. setting a field to the
+	// value it already has) has not faulted it
+	altered := !samePacketBytes(original, msg)
+	faulted = faulted && altered
+	server.updateStats(msg, faulted, altered)
+	server.checkConsistency(msg)
+	server.record(msg)
+	server.observe(msg, faulted)
 }
 
-func (server *HINJServer) reportStats() {
-	fmt.Printf("GPS readings: %d\n", server.gpsReadings)
-	fmt.Printf("Accel readings: %d\n", server.accelReadings)
-	fmt.Printf("Gyro readings: %d\n", server.gyroReadings)
-	fmt.Printf("Compass readings: %d\n", server.compassReadings)
-	fmt.Printf("Baro readings: %d\n", server.baroReadings)
+// Overwrites msg with the next recorded packet of its sensor instance.
+// Returns false if there is no such packet.
+// must be called with server.lock held
+func (server *HINJServer) replay(msg interface{}) bool {
+	sensorType, instance, ok := packetSource(msg)
+	if !ok {
+		return false
+	}
+
+	queue := server.replayQueues[sensorType][instance]
+	if len(queue) == 0 {
+		return false
+	}
+	server.replayQueues[sensorType][instance] = queue[1:]
+
+	// StartReplay() already decoded this record once, so this cannot fail
+	recorded, _ := queue[0].Message()
+	reflect.ValueOf(msg).Elem().Set(reflect.ValueOf(recorded).Elem())
+	return true
+}
+
+// Queues msg for the trace, if one is being recorded.
+// must be called with server.lock held
+func (server *HINJServer) record(msg interface{}) {
+	if server.recorder == nil {
+		return
+	}
+
+	sensorType, payload, err := encodePayload(msg)
+	if err != nil {
+		return
+	}
+
+	record := TraceRecord{Time: time.Now(), Type: sensorType, Payload: payload}
+	if server.iterations != nil {
+		record.Iteration = server.iterations()
+	}
+	server.recorder.record(record)
+}
+
+// must be called with server.lock held
+func (server *HINJServer) recordLastReading(msg interface{}) {
+	if packetType, ok := packetTypeOf(msg); ok {
+		server.lastReadings[packetType.ID] = copyPacket(msg)
+	}
 }
 
 func (server *HINJServer) work() {
@@ -155,68 +399,121 @@ func (server *HINJServer) work() {
 				continue
 			}
 		}
-		server.checkForPendingFailures()
-		reader := NewHINJReader(conn)
-		writer := NewHINJWriter(conn)
-		msg, err := reader.ReadMessage()
-		if err != nil {
-			log.Printf("HINJServer.work(): error: %s\n", err)
-		}
 
-		server.recordStats(msg)
+		server.lock.Lock()
+		server.conns[conn] = true
+		server.lock.Unlock()
 
-		server.checkAndFail(msg)
-		err = writer.WriteMessage(msg)
-		if err != nil {
-			log.Printf("HINJServer.work(): error writing: %s\n", err)
-		}
-		conn.Close()
+		server.connWaitGroup.Add(1)
+		go func() {
+			defer server.connWaitGroup.Done()
+			server.serveConn(conn)
+		}()
 	}
 	server.shutdownAckChan <- 0
 }
 
-func (server *HINJServer) checkForPendingFailures() {
-	keepGoing := true
-	for keepGoing {
-		select {
-		case failure := <-server.enableFailureChan:
-			server.failureStateBySensorType[failure.SensorType][failure.Instance] = true
-		default:
-			keepGoing = false
+// Serves every message sent over conn, then closes it.
+func (server *HINJServer) serveConn(conn net.Conn) {
+	defer func() {
+		server.lock.Lock()
+		delete(server.conns, conn)
+		server.lock.Unlock()
+		conn.Close()
+	}()
+
+	buffered := bufio.NewReader(conn)
+	if first, err := buffered.Peek(1); err != nil {
+		log.Printf("HINJServer.serveConn(): error: %s\n", err)
+		return
+	} else if first[0] == StreamMagic {
+		buffered.Discard(1)
+		hello, err := serverHandshake(buffered, conn)
+		if err != nil {
+			log.Printf("HINJServer.serveConn(): refused stream: %s\n", err)
+			return
 		}
+		server.serveStream(conn, buffered, hello)
+		return
+	}
+
+	reader := NewHINJReader(buffered)
+	writer := NewHINJWriter(conn)
+	msg, err := reader.ReadMessage()
+	if err != nil {
+		log.Printf("HINJServer.serveConn(): error: %s\n", err)
+		return
+	}
+
+	server.process(msg)
+	err = writer.WriteMessage(msg)
+	if err != nil {
+		log.Printf("HINJServer.serveConn(): error writing: %s\n", err)
 	}
 }
 
-func (server *HINJServer) checkAndFail(msg interface{}) {
-	if gpsPacket, ok := msg.(*GPSPacket); ok {
-		if server.failureStateBySensorType[GPS][gpsPacket.Instance] {
-			gpsPacket.Ignore = 1
+// Serves framed messages from a stream until the client hangs up.
+// Only the packet types announced in the client's hello are accepted.
+func (server *HINJServer) serveStream(conn net.Conn, buffered io.Reader, hello Hello) {
+	reader := NewHINJReader(buffered)
+	flusher := bufio.NewWriter(conn)
+	writer := NewHINJWriter(flusher)
+	skipped := uint64(0)
+	for {
+		seq, msg, err := reader.ReadStreamMessage()
+		if reader.SkippedBytes() != skipped {
+			log.Printf("HINJServer.serveStream(): skipped %d corrupt bytes\n", reader.SkippedBytes()-skipped)
+			skipped = reader.SkippedBytes()
 		}
-	} else if accelPacket, ok := msg.(*AccelerometerPacket); ok {
-		if server.failureStateBySensorType[Accelerometer][accelPacket.Instance] {
-			accelPacket.Ignore = 1
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			log.Printf("HINJServer.serveStream(): error: %s\n", err)
+			return
 		}
-	} else if gyroPacket, ok := msg.(*GyroscopePacket); ok {
-		if server.failureStateBySensorType[Gyroscope][gyroPacket.Instance] {
-			gyroPacket.Ignore = 1
+
+		if sensorType, _ := MessageType(msg); hello.PacketSizes[sensorType] == 0 {
+			log.Printf("HINJServer.serveStream(): peer sent %s, which it did not announce\n", sensorType)
+			return
 		}
-	} else if baroPacket, ok := msg.(*BarometerPacket); ok {
-		if server.failureStateBySensorType[Barometer][baroPacket.Instance] {
-			baroPacket.Ignore = 1
+
+		server.process(msg)
+		if err = writer.WriteStreamMessage(seq, msg); err == nil {
+			err = flusher.Flush()
 		}
-	} else if compassPacket, ok := msg.(*CompassPacket); ok {
-		if server.failureStateBySensorType[Compass][compassPacket.Instance] {
-			compassPacket.Ignore = 1
+		if err != nil {
+			log.Printf("HINJServer.serveStream(): error writing: %s\n", err)
+			return
 		}
 	}
 }
 
+// Returns whether a fault is injected into msg's sensor instance.
+// must be called with server.lock held
+func (server *HINJServer) checkAndFail(msg interface{}) bool {
+	sensorType, instance, ok := packetSource(msg)
+	if !ok {
+		return false
+	}
+	state := server.failureStateBySensorType[sensorType][instance]
+	if state == nil {
+		return false
+	}
+	if server.iterations != nil {
+		state.setIteration(server.iterations())
+	}
+	state.apply(sensorType, msg)
+	return true
+}
+
 // implements net.Addr
-func (url *URLAddr) String() string {
-	return url.Path
+// Returns the socket path of a unix address, or the host:port of a tcp address.
+func (addr *URLAddr) String() string {
+	_, address, _ := util.URLNetworkAddress((*url.URL)(addr))
+	return address
 }
 
 // implements net.Addr
-func (url *URLAddr) Network() string {
-	return url.Scheme
+func (addr *URLAddr) Network() string {
+	return addr.Scheme
 }
@@ -1,6 +1,15 @@
 package hinj
 
-import "testing"
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+)
 
 func TestUnitNewHINJServerUnixAddr(t *testing.T) {
 	url := "unix:///Users/myUser/file.sock"
@@ -17,3 +26,301 @@ func TestUnitNewHINJServerUnixAddr(t *testing.T) {
 		t.Fatalf("error: expected String = %s, found %s", expectedString, server.Addr.String())
 	}
 }
+
+func TestUnitNewHINJServerTCPAddr(t *testing.T) {
+	server, err := NewHINJServer("tcp://127.0.0.1:9000")
+	if err != nil {
+		t.Fatalf("NewHINJServer() returned an unexpected error: %s", err)
+	}
+	if server.Addr.Network() != "tcp" {
+		t.Fatalf("error: expected network = tcp, found %s", server.Addr.Network())
+	}
+	if server.Addr.String() != "127.0.0.1:9000" {
+		t.Fatalf("error: expected String = 127.0.0.1:9000, found %s", server.Addr.String())
+	}
+
+	if _, err := NewHINJServer("tcp://127.0.0.1"); err == nil {
+		t.Fatalf("NewHINJServer() accepted a tcp address without a port")
+	}
+}
+
+func TestUnitServerOverTCP(t *testing.T) {
+	server, err := NewHINJServer("tcp://127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("NewHINJServer() returned an unexpected error: %s", err)
+	} else if err = server.Start(); err != nil {
+		t.Fatalf("Start() returned an unexpected error: %s", err)
+	}
+	defer server.Shutdown()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() returned an unexpected error: %s", err)
+	}
+	defer conn.Close()
+
+	server.FailSensor(Compass, 0)
+	if err = NewHINJWriter(conn).WriteMessage(&CompassPacket{Mag0: 1}); err != nil {
+		t.Fatalf("WriteMessage() returned an unexpected error: %s", err)
+	}
+	reply, err := NewHINJReader(conn).ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage() returned an unexpected error: %s", err)
+	} else if compass, ok := reply.(*CompassPacket); !ok || compass.Ignore != 1 {
+		t.Fatalf("server replied with an unexpected packet: %+v", reply)
+	}
+}
+
+// starts a server listening on a fresh unix socket.
+// the returned function shuts the server down and removes the socket.
+func startTestServer(t testing.TB) (*HINJServer, func()) {
+	dir, err := ioutil.TempDir("", "hinj")
+	if err != nil {
+		t.Fatalf("TempDir() returned an unexpected error: %s", err)
+	}
+
+	server, err := NewHINJServer("unix://" + path.Join(dir, "hinj.sock"))
+	if err != nil {
+		t.Fatalf("NewHINJServer() returned an unexpected error: %s", err)
+	} else if err = server.Start(); err != nil {
+		t.Fatalf("Start() returned an unexpected error: %s", err)
+	}
+
+	return server, func() {
+		server.Shutdown()
+		os.RemoveAll(dir)
+	}
+}
+
+func sendOneShot(t testing.TB, server *HINJServer, msg interface{}) interface{} {
+	conn, err := net.Dial(server.Addr.Network(), server.Addr.String())
+	if err != nil {
+		t.Fatalf("Dial() returned an unexpected error: %s", err)
+	}
+	defer conn.Close()
+
+	if err = NewHINJWriter(conn).WriteMessage(msg); err != nil {
+		t.Fatalf("WriteMessage() returned an unexpected error: %s", err)
+	}
+	reply, err := NewHINJReader(conn).ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage() returned an unexpected error: %s", err)
+	}
+	return reply
+}
+
+// opens a stream to server and performs the handshake.
+func dialStream(server *HINJServer) (net.Conn, error) {
+	conn, err := net.Dial(server.Addr.Network(), server.Addr.String())
+	if err != nil {
+		return nil, err
+	}
+	conn.Write([]byte{StreamMagic})
+	if _, err = ClientHandshake(conn, LocalHello()); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func TestUnitServerOneShot(t *testing.T) {
+	server, shutdown := startTestServer(t)
+	defer shutdown()
+
+	server.FailSensor(GPS, 1)
+	reply := sendOneShot(t, server, &GPSPacket{Instance: 1, Latitude: 42})
+	if gps, ok := reply.(*GPSPacket); !ok {
+		t.Fatalf("server replied with an unexpected type")
+	} else if gps.Ignore != 1 || gps.Latitude != 42 {
+		t.Fatalf("server replied with an unexpected packet: %+v", gps)
+	}
+}
+
+func TestUnitServerStream(t *testing.T) {
+	server, shutdown := startTestServer(t)
+	defer shutdown()
+
+	conn, err := dialStream(server)
+	if err != nil {
+		t.Fatalf("dialStream() returned an unexpected error: %s", err)
+	}
+	defer conn.Close()
+
+	server.FailSensor(Barometer, 0)
+	reader, writer := NewHINJReader(conn), NewHINJWriter(conn)
+	for seq := uint32(0); seq < 100; seq++ {
+		baro := BarometerPacket{Instance: uint8(seq % 2), Pressure: float32(seq)}
+		if err := writer.WriteStreamMessage(seq, &baro); err != nil {
+			t.Fatalf("WriteStreamMessage() returned an unexpected error: %s", err)
+		}
+
+		replySeq, reply, err := reader.ReadStreamMessage()
+		if err != nil {
+			t.Fatalf("ReadStreamMessage() returned an unexpected error: %s", err)
+		} else if replySeq != seq {
+			t.Fatalf("expected sequence number %d, found %d", seq, replySeq)
+		}
+
+		replyBaro, ok := reply.(*BarometerPacket)
+		if !ok {
+			t.Fatalf("server replied with an unexpected type")
+		} else if replyBaro.Pressure != baro.Pressure {
+			t.Fatalf("expected pressure %f, found %f", baro.Pressure, replyBaro.Pressure)
+		} else if (replyBaro.Ignore == 1) != (baro.Instance == 0) {
+			t.Fatalf("server did not fail exactly instance 0: %+v", replyBaro)
+		}
+	}
+}
+
+func TestUnitServerShutdownClosesStream(t *testing.T) {
+	server, shutdown := startTestServer(t)
+
+	conn, err := dialStream(server)
+	if err != nil {
+		t.Fatalf("dialStream() returned an unexpected error: %s", err)
+	}
+	defer conn.Close()
+
+	// the stream is open but idle; Shutdown() must not wait for it
+	done := make(chan int)
+	go func() {
+		shutdown()
+		done <- 1
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Shutdown() blocked on an open stream")
+	}
+}
+
+func BenchmarkOneShot(b *testing.B) {
+	server, shutdown := startTestServer(b)
+	defer shutdown()
+
+	accel := AccelerometerPacket{AccelerationZ: -9.8}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sendOneShot(b, server, &accel)
+	}
+}
+
+func BenchmarkStream(b *testing.B) {
+	server, shutdown := startTestServer(b)
+	defer shutdown()
+
+	conn, err := dialStream(server)
+	if err != nil {
+		b.Fatalf("dialStream() returned an unexpected error: %s", err)
+	}
+	defer conn.Close()
+
+	accel := AccelerometerPacket{AccelerationZ: -9.8}
+	reader, writer := NewHINJReader(conn), NewHINJWriter(conn)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := writer.WriteStreamMessage(uint32(i), &accel); err != nil {
+			b.Fatalf("WriteStreamMessage() returned an unexpected error: %s", err)
+		}
+		if _, _, err := reader.ReadStreamMessage(); err != nil {
+			b.Fatalf("ReadStreamMessage() returned an unexpected error: %s", err)
+		}
+	}
+}
+
+// drives the server from several streaming and one-shot clients while
+// failures are toggled and readings are polled; run with -race.
+func TestUnitServerConcurrentClients(t *testing.T) {
+	server, shutdown := startTestServer(t)
+	defer shutdown()
+
+	const streams, oneShots, msgsPerClient = 4, 2, 200
+	var clients sync.WaitGroup
+	errs := make(chan error, streams+oneShots)
+
+	for i := 0; i < streams; i++ {
+		clients.Add(1)
+		go func(instance uint8) {
+			defer clients.Done()
+			conn, err := dialStream(server)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer conn.Close()
+
+			reader, writer := NewHINJReader(conn), NewHINJWriter(conn)
+			for seq := uint32(0); seq < msgsPerClient; seq++ {
+				gyro := GyroscopePacket{Instance: instance, X: float32(seq)}
+				if err := writer.WriteStreamMessage(seq, &gyro); err != nil {
+					errs <- err
+					return
+				}
+				replySeq, reply, err := reader.ReadStreamMessage()
+				if err != nil {
+					errs <- err
+					return
+				} else if replySeq != seq || reply.(*GyroscopePacket).X != float32(seq) {
+					errs <- fmt.Errorf("stream %d: mismatched reply to %d", instance, seq)
+					return
+				}
+			}
+		}(uint8(i))
+	}
+
+	for i := 0; i < oneShots; i++ {
+		clients.Add(1)
+		go func() {
+			defer clients.Done()
+			for j := 0; j < msgsPerClient; j++ {
+				conn, err := net.Dial(server.Addr.Network(), server.Addr.String())
+				if err != nil {
+					errs <- err
+					return
+				}
+				NewHINJWriter(conn).WriteMessage(&CompassPacket{Instance: 1, Mag0: 1})
+				_, err = NewHINJReader(conn).ReadMessage()
+				conn.Close()
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	stopToggling := make(chan int)
+	toggled := make(chan int)
+	go func() {
+		for {
+			select {
+			case <-stopToggling:
+				toggled <- 1
+				return
+			default:
+				server.FailSensor(Gyroscope, 1)
+				server.GetLastGyroReading()
+				server.GetLastCompassReading()
+				server.RestoreSensor(Gyroscope, 1)
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}()
+
+	clients.Wait()
+	stopToggling <- 1
+	<-toggled
+	close(errs)
+	for err := range errs {
+		t.Fatalf("client error: %s", err)
+	}
+
+	for instance := uint8(0); instance < streams; instance++ {
+		if stats := server.InstanceStats(Gyroscope, instance); stats == nil || stats.Packets != msgsPerClient {
+			t.Fatalf("expected %d readings from gyro %d, found %+v", msgsPerClient, instance, stats)
+		}
+	}
+	if stats := server.InstanceStats(Compass, 1); stats == nil || stats.Packets != oneShots*msgsPerClient {
+		t.Fatalf("expected %d compass readings, found %+v", oneShots*msgsPerClient, stats)
+	}
+}
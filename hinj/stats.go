@@ -0,0 +1,108 @@
+package hinj
+
+import (
+	"bytes"
+	"sort"
+	"time"
+)
+
+// Describes the packets one sensor instance sent during a run.
+type SensorStats struct {
+	SensorType Sensor
+	Instance   uint8
+
+	// the number of packets received
+	Packets uint64
+	// the number of packets an injected fault or a rule changed
+	Faulted uint64
+	// the number of packets changed before being sent back, by a fault or a replayed trace
+	Altered uint64
+
+	// when the first and last packets arrived
+	First time.Time
+	Last  time.Time
+	// the longest time between two consecutive packets
+	MaxGap time.Duration
+	// packets per second between the first and last packets
+	Rate float64
+}
+
+// Accounts for a packet that arrived at now.
+// faulted reports whether a fault or rule changed the packet, and altered whether anything did.
+func (s *SensorStats) update(now time.Time, faulted, altered bool) {
+	if s.Packets == 0 {
+		s.First = now
+	} else if gap := now.Sub(s.Last); gap > s.MaxGap {
+		s.MaxGap = gap
+	}
+	s.Last = now
+	s.Packets++
+	if faulted {
+		s.Faulted++
+	}
+	if altered {
+		s.Altered++
+	}
+}
+
+// Returns statistics for every sensor instance the server has heard from
+// since it was last started, ordered by sensor type and instance.
+func (server *HINJServer) Stats() []SensorStats {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	var stats []SensorStats
+	for _, byInstance := range server.statsBySensorType {
+		for _, instanceStats := range byInstance {
+			snapshot := *instanceStats
+			if elapsed := snapshot.Last.Sub(snapshot.First).Seconds(); elapsed > 0 {
+				snapshot.Rate = float64(snapshot.Packets-1) / elapsed
+			}
+			stats = append(stats, snapshot)
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].SensorType != stats[j].SensorType {
+			return stats[i].SensorType < stats[j].SensorType
+		}
+		return stats[i].Instance < stats[j].Instance
+	})
+	return stats
+}
+
+// Returns the statistics of one sensor instance, or nil if it never sent a packet.
+func (server *HINJServer) InstanceStats(sensorType Sensor, instance uint8) *SensorStats {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	if stats := server.statsBySensorType[sensorType][instance]; stats != nil {
+		snapshot := *stats
+		return &snapshot
+	}
+	return nil
+}
+
+// Accounts for msg; faulted and altered are as for SensorStats.update.
+// must be called with server.lock held
+func (server *HINJServer) updateStats(msg interface{}, faulted, altered bool) {
+	sensorType, instance, ok := packetSource(msg)
+	if !ok {
+		return
+	}
+
+	if server.statsBySensorType[sensorType] == nil {
+		server.statsBySensorType[sensorType] = make(map[uint8]*SensorStats)
+	}
+	stats := server.statsBySensorType[sensorType][instance]
+	if stats == nil {
+		stats = &SensorStats{SensorType: sensorType, Instance: instance}
+		server.statsBySensorType[sensorType][instance] = stats
+	}
+	stats.update(time.Now(), faulted, altered)
+}
+
+// Returns whether a and b go over the wire as the same bytes.
+func samePacketBytes(a, b interface{}) bool {
+	_, aBytes, aErr := encodePayload(a)
+	_, bBytes, bErr := encodePayload(b)
+	return aErr == nil && bErr == nil && bytes.Equal(aBytes, bBytes)
+}
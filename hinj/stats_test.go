@@ -0,0 +1,50 @@
+package hinj
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUnitSensorStatsUpdate(t *testing.T) {
+	var stats SensorStats
+	start := time.Unix(100, 0)
+	stats.update(start, false, false)
+	stats.update(start.Add(10*time.Millisecond), true, true)
+	stats.update(start.Add(40*time.Millisecond), true, false)
+
+	if stats.Packets != 3 || stats.Faulted != 2 || stats.Altered != 1 {
+		t.Fatalf("unexpected counts: %+v", stats)
+	} else if !stats.First.Equal(start) || !stats.Last.Equal(start.Add(40*time.Millisecond)) {
+		t.Fatalf("unexpected first and last times: %+v", stats)
+	} else if stats.MaxGap != 30*time.Millisecond {
+		t.Fatalf("expected a maximum gap of 30ms, found %s", stats.MaxGap)
+	}
+}
+
+func TestUnitServerStats(t *testing.T) {
+	server, shutdown := startTestServer(t)
+	defer shutdown()
+
+	server.InjectFault(SensorFailure{SensorType: Barometer, Instance: 1, Model: FaultModel{Kind: FaultBias, Magnitude: 1}})
+	for i := 0; i < 5; i++ {
+		sendOneShot(t, server, &BarometerPacket{Instance: 0, Pressure: 100})
+		sendOneShot(t, server, &BarometerPacket{Instance: 1, Pressure: 100})
+	}
+
+	stats := server.Stats()
+	if len(stats) != 2 {
+		t.Fatalf("expected statistics for 2 instances, found %+v", stats)
+	}
+	healthy, failed := stats[0], stats[1]
+	if healthy.Instance != 0 || healthy.Packets != 5 || healthy.Faulted != 0 || healthy.Altered != 0 {
+		t.Fatalf("unexpected statistics for the healthy barometer: %+v", healthy)
+	} else if failed.Instance != 1 || failed.Packets != 5 || failed.Faulted != 5 || failed.Altered != 5 {
+		t.Fatalf("unexpected statistics for the failed barometer: %+v", failed)
+	} else if failed.Rate <= 0 {
+		t.Fatalf("expected a positive packet rate, found %f", failed.Rate)
+	}
+
+	if server.InstanceStats(GPS, 0) != nil {
+		t.Fatalf("InstanceStats() returned statistics for a silent sensor")
+	}
+}
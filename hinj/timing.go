@@ -0,0 +1,118 @@
+package hinj
+
+import "reflect"
+
+// Timing faults change when a packet reaches the autopilot rather than what it
+// says. Every request must still be answered, so a packet that is held back
+// is answered in its place with an ignored packet, or, for packets with no
+// Ignore byte (e.g. battery), with the last packet that was let through.
+//
+// Delays are measured in simulator iterations when the server has an
+// iteration source (see HINJServer.SetIterationSource), and in packets otherwise.
+
+// A copy of a packet held back by a timing fault.
+type heldPacket struct {
+	at     uint64
+	packet interface{}
+}
+
+// Returns a fault that delivers each packet iterations late, as a slow bus would.
+func PacketDelay(iterations uint64) FaultModel {
+	return FaultModel{Kind: FaultDelay, Magnitude: float64(iterations)}
+}
+
+// Returns a fault that drops each packet with probability fraction.
+func PacketDrop(fraction float64, seed int64) FaultModel {
+	return FaultModel{Kind: FaultDrop, Magnitude: fraction, Seed: seed}
+}
+
+// Returns a fault that delivers packets in a random order from a window of window packets.
+func PacketReorder(window int, seed int64) FaultModel {
+	return FaultModel{Kind: FaultReorder, Magnitude: float64(window), Seed: seed}
+}
+
+// Records the current simulator iteration.
+func (f *faultState) setIteration(iteration uint64) {
+	f.iteration = iteration
+	f.haveIteration = true
+}
+
+// Returns the current time in iterations, or in packets if the iteration is unknown.
+func (f *faultState) clock() uint64 {
+	if f.haveIteration {
+		return f.iteration
+	}
+	return f.packets
+}
+
+func (f *faultState) applyTiming(msg interface{}) {
+	f.packets++
+	switch f.model.Kind {
+	case FaultDelay:
+		f.delay(msg)
+	case FaultDrop:
+		if f.rand.Float64() < f.model.Magnitude {
+			f.withhold(msg)
+		} else {
+			f.deliver(msg, msg)
+		}
+	case FaultReorder:
+		f.reorder(msg)
+	}
+}
+
+// Replaces msg with the oldest held packet that is at least the delay old.
+// Packets are only ever delayed, never lost: if several are due at once (e.g. a
+// sensor sends more than one packet per iteration), the rest stay queued and go
+// out in order on the following requests.
+func (f *faultState) delay(msg interface{}) {
+	now := f.clock()
+	f.pending = append(f.pending, heldPacket{at: now, packet: copyPacket(msg)})
+
+	oldest := f.pending[0]
+	if oldest.at+uint64(f.model.Magnitude) > now {
+		f.withhold(msg)
+		return
+	}
+	f.deliver(msg, oldest.packet)
+	f.pending = f.pending[1:]
+}
+
+// Replaces msg with a random packet from a full window of held packets.
+func (f *faultState) reorder(msg interface{}) {
+	f.pending = append(f.pending, heldPacket{at: f.clock(), packet: copyPacket(msg)})
+	if len(f.pending) < int(f.model.Magnitude) {
+		f.withhold(msg)
+		return
+	}
+
+	chosen := f.rand.Intn(len(f.pending))
+	f.deliver(msg, f.pending[chosen].packet)
+	f.pending = append(f.pending[:chosen], f.pending[chosen+1:]...)
+}
+
+// Overwrites msg with packet and remembers it as the last packet let through.
+func (f *faultState) deliver(msg, packet interface{}) {
+	if msg != packet {
+		reflect.ValueOf(msg).Elem().Set(reflect.ValueOf(packet).Elem())
+	}
+	f.lastDelivered = copyPacket(msg)
+}
+
+// Answers msg without delivering it.
+func (f *faultState) withhold(msg interface{}) {
+	val := reflect.ValueOf(msg).Elem()
+	if ignore := val.FieldByName("Ignore"); ignore.IsValid() {
+		ignore.SetUint(1)
+	} else if f.lastDelivered != nil {
+		val.Set(reflect.ValueOf(f.lastDelivered).Elem())
+	}
+}
+
+// Returns a pointer to a copy of the packet msg points to.
+func copyPacket(msg interface{}) interface{} {
+	val := reflect.ValueOf(msg).Elem()
+	copied := reflect.New(val.Type())
+	copied.Elem().Set(val)
+	return copied.Interface()
+}
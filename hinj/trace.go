@@ -0,0 +1,170 @@
+package hinj
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"time"
+)
+
+/*
+ * A trace is a compact binary log of every packet the server sent back to
+ * the autopilot. It begins with traceMagic, followed by records laid out as:
+ *   iteration (8 bytes) | wall time in ns (8 bytes) | type (1 byte) |
+ *   payload size (4 bytes) | payload
+ * The payload is the packed packet, exactly as it went over the wire.
+ */
+
+const (
+	traceMagic              = "HINJTRC1"
+	traceRecordPreambleSize = 21
+
+	// no packet comes close to this; anything larger is a corrupt trace
+	maxTracePayloadSize = 1 << 16
+)
+
+type TraceRecord struct {
+	// the simulator iteration the packet was seen at
+	Iteration uint64
+	Time      time.Time
+	Type      Sensor
+	Payload   []byte
+}
+
+// Returns the packet stored in the record.
+func (r *TraceRecord) Message() (interface{}, error) {
+	return decodeMessage(r.Type, r.Payload)
+}
+
+type TraceWriter struct {
+	writer *bufio.Writer
+}
+
+// Returns a TraceWriter that writes a trace to writer.
+// The trace is buffered; call Flush() before closing writer.
+func NewTraceWriter(writer io.Writer) (*TraceWriter, error) {
+	traceWriter := TraceWriter{writer: bufio.NewWriter(writer)}
+	if _, err := traceWriter.writer.WriteString(traceMagic); err != nil {
+		return nil, fmt.Errorf("NewTraceWriter(): %s", err)
+	}
+	return &traceWriter, nil
+}
+
+func (t *TraceWriter) Write(record TraceRecord) error {
+	var preamble [traceRecordPreambleSize]byte
+	wireByteOrder.PutUint64(preamble[0:8], record.Iteration)
+	wireByteOrder.PutUint64(preamble[8:16], uint64(record.Time.UnixNano()))
+	preamble[16] = byte(record.Type)
+	wireByteOrder.PutUint32(preamble[17:21], uint32(len(record.Payload)))
+	if _, err := t.writer.Write(preamble[:]); err != nil {
+		return err
+	}
+	_, err := t.writer.Write(record.Payload)
+	return err
+}
+
+func (t *TraceWriter) Flush() error {
+	return t.writer.Flush()
+}
+
+// how many records may wait for a traceRecorder's writer before new ones are dropped
+const traceQueueSize = 1 << 14
+
+// Writes records to a TraceWriter from its own goroutine, so that the server
+// never waits on the disk while it holds its lock.
+type traceRecorder struct {
+	writer *TraceWriter
+	queue  chan TraceRecord
+	done   chan struct{}
+	// the records that did not fit in the queue; only touched by the sender
+	dropped uint64
+	// the first error writing the trace; only touched by the writer
+	err error
+}
+
+func newTraceRecorder(writer *TraceWriter) *traceRecorder {
+	recorder := &traceRecorder{
+		writer: writer,
+		queue:  make(chan TraceRecord, traceQueueSize),
+		done:   make(chan struct{}),
+	}
+	go recorder.write()
+	return recorder
+}
+
+// Queues record for the writer. Never blocks; if the writer has fallen behind, record is dropped.
+func (r *traceRecorder) record(record TraceRecord) {
+	select {
+	case r.queue <- record:
+	default:
+		r.dropped++
+	}
+}
+
+func (r *traceRecorder) write() {
+	defer close(r.done)
+	for record := range r.queue {
+		if err := r.writer.Write(record); err != nil && r.err == nil {
+			r.err = err
+			log.Printf("traceRecorder.write(): error: %s\n", err)
+		}
+	}
+	if err := r.writer.Flush(); err != nil && r.err == nil {
+		r.err = err
+	}
+}
+
+// Writes the queued records and flushes the trace. record must not be called afterwards.
+// Returns the first error writing the trace, or else an error if records were dropped.
+func (r *traceRecorder) close() error {
+	close(r.queue)
+	<-r.done
+	if r.err == nil && r.dropped != 0 {
+		return fmt.Errorf("dropped %d packets the trace writer could not keep up with", r.dropped)
+	}
+	return r.err
+}
+
+type TraceReader struct {
+	reader *bufio.Reader
+}
+
+// Returns a TraceReader that reads the trace in reader.
+func NewTraceReader(reader io.Reader) (*TraceReader, error) {
+	traceReader := TraceReader{reader: bufio.NewReader(reader)}
+	var magic [len(traceMagic)]byte
+	if _, err := io.ReadFull(traceReader.reader, magic[:]); err != nil {
+		return nil, fmt.Errorf("NewTraceReader(): %s", err)
+	} else if string(magic[:]) != traceMagic {
+		return nil, fmt.Errorf("NewTraceReader(): not a HINJ trace")
+	}
+	return &traceReader, nil
+}
+
+// Reads the next record.
+// Returns io.EOF once every record has been read.
+func (t *TraceReader) Read() (TraceRecord, error) {
+	var preamble [traceRecordPreambleSize]byte
+	if _, err := io.ReadFull(t.reader, preamble[:]); err == io.EOF {
+		return TraceRecord{}, io.EOF
+	} else if err != nil {
+		return TraceRecord{}, fmt.Errorf("TraceReader.Read(): %s", err)
+	}
+
+	payloadSize := wireByteOrder.Uint32(preamble[17:21])
+	if payloadSize > maxTracePayloadSize {
+		return TraceRecord{}, fmt.Errorf("TraceReader.Read(): payload of %d bytes is too large", payloadSize)
+	}
+
+	record := TraceRecord{
+		Iteration: wireByteOrder.Uint64(preamble[0:8]),
+		Time:      time.Unix(0, int64(wireByteOrder.Uint64(preamble[8:16]))),
+		Type:      Sensor(preamble[16]),
+		Payload:   make([]byte, payloadSize),
+	}
+	if _, err := io.ReadFull(t.reader, record.Payload); err != nil {
+		return TraceRecord{}, fmt.Errorf("TraceReader.Read(): reading payload: %s", err)
+	}
+	return record, nil
+}
@@ -0,0 +1,138 @@
+package hinj
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestUnitTraceRoundTrip(t *testing.T) {
+	var buffer bytes.Buffer
+	writer, err := NewTraceWriter(&buffer)
+	if err != nil {
+		t.Fatalf("NewTraceWriter() returned an unexpected error: %s", err)
+	}
+
+	_, payload, _ := encodePayload(&GPSPacket{Instance: 2, Latitude: -353632610})
+	expected := TraceRecord{Iteration: 42, Time: time.Unix(10, 20), Type: GPS, Payload: payload}
+	if err := writer.Write(expected); err != nil {
+		t.Fatalf("Write() returned an unexpected error: %s", err)
+	}
+	writer.Flush()
+
+	reader, err := NewTraceReader(&buffer)
+	if err != nil {
+		t.Fatalf("NewTraceReader() returned an unexpected error: %s", err)
+	}
+	actual, err := reader.Read()
+	if err != nil {
+		t.Fatalf("Read() returned an unexpected error: %s", err)
+	} else if actual.Iteration != 42 || !actual.Time.Equal(expected.Time) || actual.Type != GPS {
+		t.Fatalf("unexpected record: %+v", actual)
+	} else if !bytes.Equal(actual.Payload, payload) {
+		t.Fatalf("payload changed in the round trip")
+	}
+
+	msg, err := actual.Message()
+	if err != nil {
+		t.Fatalf("Message() returned an unexpected error: %s", err)
+	} else if gps := msg.(*GPSPacket); gps.Instance != 2 || gps.Latitude != -353632610 {
+		t.Fatalf("unexpected packet: %+v", gps)
+	}
+
+	if _, err := reader.Read(); err != io.EOF {
+		t.Fatalf("expected io.EOF at the end of the trace, found %v", err)
+	}
+}
+
+func TestUnitTraceReaderRejectsGarbage(t *testing.T) {
+	if _, err := NewTraceReader(bytes.NewBufferString("not a trace")); err == nil {
+		t.Fatalf("NewTraceReader() accepted a file without the trace magic")
+	}
+}
+
+func TestUnitServerRecordAndReplay(t *testing.T) {
+	server, shutdown := startTestServer(t)
+	defer shutdown()
+
+	var trace bytes.Buffer
+	iteration := uint64(0)
+	server.SetIterationSource(func() uint64 { return iteration })
+	if err := server.StartRecording(&trace); err != nil {
+		t.Fatalf("StartRecording() returned an unexpected error: %s", err)
+	}
+
+	// the recording holds the packets as the autopilot saw them, so the bias shows up
+	server.InjectFault(SensorFailure{SensorType: Barometer, Model: FaultModel{Kind: FaultBias, Magnitude: 1}})
+	for iteration = 0; iteration < 3; iteration++ {
+		sendOneShot(t, server, &BarometerPacket{Pressure: float32(iteration)})
+	}
+	if err := server.StopRecording(); err != nil {
+		t.Fatalf("StopRecording() returned an unexpected error: %s", err)
+	}
+	server.RestoreSensor(Barometer, 0)
+
+	if err := server.StartReplay(bytes.NewReader(trace.Bytes())); err != nil {
+		t.Fatalf("StartReplay() returned an unexpected error: %s", err)
+	}
+	for i := 0; i < 3; i++ {
+		reply := sendOneShot(t, server, &BarometerPacket{Pressure: 100})
+		if baro := reply.(*BarometerPacket); baro.Pressure != float32(i+1) {
+			t.Fatalf("replay %d: expected pressure %d, found %f", i, i+1, baro.Pressure)
+		}
+	}
+
+	// the recording has run out, so live readings pass through
+	reply := sendOneShot(t, server, &BarometerPacket{Pressure: 100})
+	if baro := reply.(*BarometerPacket); baro.Pressure != 100 {
+		t.Fatalf("expected the live reading once the replay ran out, found %f", baro.Pressure)
+	}
+}
+
+// A writer that blocks until release is closed, like a stalled disk.
+type stalledWriter struct {
+	release chan struct{}
+	buffer  bytes.Buffer
+}
+
+func (w *stalledWriter) Write(p []byte) (int, error) {
+	<-w.release
+	return w.buffer.Write(p)
+}
+
+func TestUnitServerRecordingDoesNotStall(t *testing.T) {
+	server, shutdown := startTestServer(t)
+	defer shutdown()
+
+	writer := &stalledWriter{release: make(chan struct{})}
+	if err := server.StartRecording(writer); err != nil {
+		t.Fatalf("StartRecording() returned an unexpected error: %s", err)
+	}
+
+	// unstalls the disk if the server waits on it, so that a failure does not hang the test
+	watchdog := time.AfterFunc(5*time.Second, func() { close(writer.release) })
+
+	// far more than the trace writer buffers, so the disk is hit
+	const packets = 500
+	for i := 0; i < packets; i++ {
+		sendOneShot(t, server, &BarometerPacket{Pressure: float32(i)})
+	}
+	if !watchdog.Stop() {
+		t.Fatalf("the server waited on a stalled recording")
+	}
+	close(writer.release)
+
+	if err := server.StopRecording(); err != nil {
+		t.Fatalf("StopRecording() returned an unexpected error: %s", err)
+	}
+	reader, err := NewTraceReader(&writer.buffer)
+	if err != nil {
+		t.Fatalf("NewTraceReader() returned an unexpected error: %s", err)
+	}
+	for i := 0; i < packets; i++ {
+		if _, err := reader.Read(); err != nil {
+			t.Fatalf("expected %d records, found %d: %s", packets, i, err)
+		}
+	}
+}
@@ -11,52 +11,72 @@ type HINJWriter struct {
 	writer io.Writer
 }
 
+// Writes a message to a one-shot connection.
 func (h *HINJWriter) WriteMessage(msg interface{}) error {
-	sensor := BadType
-	ok := false
-	switch msg.(type) {
-	case *GPSPacket:
-		ok = true
-		sensor = GPS
-	case *AccelerometerPacket:
-		ok = true
-		sensor = Accelerometer
-	case *GyroscopePacket:
-		ok = true
-		sensor = Gyroscope
-	case *BatteryPacket:
-		ok = true
-		sensor = Battery
-	case *ModePacket:
-		ok = true
-		sensor = Mode
-	case *BarometerPacket:
-		ok = true
-		sensor = Barometer
-	case *CompassPacket:
-		ok = true
-		sensor = Compass
+	bytes, err := encodeMessage(msg, msgPreambleSize)
+	if err != nil {
+		return err
 	}
 
-	if !ok {
-		return fmt.Errorf("error: WriteMessage(): unrecognized type")
+	_, err = h.writer.Write(bytes)
+	return err
+}
+
+// Writes a message to a stream, tagged with the sequence number seq.
+func (h *HINJWriter) WriteStreamMessage(seq uint32, msg interface{}) error {
+	bytes, err := encodeMessage(msg, streamPreambleSize)
+	if err != nil {
+		return err
+	}
+
+	wireByteOrder.PutUint32(bytes[5:9], seq)
+	_, err = h.writer.Write(bytes)
+	return err
+}
+
+// Encodes msg after a preamble of preambleSize bytes.
+// Only the type and size of the preamble are filled in.
+func encodeMessage(msg interface{}, preambleSize int) ([]byte, error) {
+	sensor, err := MessageType(msg)
+	if err != nil {
+		return nil, err
 	}
 
 	// the way we designed our packets implies there is never an error
 	size, _ := util.PackedStructSize(msg)
 
-	bytes := make([]byte, size+msgPreambleSize)
+	bytes := make([]byte, size+preambleSize)
 
 	// writes the preamble
 	bytes[0] = byte(sensor)
-	util.HostByteOrder.PutUint32(bytes[1:5], uint32(size+msgPreambleSize))
+	wireByteOrder.PutUint32(bytes[1:5], uint32(size+preambleSize))
 
 	// writes the rest of the packet
-	util.PackedStructToBytes(bytes[msgPreambleSize:], msg)
+	util.PackedStructToBytes(bytes[preambleSize:], msg, wireByteOrder)
 
-	h.writer.Write(bytes)
+	return bytes, nil
+}
 
-	return nil
+// Encodes msg without any preamble.
+func encodePayload(msg interface{}) (Sensor, []byte, error) {
+	sensor, err := MessageType(msg)
+	if err != nil {
+		return BadType, nil, err
+	}
+
+	size, _ := util.PackedStructSize(msg)
+	bytes := make([]byte, size)
+	util.PackedStructToBytes(bytes, msg, wireByteOrder)
+	return sensor, bytes, nil
+}
+
+// Returns the type of msg, which must be a pointer to a registered packet.
+func MessageType(msg interface{}) (Sensor, error) {
+	packetType, ok := packetTypeOf(msg)
+	if !ok {
+		return BadType, fmt.Errorf("error: WriteMessage(): unrecognized type %T", msg)
+	}
+	return packetType.ID, nil
 }
 
 func NewHINJWriter(writer io.Writer) *HINJWriter {
@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"strconv"
 	"time"
 
 	"github.com/obicons/avis/sim"
@@ -18,6 +19,7 @@ type ArduPilot struct {
 	srcPath         string
 	gazeboSrcPath   string
 	droneSignalPath string
+	instance        Instance
 	cmd             *exec.Cmd
 	mavproxy        *exec.Cmd
 	logger          *log.Logger
@@ -26,7 +28,18 @@ type ArduPilot struct {
 
 const droneSignalTimeout = time.Millisecond * 250
 
+// how often Ready checks for the signal socket
+const droneSignalPollInterval = time.Millisecond * 50
+
+// ArduPilot's -I option offsets every port an instance uses by this much per instance.
+const ardupilotPortStride = 10
+
 func NewArduPilotFromEnv() (System, error) {
+	return NewArduPilotInstanceFromEnv(Instance{})
+}
+
+// Returns an ArduPilot that runs as the given instance, alongside others.
+func NewArduPilotInstanceFromEnv(instance Instance) (System, error) {
 	// get the environment variable
 	srcPath := os.Getenv("ARDUPILOT_SRC_PATH")
 	if srcPath == "" {
@@ -52,18 +65,22 @@ func NewArduPilotFromEnv() (System, error) {
 		return nil, fmt.Errorf("error: ARDUPILOT_GZ_PATH (%s) must be a dir", gzPath)
 	}
 
-	logger, err := util.GetLogger("ArduPilot Controller")
+	logger, err := util.GetLogger(instance.LogPrefix() + "ArduPilot Controller")
 	if err != nil {
 		return nil, fmt.Errorf("error: NewArduPilotFromEnv(): %s", err)
 	}
 
-	homedir, _ := os.UserHomeDir()
-	droneSignalPath := path.Join(homedir, ".drone_signal")
+	socketDir := instance.Dir
+	if socketDir == "" {
+		socketDir, _ = os.UserHomeDir()
+	}
+	droneSignalPath := path.Join(socketDir, ".drone_signal")
 
 	ardupilot := ArduPilot{
 		srcPath:         srcPath,
 		gazeboSrcPath:   gzPath,
 		droneSignalPath: droneSignalPath,
+		instance:        instance,
 		logger:          logger,
 	}
 	return &ardupilot, nil
@@ -71,6 +88,9 @@ func NewArduPilotFromEnv() (System, error) {
 
 // implements System
 func (a *ArduPilot) Start() error {
+	// a signal socket left by a previous run would make us look ready
+	os.Remove(a.droneSignalPath)
+
 	err := a.startArduPilot()
 	if err != nil {
 		return err
@@ -85,15 +105,41 @@ func (a *ArduPilot) Start() error {
 	return err
 }
 
+// implements System
+// ArduPilot is ready once it listens on its signal socket.
+func (a *ArduPilot) Ready(ctx context.Context) error {
+	err := util.WaitUntil(ctx, droneSignalPollInterval, func() bool {
+		info, err := os.Stat(a.droneSignalPath)
+		return err == nil && info.Mode()&os.ModeSocket != 0
+	})
+	if err != nil {
+		return fmt.Errorf("ArduPilot did not create %s: %s", a.droneSignalPath, err)
+	}
+	return nil
+}
+
+// Returns the port the first instance would use, offset for this instance.
+func (a *ArduPilot) port(base int) int {
+	return base + a.instance.ID*ardupilotPortStride
+}
+
+// Returns where SITL runs.
+// SITL keeps its parameters and logs in its working directory, so instances must not share one.
+func (a *ArduPilot) workDir() string {
+	if a.instance.Dir != "" {
+		return a.instance.Dir
+	}
+	return a.srcPath
+}
+
 func (a *ArduPilot) startArduPilot() error {
-	workDir := path.Join(a.srcPath)
 	defaultsFlag := path.Join(a.srcPath, "Tools/autotest/default_params/copter.parm") +
 		"," + path.Join(a.srcPath, "Tools/autotest/default_params/gazebo-iris.parm")
 
 	cmd := exec.Command(
 		path.Join(a.srcPath, "build/sitl/bin/arducopter"),
 		"-S",
-		"-I0",
+		"-I"+strconv.Itoa(a.instance.ID),
 		"--home",
 		"-35.363261,149.165230,584,353",
 		"--model",
@@ -103,11 +149,11 @@ func (a *ArduPilot) startArduPilot() error {
 		"--defaults",
 		defaultsFlag,
 	)
-	cmd.Dir = workDir
-	cmd.Env = os.Environ()
+	cmd.Dir = a.workDir()
+	cmd.Env = append(os.Environ(), a.instance.environ()...)
 	cmd.Stdin = os.Stdin
 
-	logging, err := util.GetLogger("ardupilot ")
+	logging, err := util.GetLogger(a.instance.LogPrefix() + "ardupilot ")
 	if err != nil {
 		return err
 	}
@@ -127,20 +173,20 @@ func (a *ArduPilot) startMAVProxy() error {
 	cmd := exec.Command(
 		"./mavproxy.py",
 		"--master",
-		"tcp:127.0.0.1:5760",
+		fmt.Sprintf("tcp:127.0.0.1:%d", a.port(5760)),
 		"--sitl",
-		"127.0.0.1:5501",
+		fmt.Sprintf("127.0.0.1:%d", a.port(5501)),
 		"--out",
-		"127.0.0.1:14550",
+		fmt.Sprintf("127.0.0.1:%d", a.port(14550)),
 		"--out",
-		"127.0.0.1:14551",
+		fmt.Sprintf("127.0.0.1:%d", a.port(14551)),
 		"--console",
 	)
 	cmd.Dir = workDir
-	cmd.Env = os.Environ()
+	cmd.Env = append(os.Environ(), a.instance.environ()...)
 	cmd.Stdin = os.Stdin
 
-	logging, err := util.GetLogger("mavproxy ")
+	logging, err := util.GetLogger(a.instance.LogPrefix() + "mavproxy ")
 	if err != nil {
 		return err
 	}
@@ -176,9 +222,24 @@ func (a *ArduPilot) Shutdown(ctx context.Context) error {
 
 // implements System
 func (a *ArduPilot) GetGazeboConfig() (*sim.GazeboConfig, error) {
+	// the ArduPilot plugin must talk to this instance's SITL ports
+	worldPath, err := a.instance.worldPath(
+		path.Join(a.gazeboSrcPath, "worlds/iris_arducopter_runway.world"),
+		map[string]int{
+			"fdm_port_in":  a.port(0),
+			"fdm_port_out": a.port(0),
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("GetGazeboConfig(): %s", err)
+	}
+
 	config := sim.GazeboConfig{
 		WorkDir:         a.gazeboSrcPath,
-		WorldPath:       path.Join(a.gazeboSrcPath, "worlds/iris_arducopter_runway.world"),
+		WorldPath:       worldPath,
+		SocketDir:       a.instance.Dir,
+		LogPrefix:       a.instance.LogPrefix(),
+		Env:             a.instance.environ(),
 		PreStepActions:  []sim.StepActions{func() { a.checkDroneSignal(false) }},
 		PostStepActions: []sim.StepActions{func() { a.checkDroneSignal(true) }},
 		StepSize:        1000000,
@@ -186,6 +247,17 @@ func (a *ArduPilot) GetGazeboConfig() (*sim.GazeboConfig, error) {
 	return &config, nil
 }
 
+// implements FlightLogger
+// SITL writes dataflash logs to logs/ in its working directory.
+func (a *ArduPilot) FlightLogs(since time.Time) ([]string, error) {
+	return filesModifiedSince(path.Join(a.workDir(), "logs"), since, ".bin")
+}
+
+// implements System
+func (a *ArduPilot) MAVLinkAddr() string {
+	return fmt.Sprintf("udp:127.0.0.1:%d", a.port(14550))
+}
+
 // connects to the signal the drone is broadcasting
 func (a *ArduPilot) checkDroneSignal(isPostStep bool) {
 	socket, err := net.Dial("unix", a.droneSignalPath)
@@ -2,7 +2,10 @@ package platforms
 
 import (
 	"context"
+	"io/ioutil"
+	"net"
 	"os"
+	"path"
 	"testing"
 	"time"
 
@@ -70,7 +73,7 @@ func TestFunctionalArduPilot(t *testing.T) {
 
 	ctx, cc := context.WithTimeout(context.Background(), time.Second*5)
 	defer cc()
-	err = ardupilot.Stop(ctx)
+	err = ardupilot.Shutdown(ctx)
 	if err != nil {
 		t.Fatalf("ArduCopter could not stop: %s", err)
 	}
@@ -79,3 +82,30 @@ func TestFunctionalArduPilot(t *testing.T) {
 		t.Fatal("ArduCopter did not successfully stop")
 	}
 }
+
+func TestUnitArduPilotReady(t *testing.T) {
+	dir, err := ioutil.TempDir("", "avis-ardupilot")
+	if err != nil {
+		t.Fatalf("TempDir() returned an unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ardupilot := ArduPilot{droneSignalPath: path.Join(dir, ".drone_signal")}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err = ardupilot.Ready(ctx); err == nil {
+		t.Fatalf("expected Ready() to fail without a signal socket")
+	}
+
+	listener, err := net.Listen("unix", ardupilot.droneSignalPath)
+	if err != nil {
+		t.Fatalf("Listen() returned an unexpected error: %s", err)
+	}
+	defer listener.Close()
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err = ardupilot.Ready(ctx); err != nil {
+		t.Fatalf("Ready() returned an unexpected error: %s", err)
+	}
+}
@@ -2,6 +2,15 @@ package platforms
 
 import (
 	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/obicons/avis/sim"
 )
@@ -10,10 +19,139 @@ type System interface {
 	// starts the autopilot
 	Start() error
 
+	// blocks until the autopilot is ready to fly, or ctx is done
+	Ready(ctx context.Context) error
+
 	// stops the autopilot
 	Shutdown(ctx context.Context) error
 
 	// Gets the gazebo configuration.
 	// If gazebo is unsupported, return an error.
 	GetGazeboConfig() (*sim.GazeboConfig, error)
+
+	// returns the MAVLink address a workload reaches the vehicle on (e.g. udp:127.0.0.1:14550)
+	MAVLinkAddr() string
+}
+
+// Implemented by autopilots that write flight logs (e.g. ArduPilot's dataflash logs or PX4's ULogs).
+type FlightLogger interface {
+	// returns the flight logs written since the given time
+	FlightLogs(since time.Time) ([]string, error)
+}
+
+// Returns the files under dir with one of the given extensions, modified since the given time.
+// A missing dir holds no files.
+func filesModifiedSince(dir string, since time.Time, extensions ...string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		} else if info.IsDir() || info.ModTime().Before(since) {
+			return nil
+		}
+		for _, extension := range extensions {
+			if strings.EqualFold(filepath.Ext(filePath), extension) {
+				files = append(files, filePath)
+				break
+			}
+		}
+		return nil
+	})
+	return files, err
+}
+
+// Identifies one of several vehicles simulated side by side.
+// The zero value is a lone vehicle, using the default ports and $HOME.
+type Instance struct {
+	// offsets the ports the autopilot and its simulator use
+	ID int
+
+	// where the autopilot and simulator create their sockets and state; $HOME if empty
+	Dir string
+}
+
+// the directories under $HOME that Gazebo caches models and settings in
+var gazeboHomeDirs = []string{".gazebo", ".ignition"}
+
+// Creates the instance's directory, if it has one.
+// Gazebo looks for its model cache under $HOME, so the real cache is linked into it.
+func (i Instance) Prepare() error {
+	if i.Dir == "" {
+		return nil
+	} else if err := os.MkdirAll(i.Dir, 0777); err != nil {
+		return fmt.Errorf("error: Prepare(): %s", err)
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("error: Prepare(): %s", err)
+	}
+	for _, name := range gazeboHomeDirs {
+		target, link := path.Join(home, name), path.Join(i.Dir, name)
+		if _, err := os.Stat(target); err != nil {
+			continue
+		} else if _, err := os.Lstat(link); err == nil {
+			continue
+		}
+		if err := os.Symlink(target, link); err != nil {
+			return fmt.Errorf("error: Prepare(): %s", err)
+		}
+	}
+	return nil
+}
+
+// Returns the environment variables the instance's processes need.
+// Later entries of an exec.Cmd's Env win, so these are appended to os.Environ().
+func (i Instance) environ() []string {
+	var env []string
+	if i.Dir != "" {
+		env = append(env, "HOME="+i.Dir)
+	}
+	if i.ID != 0 {
+		// each gzserver needs its own master port
+		env = append(env, fmt.Sprintf("GAZEBO_MASTER_URI=http://127.0.0.1:%d", 11345+i.ID))
+	}
+	return env
+}
+
+// Returns what the log lines of the instance's processes begin with.
+// Instances with a directory run alongside others that share the log, so theirs are tagged.
+func (i Instance) LogPrefix() string {
+	if i.Dir == "" {
+		return ""
+	}
+	return fmt.Sprintf("worker-%d ", i.ID)
+}
+
+// Returns the world file the instance's simulator should load.
+// For every instance but the first, a copy of worldPath is written to the instance's
+// directory, with each port element named in portOffsets (e.g. fdm_port_in) offset.
+func (i Instance) worldPath(worldPath string, portOffsets map[string]int) (string, error) {
+	if i.ID == 0 {
+		return worldPath, nil
+	} else if i.Dir == "" {
+		return "", fmt.Errorf("error: instance %d has no directory for its world file", i.ID)
+	}
+
+	world, err := ioutil.ReadFile(worldPath)
+	if err != nil {
+		return "", err
+	}
+	for element, offset := range portOffsets {
+		pattern := regexp.MustCompile(fmt.Sprintf(`(<%s>\s*)(\d+)(\s*</%s>)`, element, element))
+		world = pattern.ReplaceAllFunc(world, func(match []byte) []byte {
+			parts := pattern.FindSubmatch(match)
+			port, _ := strconv.Atoi(string(parts[2]))
+			return []byte(fmt.Sprintf("%s%d%s", parts[1], port+offset, parts[3]))
+		})
+	}
+
+	instancePath := path.Join(i.Dir, path.Base(worldPath))
+	if err = ioutil.WriteFile(instancePath, world, 0666); err != nil {
+		return "", err
+	}
+	return instancePath, nil
 }
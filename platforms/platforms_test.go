@@ -0,0 +1,105 @@
+package platforms
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testWorld = `<sdf>
+  <plugin name="ardupilot_plugin" filename="libArduPilotPlugin.so">
+    <fdm_port_in>9002</fdm_port_in>
+    <fdm_port_out> 9003 </fdm_port_out>
+  </plugin>
+</sdf>
+`
+
+func TestUnitInstanceWorldPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "avis-instance")
+	if err != nil {
+		t.Fatalf("TempDir() returned an unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	worldPath := path.Join(dir, "runway.world")
+	if err = ioutil.WriteFile(worldPath, []byte(testWorld), 0666); err != nil {
+		t.Fatalf("WriteFile() returned an unexpected error: %s", err)
+	}
+	offsets := map[string]int{"fdm_port_in": 20, "fdm_port_out": 20}
+
+	if actual, err := (Instance{}).worldPath(worldPath, offsets); err != nil || actual != worldPath {
+		t.Fatalf("expected the first instance to use the world as is, found %s (%v)", actual, err)
+	}
+
+	instance := Instance{ID: 2, Dir: path.Join(dir, "worker-2")}
+	if err = instance.Prepare(); err != nil {
+		t.Fatalf("Prepare() returned an unexpected error: %s", err)
+	}
+	instancePath, err := instance.worldPath(worldPath, offsets)
+	if err != nil {
+		t.Fatalf("worldPath() returned an unexpected error: %s", err)
+	} else if path.Dir(instancePath) != instance.Dir {
+		t.Fatalf("expected the world to be written to %s, found %s", instance.Dir, instancePath)
+	}
+	world, err := ioutil.ReadFile(instancePath)
+	if err != nil {
+		t.Fatalf("ReadFile() returned an unexpected error: %s", err)
+	} else if !strings.Contains(string(world), "<fdm_port_in>9022</fdm_port_in>") ||
+		!strings.Contains(string(world), "<fdm_port_out> 9023 </fdm_port_out>") {
+		t.Fatalf("expected the ports to be offset by 20, found:\n%s", world)
+	}
+}
+
+func TestUnitInstanceEnviron(t *testing.T) {
+	if env := (Instance{}).environ(); len(env) != 0 {
+		t.Fatalf("expected a lone instance to keep the environment, found %v", env)
+	}
+	env := strings.Join(Instance{ID: 3, Dir: "/tmp/worker-3"}.environ(), " ")
+	if !strings.Contains(env, "HOME=/tmp/worker-3") || !strings.Contains(env, "GAZEBO_MASTER_URI=http://127.0.0.1:11348") {
+		t.Fatalf("unexpected environment: %s", env)
+	}
+}
+
+func TestUnitInstanceLogPrefix(t *testing.T) {
+	if prefix := (Instance{}).LogPrefix(); prefix != "" {
+		t.Fatalf("expected a lone instance's log lines to be untagged, found %q", prefix)
+	} else if prefix = (Instance{ID: 3, Dir: "/tmp/worker-3"}).LogPrefix(); prefix != "worker-3 " {
+		t.Fatalf("unexpected log prefix: %q", prefix)
+	}
+}
+
+func TestUnitFilesModifiedSince(t *testing.T) {
+	dir, err := ioutil.TempDir("", "avis-logs")
+	if err != nil {
+		t.Fatalf("TempDir() returned an unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	since := time.Now().Add(-time.Minute)
+	for _, name := range []string{"old.bin", "00000001.BIN", "notes.txt", "nested/00000002.bin"} {
+		filePath := path.Join(dir, name)
+		if err = os.MkdirAll(path.Dir(filePath), 0777); err != nil {
+			t.Fatalf("MkdirAll() returned an unexpected error: %s", err)
+		} else if err = ioutil.WriteFile(filePath, nil, 0666); err != nil {
+			t.Fatalf("WriteFile() returned an unexpected error: %s", err)
+		}
+	}
+	old := since.Add(-time.Hour)
+	if err = os.Chtimes(path.Join(dir, "old.bin"), old, old); err != nil {
+		t.Fatalf("Chtimes() returned an unexpected error: %s", err)
+	}
+
+	files, err := filesModifiedSince(dir, since, ".bin")
+	if err != nil {
+		t.Fatalf("filesModifiedSince() returned an unexpected error: %s", err)
+	} else if len(files) != 2 || path.Base(files[0]) != "00000001.BIN" || path.Base(files[1]) != "00000002.bin" {
+		t.Fatalf("expected the two new .bin files, found %v", files)
+	}
+
+	if files, err = filesModifiedSince(path.Join(dir, "missing"), since, ".bin"); err != nil || len(files) != 0 {
+		t.Fatalf("expected no files in a missing directory, found %v, %v", files, err)
+	}
+}
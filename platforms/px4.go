@@ -6,6 +6,10 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/creack/pty"
 	"github.com/obicons/avis/sim"
@@ -13,12 +17,23 @@ import (
 )
 
 type PX4 struct {
-	srcPath string
-	cmd     *exec.Cmd
-	pty     *os.File
+	srcPath  string
+	instance Instance
+	cmd      *exec.Cmd
+	pty      *os.File
+	// closed once PX4 reports that the simulator connected
+	ready chan struct{}
 }
 
+// PX4 prints this once the simulator connects to it (see simulator_mavlink.cpp).
+const px4ReadyMarker = "Simulator connected"
+
 func NewPX4FromEnv() (System, error) {
+	return NewPX4InstanceFromEnv(Instance{})
+}
+
+// Returns a PX4 that runs as the given instance, alongside others.
+func NewPX4InstanceFromEnv(instance Instance) (System, error) {
 	px4Path := os.Getenv("PX4_PATH")
 	if px4Path == "" {
 		return nil, fmt.Errorf("error: NewPX4FromEnv(): set PX4_PATH")
@@ -27,8 +42,9 @@ func NewPX4FromEnv() (System, error) {
 	}
 
 	px4 := PX4{
-		srcPath: px4Path,
-		cmd:     nil,
+		srcPath:  px4Path,
+		instance: instance,
+		cmd:      nil,
 	}
 
 	return &px4, nil
@@ -40,11 +56,17 @@ func (px4 *PX4) Start() error {
 	romfsPath := path.Join(px4.srcPath, "ROMFS/px4fmu_common")
 	rcPath := path.Join(px4.srcPath, "etc/init.d-posix/rcS")
 	testDataPath := path.Join(px4.srcPath, "test_data")
-	rootFs := path.Join(px4.srcPath, "tmp/rootfs")
+	rootFs := px4.rootFs()
 	if _, err := os.Stat(binaryPath); err != nil {
 		return fmt.Errorf("error: Start(): build px4")
 	}
 
+	if px4.instance.ID != 0 {
+		if err := os.MkdirAll(rootFs, 0777); err != nil {
+			return fmt.Errorf("error: Start(): %s", err)
+		}
+	}
+
 	cmd := exec.Command(
 		binaryPath,
 		"-d", // disable user input
@@ -53,11 +75,13 @@ func (px4 *PX4) Start() error {
 		rcPath,
 		"-t", // set test data
 		testDataPath,
+		"-i", // offsets the instance's ports
+		strconv.Itoa(px4.instance.ID),
 	)
 	cmd.Dir = rootFs
-	cmd.Env = px4Environ()
+	cmd.Env = append(px4Environ(), px4.instance.environ()...)
 
-	logging, err := util.GetLogger("px4 ")
+	logging, err := util.GetLogger(px4.instance.LogPrefix() + "px4 ")
 	if err != nil {
 		return err
 	}
@@ -67,11 +91,48 @@ func (px4 *PX4) Start() error {
 		px4.cmd = cmd
 	}
 
-	util.LogReader(px4.pty, logging)
+	ready := make(chan struct{})
+	var readyOnce sync.Once
+	px4.ready = ready
+	util.WatchReader(px4.pty, logging, func(line string) {
+		if strings.Contains(line, px4ReadyMarker) {
+			readyOnce.Do(func() { close(ready) })
+		}
+	})
 
 	return err
 }
 
+// Returns where PX4 runs.
+// PX4 keeps its parameters and logs in its working directory, so instances must not share one.
+func (px4 *PX4) rootFs() string {
+	rootFs := path.Join(px4.srcPath, "tmp/rootfs")
+	if px4.instance.ID != 0 {
+		rootFs = path.Join(rootFs, fmt.Sprintf("instance_%d", px4.instance.ID))
+	}
+	return rootFs
+}
+
+// implements FlightLogger
+// PX4 writes ULogs to log/<date>/ in its working directory.
+func (px4 *PX4) FlightLogs(since time.Time) ([]string, error) {
+	return filesModifiedSince(path.Join(px4.rootFs(), "log"), since, ".ulg")
+}
+
+// implements System
+// PX4 is ready once the simulator has connected to it.
+func (px4 *PX4) Ready(ctx context.Context) error {
+	if px4.ready == nil {
+		return fmt.Errorf("PX4 has not been started")
+	}
+	select {
+	case <-px4.ready:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("PX4 did not report %q: %s", px4ReadyMarker, ctx.Err())
+	}
+}
+
 // implements System
 func (px4 *PX4) Shutdown(ctx context.Context) error {
 	return util.GracefulStop(px4.cmd, ctx)
@@ -88,19 +149,44 @@ func (px4 *PX4) GetGazeboConfig() (*sim.GazeboConfig, error) {
 	modelPath := path.Join(px4.srcPath, "Tools/sitl_gazebo/models")
 	ldLibraryPath := path.Join(px4.srcPath, "build_gazebo")
 
+	// the simulator's MAVLink ports must match the instance's; this only
+	// rewrites ports set in the world file itself, not in included models
+	worldfilePath, err := px4.instance.worldPath(
+		worldfilePath,
+		map[string]int{
+			"mavlink_tcp_port": px4.instance.ID,
+			"mavlink_udp_port": px4.instance.ID,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("GetGazeboConfig(): %s", err)
+	}
+
 	conf := sim.GazeboConfig{
 		WorldPath: worldfilePath,
-		Env: []string{
+		Env: append([]string{
 			fmt.Sprintf("GAZEBO_PLUGIN_PATH=%s", pluginPath),
 			fmt.Sprintf("GAZEBO_MODEL_PATH=%s", modelPath),
 			fmt.Sprintf("LD_LIBRARY_PATH=%s", ldLibraryPath),
-		},
-		WorkDir:  px4.srcPath,
-		StepSize: 4000000,
+		}, px4.instance.environ()...),
+		WorkDir:   px4.srcPath,
+		SocketDir: px4.instance.Dir,
+		LogPrefix: px4.instance.LogPrefix(),
+		StepSize:  4000000,
 	}
 	return &conf, nil
 }
 
+// implements System
+func (px4 *PX4) MAVLinkAddr() string {
+	// every instance sends to the same ground station port, so the others are
+	// reached through their offboard ports
+	if px4.instance.ID == 0 {
+		return "udp:127.0.0.1:14550"
+	}
+	return fmt.Sprintf("udp:127.0.0.1:%d", 14540+px4.instance.ID)
+}
+
 // returns environment variables needed by PX4
 func px4Environ() []string {
 	env := os.Environ()
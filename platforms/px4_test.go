@@ -53,7 +53,7 @@ func TestFunctionalPX4(t *testing.T) {
 
 	time.Sleep(time.Second * 10)
 
-	if err = px4.Stop(context.Background()); err != nil {
-		t.Fatalf("px4.Stop() returned an unexpected error: %s", err)
+	if err = px4.Shutdown(context.Background()); err != nil {
+		t.Fatalf("px4.Shutdown() returned an unexpected error: %s", err)
 	}
 }
@@ -11,6 +11,7 @@ import (
 	"os/exec"
 	"path"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/creack/pty"
@@ -18,7 +19,15 @@ import (
 	"github.com/obicons/avis/util"
 )
 
+// The byte order of every value on the avis plugin's sockets (time, step and position).
+// The plugin has always framed them little-endian, so they are decoded the same way
+// whatever machine avis runs on.
+var gazeboByteOrder = binary.LittleEndian
+
 type Gazebo struct {
+	// the steps taken since Start; HINJ reads it while the controller steps, so it is
+	// only accessed atomically (and comes first, so it is 64-bit aligned on 32-bit targets)
+	TotalIterations uint64
 	sync.Mutex
 	ExecutablePath           string
 	Config                   *GazeboConfig
@@ -27,7 +36,6 @@ type Gazebo struct {
 	TimePath                 string
 	StepPath                 string
 	PositionPath             string
-	TotalIterations          uint64
 	PTY                      *os.File
 	TemporaryPostStepActions []StepActions
 	lastTimeUpdate           int
@@ -52,6 +60,13 @@ type GazeboConfig struct {
 
 	// Length of each unit of simulation
 	StepSize uint64
+
+	// Where the avis plugin creates its sockets; $HOME if empty.
+	// Gazebo runs with $HOME set to it, so instances can run side by side.
+	SocketDir string
+
+	// What Gazebo's log lines begin with, to tell instances apart.
+	LogPrefix string
 }
 
 // implements sim.Sim
@@ -61,8 +76,11 @@ func (gazebo *Gazebo) Start() error {
 	cmd.Dir = gazebo.Config.WorkDir
 	cmd.Env = append(os.Environ(), []string{"DISPLAY=:0", "LC_ALL=C"}...)
 	cmd.Env = append(cmd.Env, gazebo.Config.Env...)
+	if gazebo.Config.SocketDir != "" {
+		cmd.Env = append(cmd.Env, "HOME="+gazebo.Config.SocketDir)
+	}
 
-	logging, err := util.GetLogger("gazebo ")
+	logging, err := util.GetLogger(gazebo.Config.LogPrefix + "gazebo ")
 	if err != nil {
 		return err
 	}
@@ -77,7 +95,16 @@ func (gazebo *Gazebo) Start() error {
 	gazebo.PTY = pty
 	util.LogReader(pty, logging)
 	gazebo.Cmd = cmd
-	gazebo.TotalIterations = 0
+	atomic.StoreUint64(&gazebo.TotalIterations, 0)
+	return nil
+}
+
+// implements sim.Sim
+// Gazebo is ready once the avis plugin answers on its time socket.
+func (gazebo *Gazebo) Ready(ctx context.Context) error {
+	if _, err := gazebo.SimTime(ctx); err != nil {
+		return fmt.Errorf("gazebo did not answer on %s: %s", gazebo.TimePath, err)
+	}
 	return nil
 }
 
@@ -133,14 +160,14 @@ func (gazebo *Gazebo) SimTime(ctx context.Context) (time.Time, error) {
 				break
 			}
 
-			seconds := int64(binary.LittleEndian.Uint64(bytes[0:8]))
-			microseconds := int64(binary.LittleEndian.Uint64(bytes[8:16]))
+			seconds := int64(gazeboByteOrder.Uint64(bytes[0:8]))
+			microseconds := int64(gazeboByteOrder.Uint64(bytes[8:16]))
 			gzTime = time.Unix(seconds, microseconds*1000)
 			tryToConnect = false
 
 			// update the time cache
 			gazebo.lastTime = gzTime
-			gazebo.lastTimeUpdate = int(gazebo.TotalIterations)
+			gazebo.lastTimeUpdate = int(gazebo.Iterations())
 		}
 	}
 	return gzTime, err
@@ -165,10 +192,10 @@ func (g *Gazebo) Step(ctx context.Context) error {
 			}
 
 			var bytes []byte = make([]byte, 8)
-			g.TotalIterations += 1
-			binary.LittleEndian.PutUint64(
+			iterations := atomic.AddUint64(&g.TotalIterations, 1)
+			gazeboByteOrder.PutUint64(
 				bytes,
-				uint64(g.TotalIterations*g.Config.StepSize),
+				uint64(iterations*g.Config.StepSize),
 			)
 			_, err = addr.Write(bytes)
 			addr.Close()
@@ -212,7 +239,7 @@ func (g *Gazebo) Position(ctx context.Context) (entities.Position, error) {
 
 			// this should never fail (see the test case in sim_test.go)
 			conn.Close()
-			util.ReadPackedStruct(positionBytes[:], &position)
+			util.ReadPackedStruct(positionBytes[:], &position, gazeboByteOrder)
 			keepTrying = false
 		}
 	}
@@ -225,13 +252,13 @@ func (g *Gazebo) AddPostStepAction(action StepActions) {
 }
 
 // implements sim.Sim
-// safe to call from a post-step action.
+// safe to call from a post-step action, and from any goroutine.
 func (g *Gazebo) Iterations() uint64 {
-	return g.TotalIterations
+	return atomic.LoadUint64(&g.TotalIterations)
 }
 
 func (g *Gazebo) checkTimeCache() (bool, time.Time) {
-	if g.lastTimeUpdate != -1 && uint64(g.lastTimeUpdate) == g.TotalIterations {
+	if g.lastTimeUpdate != -1 && uint64(g.lastTimeUpdate) == g.Iterations() {
 		return true, g.lastTime
 	}
 	return false, time.Time{}
@@ -261,9 +288,13 @@ func NewGazeboFromEnv(config *GazeboConfig) (Sim, error) {
 	gazebo := new(Gazebo)
 	gazebo.ExecutablePath = gazeboPath
 	gazebo.Config = config
-	gazebo.TimePath = path.Join(os.Getenv("HOME"), ".gazebo_time")
-	gazebo.StepPath = path.Join(os.Getenv("HOME"), ".gazebo_world_control")
-	gazebo.PositionPath = path.Join(os.Getenv("HOME"), ".gazebo_position")
+	socketDir := config.SocketDir
+	if socketDir == "" {
+		socketDir = os.Getenv("HOME")
+	}
+	gazebo.TimePath = path.Join(socketDir, ".gazebo_time")
+	gazebo.StepPath = path.Join(socketDir, ".gazebo_world_control")
+	gazebo.PositionPath = path.Join(socketDir, ".gazebo_position")
 	gazebo.lastTimeUpdate = -1
 	return gazebo, nil
 }
@@ -11,6 +11,8 @@ type StepActions func()
 
 type Sim interface {
 	Start() error
+	// blocks until the simulator answers requests, or ctx is done
+	Ready(ctx context.Context) error
 	Shutdown(ctx context.Context) error
 	Step(ctx context.Context) error
 	SimTime(ctx context.Context) (time.Time, error)
@@ -28,7 +28,7 @@ func TestFunctionalGazebo(t *testing.T) {
 
 	defer func() {
 		ctx, cc := context.WithTimeout(context.Background(), time.Second*5)
-		gazebo.Stop(ctx)
+		gazebo.Shutdown(ctx)
 		if gazebo.Cmd.ProcessState == nil {
 			t.Fatalf("gazebo appears to still be running")
 		}
@@ -59,7 +59,7 @@ func TestFunctionalGazebo(t *testing.T) {
 
 	ctx, cc = context.WithTimeout(context.Background(), time.Second*5)
 	defer cc()
-	err = gazebo.Stop(ctx)
+	err = gazebo.Shutdown(ctx)
 	if err != nil {
 		t.Fatalf("gazebo could not stop: %s", err)
 	}
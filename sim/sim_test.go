@@ -1,20 +1,27 @@
 package sim
 
 import (
+	"context"
+	"io/ioutil"
 	"math"
+	"net"
+	"os"
+	"path"
 	"testing"
+	"time"
 
+	"github.com/obicons/avis/entities"
 	"github.com/obicons/avis/util"
 )
 
 func TestUnitReadPosition(t *testing.T) {
 	actualX, actualY, actualZ := 10.0, 20.0, 40.0
 	var bytes [24]byte
-	position := Position{}
-	util.HostByteOrder.PutUint64(bytes[0:8], math.Float64bits(actualX))
-	util.HostByteOrder.PutUint64(bytes[8:16], math.Float64bits(actualY))
-	util.HostByteOrder.PutUint64(bytes[16:24], math.Float64bits(actualZ))
-	err := util.ReadPackedStruct(bytes[:], &position)
+	position := entities.Position{}
+	gazeboByteOrder.PutUint64(bytes[0:8], math.Float64bits(actualX))
+	gazeboByteOrder.PutUint64(bytes[8:16], math.Float64bits(actualY))
+	gazeboByteOrder.PutUint64(bytes[16:24], math.Float64bits(actualZ))
+	err := util.ReadPackedStruct(bytes[:], &position, gazeboByteOrder)
 	if err != nil {
 		t.Fatalf("error: ReadPackedStruct() returned an unexpected error")
 	} else if position.X != actualX {
@@ -25,3 +32,100 @@ func TestUnitReadPosition(t *testing.T) {
 		t.Fatalf("error: expected Z = %f, found %f", position.Z, actualZ)
 	}
 }
+
+func TestUnitGazeboReady(t *testing.T) {
+	dir, err := ioutil.TempDir("", "avis-gazebo")
+	if err != nil {
+		t.Fatalf("TempDir() returned an unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	gazebo := &Gazebo{TimePath: path.Join(dir, ".gazebo_time"), lastTimeUpdate: -1}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err = gazebo.Ready(ctx); err == nil {
+		t.Fatalf("expected Ready() to fail without a time socket")
+	}
+
+	// stands in for the avis plugin's time socket
+	listener, err := net.Listen("unix", gazebo.TimePath)
+	if err != nil {
+		t.Fatalf("Listen() returned an unexpected error: %s", err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		conn.Write(make([]byte, 16))
+		conn.Close()
+	}()
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err = gazebo.Ready(ctx); err != nil {
+		t.Fatalf("Ready() returned an unexpected error: %s", err)
+	}
+}
+
+func TestUnitGazeboStepIterationsRace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "avis-gazebo")
+	if err != nil {
+		t.Fatalf("TempDir() returned an unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	gazebo := &Gazebo{StepPath: path.Join(dir, ".gazebo_world_control"), Config: &GazeboConfig{StepSize: 1}}
+
+	// stands in for the avis plugin's step socket
+	listener, err := net.Listen("unix", gazebo.StepPath)
+	if err != nil {
+		t.Fatalf("Listen() returned an unexpected error: %s", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			ioutil.ReadAll(conn)
+			conn.Close()
+		}
+	}()
+
+	// HINJ reads the iteration from its connection goroutines while the controller steps
+	const steps = 100
+	stop := make(chan struct{})
+	readerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		var last uint64
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			iterations := gazebo.Iterations()
+			if iterations < last || iterations > steps {
+				t.Errorf("Iterations() went from %d to %d", last, iterations)
+				return
+			}
+			last = iterations
+		}
+	}()
+
+	for i := 0; i < steps; i++ {
+		if err = gazebo.Step(context.Background()); err != nil {
+			t.Fatalf("Step() returned an unexpected error: %s", err)
+		}
+	}
+	close(stop)
+	<-readerDone
+	if iterations := gazebo.Iterations(); iterations != steps {
+		t.Fatalf("expected %d iterations, found %d", steps, iterations)
+	}
+}
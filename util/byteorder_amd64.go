@@ -1,5 +0,0 @@
-package util
-
-import "encoding/binary"
-
-var HostByteOrder = binary.LittleEndian
@@ -0,0 +1,11 @@
+//go:build mips || mips64 || ppc64 || s390x
+// +build mips mips64 ppc64 s390x
+
+package util
+
+import "encoding/binary"
+
+// The byte order of the machine avis runs on.
+// Only use it for data exchanged with processes on the same machine;
+// protocols should declare their own byte order.
+var HostByteOrder binary.ByteOrder = binary.BigEndian
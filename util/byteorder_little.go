@@ -0,0 +1,11 @@
+//go:build 386 || amd64 || arm || arm64 || loong64 || mips64le || mipsle || ppc64le || riscv64 || wasm
+// +build 386 amd64 arm arm64 loong64 mips64le mipsle ppc64le riscv64 wasm
+
+package util
+
+import "encoding/binary"
+
+// The byte order of the machine avis runs on.
+// Only use it for data exchanged with processes on the same machine;
+// protocols should declare their own byte order.
+var HostByteOrder binary.ByteOrder = binary.LittleEndian
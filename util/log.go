@@ -20,7 +20,7 @@ func NewTempLogger() (*os.File, error) {
 	if file == nil {
 		filename := fmt.Sprintf("/tmp/rmck-%d", time.Now().Unix())
 		var err error
-		file, err = os.Create(filename)
+		file, err = openLogFile(filename)
 		if err != nil {
 			return nil, err
 		}
@@ -37,18 +37,17 @@ func GetLogger(forComponent string) (*log.Logger, error) {
 
 	rmckLogPath := os.Getenv("RMCK_LOG_FILE")
 	if rmckLogPath != "" {
-		stat, err := os.Stat(rmckLogPath)
-		if err == nil && stat.IsDir() {
-			return nil, fmt.Errorf("cannot log to %s: directory", rmckLogPath)
-		} else if err != nil {
-			os.Remove(rmckLogPath)
-		}
-
-		file, err := os.Create(rmckLogPath)
-		if err != nil {
-			return nil, err
+		mut.Lock()
+		defer mut.Unlock()
+		if file == nil || file.Name() != rmckLogPath {
+			stat, err := os.Stat(rmckLogPath)
+			if err == nil && stat.IsDir() {
+				return nil, fmt.Errorf("cannot log to %s: directory", rmckLogPath)
+			}
+			if file, err = openLogFile(rmckLogPath); err != nil {
+				return nil, err
+			}
 		}
-
 		return log.New(file, forComponent, flags), nil
 	}
 
@@ -60,7 +59,35 @@ func GetLogger(forComponent string) (*log.Logger, error) {
 	return log.New(file, forComponent, flags), nil
 }
 
+// Starts a fresh log at filePath. Every logger shares the file, which is opened
+// in append mode, so a logger created mid-run never cuts the log short and each
+// line lands at the end.
+func openLogFile(filePath string) (*os.File, error) {
+	return os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0666)
+}
+
+// Returns the file that loggers from GetLogger write to, or "" if they write to stdout.
+func LogFilePath() string {
+	if os.Getenv("RMCK_DEBUG") != "" {
+		return ""
+	} else if rmckLogPath := os.Getenv("RMCK_LOG_FILE"); rmckLogPath != "" {
+		return rmckLogPath
+	}
+
+	mut.Lock()
+	defer mut.Unlock()
+	if file == nil {
+		return ""
+	}
+	return file.Name()
+}
+
 func LogReader(reader io.Reader, log *log.Logger) {
+	WatchReader(reader, log, nil)
+}
+
+// Logs each line of reader, like LogReader, and passes it to watch if watch is non-nil.
+func WatchReader(reader io.Reader, log *log.Logger, watch func(line string)) {
 	go func() {
 		ch := lines(reader)
 		keepLogging := true
@@ -70,44 +97,60 @@ func LogReader(reader io.Reader, log *log.Logger) {
 				keepLogging = false
 			} else {
 				log.Println(line)
+				if watch != nil {
+					watch(line)
+				}
 			}
 		}
 	}()
 }
 
 func LogProcess(cmd *exec.Cmd, log *log.Logger) error {
+	_, err := WatchProcess(cmd, log, nil)
+	return err
+}
+
+// Logs each line cmd writes to stdout or stderr, and passes it to watch if watch is non-nil.
+// Must be called before cmd starts. Returns a channel that is closed once both are drained.
+func WatchProcess(cmd *exec.Cmd, log *log.Logger, watch func(line string)) (<-chan struct{}, error) {
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	stderr, err := cmd.StderrPipe()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	done := make(chan struct{})
 	go func() {
+		defer close(done)
 		stdoutCh := lines(stdout)
 		stderrCh := lines(stderr)
-		keepLogging := true
-		for keepLogging {
+		// a drained stream's channel is set to nil, so it is no longer selected
+		for stdoutCh != nil || stderrCh != nil {
+			var line string
+			var ok bool
 			select {
-			case line, ok := <-stdoutCh:
+			case line, ok = <-stdoutCh:
 				if !ok {
-					keepLogging = false
-					break
+					stdoutCh = nil
+					continue
 				}
-				log.Println(line)
-			case line, ok := <-stderrCh:
+			case line, ok = <-stderrCh:
 				if !ok {
-					keepLogging = false
-					break
+					stderrCh = nil
+					continue
 				}
-				log.Println(line)
+			}
+			log.Println(line)
+			if watch != nil {
+				watch(line)
 			}
 		}
 	}()
-	return nil
+	return done, nil
 }
 
 func lines(stream io.Reader) <-chan string {
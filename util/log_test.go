@@ -0,0 +1,84 @@
+package util
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUnitWatchProcess(t *testing.T) {
+	var lock sync.Mutex
+	var watched []string
+	cmd := exec.Command("sh", "-c", "echo out; echo err >&2; exec >&-; sleep 0.1; echo late >&2")
+	done, err := WatchProcess(cmd, log.New(ioutil.Discard, "", 0), func(line string) {
+		lock.Lock()
+		defer lock.Unlock()
+		watched = append(watched, line)
+	})
+	if err != nil {
+		t.Fatalf("WatchProcess() returned an unexpected error: %s", err)
+	} else if err = cmd.Start(); err != nil {
+		t.Fatalf("Start() returned an unexpected error: %s", err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the output was never drained")
+	}
+	cmd.Wait()
+
+	lock.Lock()
+	defer lock.Unlock()
+	sort.Strings(watched)
+	// stderr is still read after stdout closes
+	if len(watched) != 3 || watched[0] != "err" || watched[1] != "late" || watched[2] != "out" {
+		t.Fatalf("expected every line of both streams, found %v", watched)
+	}
+}
+
+func TestUnitGetLoggerAppends(t *testing.T) {
+	dir, err := ioutil.TempDir("", "avis-log")
+	if err != nil {
+		t.Fatalf("TempDir() returned an unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	logPath := path.Join(dir, "avis.log")
+	os.Setenv("RMCK_LOG_FILE", logPath)
+	defer os.Unsetenv("RMCK_LOG_FILE")
+	defer func() {
+		mut.Lock()
+		defer mut.Unlock()
+		file.Close()
+		file = nil
+	}()
+
+	first, err := GetLogger("first ")
+	if err != nil {
+		t.Fatalf("GetLogger() returned an unexpected error: %s", err)
+	}
+	first.Println("before")
+	// a component that starts mid-run must not cut the log short
+	second, err := GetLogger("second ")
+	if err != nil {
+		t.Fatalf("GetLogger() returned an unexpected error: %s", err)
+	}
+	second.Println("after")
+
+	contents, err := ioutil.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("ReadFile() returned an unexpected error: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "first ") || !strings.HasPrefix(lines[1], "second ") {
+		t.Fatalf("expected both loggers' lines in order, found %q", contents)
+	}
+}
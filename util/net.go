@@ -0,0 +1,78 @@
+package util
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"strconv"
+)
+
+// Returns the network and address named by u, suitable for net.Listen or net.Dial.
+// unix URLs name a socket path (unix:///path/to.sock).
+// tcp URLs name a host and port (tcp://127.0.0.1:9000); an empty host means every interface.
+func URLNetworkAddress(u *url.URL) (string, string, error) {
+	switch u.Scheme {
+	case "unix":
+		if u.Path == "" {
+			return "", "", fmt.Errorf("error: URLNetworkAddress(): %s has no socket path", u)
+		}
+		return u.Scheme, u.Path, nil
+	case "tcp", "tcp4", "tcp6":
+		if _, _, err := net.SplitHostPort(u.Host); err != nil {
+			return "", "", fmt.Errorf("error: URLNetworkAddress(): %s", err)
+		} else if u.Path != "" && u.Path != "/" {
+			return "", "", fmt.Errorf("error: URLNetworkAddress(): %s has a path; expected host:port", u)
+		}
+		return u.Scheme, u.Host, nil
+	}
+	return "", "", fmt.Errorf("error: URLNetworkAddress(): unsupported scheme %q", u.Scheme)
+}
+
+// Returns the URL one of several side-by-side instances listens on, given the
+// URL a lone instance would use.
+// unix sockets move into dir, keeping their name; tcp ports are offset by offset.
+func InstanceURL(rawURL, dir string, offset int) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	network, address, err := URLNetworkAddress(u)
+	if err != nil {
+		return "", err
+	}
+
+	if network == "unix" {
+		u.Path = path.Join(dir, path.Base(address))
+		return u.String(), nil
+	}
+	host, port, _ := net.SplitHostPort(address)
+	portNo, err := strconv.Atoi(port)
+	if err != nil {
+		return "", fmt.Errorf("error: InstanceURL(): %s has no numeric port", rawURL)
+	}
+	u.Host = net.JoinHostPort(host, strconv.Itoa(portNo+offset))
+	return u.String(), nil
+}
+
+// Returns the gRPC target a client dials to reach a server listening on rawURL.
+// gRPC has no tcp scheme, so tcp URLs become dns targets; an empty host means this machine.
+func GRPCTarget(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	network, address, err := URLNetworkAddress(u)
+	if err != nil {
+		return "", err
+	}
+
+	if network == "unix" {
+		return "unix://" + address, nil
+	}
+	host, port, _ := net.SplitHostPort(address)
+	if host == "" {
+		host = "localhost"
+	}
+	return "dns:///" + net.JoinHostPort(host, port), nil
+}
@@ -0,0 +1,84 @@
+package util
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestUnitURLNetworkAddress(t *testing.T) {
+	cases := []struct {
+		url             string
+		expectedNetwork string
+		expectedAddress string
+	}{
+		{"unix:///home/avis/.hardware_controller", "unix", "/home/avis/.hardware_controller"},
+		{"tcp://127.0.0.1:9000", "tcp", "127.0.0.1:9000"},
+		{"tcp://:9000", "tcp", ":9000"},
+		{"tcp6://[::1]:9000", "tcp6", "[::1]:9000"},
+	}
+	for _, c := range cases {
+		u, err := url.Parse(c.url)
+		if err != nil {
+			t.Fatalf("url.Parse(%s) returned an unexpected error: %s", c.url, err)
+		}
+		network, address, err := URLNetworkAddress(u)
+		if err != nil {
+			t.Fatalf("URLNetworkAddress(%s) returned an unexpected error: %s", c.url, err)
+		} else if network != c.expectedNetwork || address != c.expectedAddress {
+			t.Fatalf("%s: expected %s %s, found %s %s", c.url, c.expectedNetwork, c.expectedAddress, network, address)
+		}
+	}
+
+	for _, bad := range []string{"tcp://127.0.0.1", "tcp://127.0.0.1:9000/path", "unix://", "udp://127.0.0.1:9000"} {
+		u, err := url.Parse(bad)
+		if err != nil {
+			t.Fatalf("url.Parse(%s) returned an unexpected error: %s", bad, err)
+		}
+		if _, _, err := URLNetworkAddress(u); err == nil {
+			t.Fatalf("expected URLNetworkAddress(%s) to fail", bad)
+		}
+	}
+}
+
+func TestUnitInstanceURL(t *testing.T) {
+	cases := []struct {
+		url      string
+		expected string
+	}{
+		{"unix:///home/avis/.hardware_controller", "unix:///tmp/worker-2/.hardware_controller"},
+		{"tcp://127.0.0.1:9000", "tcp://127.0.0.1:9002"},
+		{"tcp6://[::1]:9000", "tcp6://[::1]:9002"},
+	}
+	for _, c := range cases {
+		actual, err := InstanceURL(c.url, "/tmp/worker-2", 2)
+		if err != nil {
+			t.Fatalf("InstanceURL(%s) returned an unexpected error: %s", c.url, err)
+		} else if actual != c.expected {
+			t.Fatalf("%s: expected %s, found %s", c.url, c.expected, actual)
+		}
+	}
+
+	if _, err := InstanceURL("tcp://127.0.0.1:http", "/tmp", 1); err == nil {
+		t.Fatalf("expected InstanceURL() to reject a named port")
+	}
+}
+
+func TestUnitGRPCTarget(t *testing.T) {
+	cases := []struct {
+		url      string
+		expected string
+	}{
+		{"unix:///home/avis/.rmck_rpc", "unix:///home/avis/.rmck_rpc"},
+		{"tcp://127.0.0.1:9000", "dns:///127.0.0.1:9000"},
+		{"tcp://:9000", "dns:///localhost:9000"},
+		{"tcp6://[::1]:9000", "dns:///[::1]:9000"},
+	}
+	for _, c := range cases {
+		actual, err := GRPCTarget(c.url)
+		if err != nil {
+			t.Fatalf("GRPCTarget(%s) returned an unexpected error: %s", c.url, err)
+		} else if actual != c.expected {
+			t.Fatalf("%s: expected %s, found %s", c.url, c.expected, actual)
+		}
+	}
+}
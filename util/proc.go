@@ -41,6 +41,21 @@ func WaitWithContext(ctx context.Context, cmd *exec.Cmd) error {
 	return cmd.Wait()
 }
 
+// Checks condition every interval until it holds, or ctx is done.
+// Returns ctx.Err() in the latter case.
+func WaitUntil(ctx context.Context, interval time.Duration, condition func() bool) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for !condition() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
 // Returns if a process matching name is running
 func IsRunning(name string) (bool, error) {
 	procs, err := process.Processes()
@@ -0,0 +1,26 @@
+package util
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestUnitWaitUntil(t *testing.T) {
+	calls := 0
+	err := WaitUntil(context.Background(), time.Millisecond, func() bool {
+		calls++
+		return calls == 3
+	})
+	if err != nil {
+		t.Fatalf("WaitUntil() returned an unexpected error: %s", err)
+	} else if calls != 3 {
+		t.Fatalf("expected the condition to be checked 3 times, found %d", calls)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err = WaitUntil(ctx, time.Millisecond, func() bool { return false }); err != context.DeadlineExceeded {
+		t.Fatalf("expected WaitUntil() to time out, found %v", err)
+	}
+}
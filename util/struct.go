@@ -1,14 +1,15 @@
 package util
 
 import (
+	"encoding/binary"
 	"fmt"
 	"math"
 	"reflect"
 )
 
-// Reads a packed struct.
-// place must point to a struct with primitive members only
-func ReadPackedStruct(bytes []byte, place interface{}) error {
+// Reads a packed struct whose multi-byte members are encoded in the given byte order.
+// place must point to a struct with primitive members (or arrays thereof) only
+func ReadPackedStruct(bytes []byte, place interface{}, order binary.ByteOrder) error {
 	if place == nil {
 		return fmt.Errorf("error: ReadPackedStruct(): place is nil")
 	}
@@ -19,88 +20,92 @@ func ReadPackedStruct(bytes []byte, place interface{}) error {
 		return fmt.Errorf("error: ReadPackedStruct(): type %s is not a struct", t.Name())
 	}
 
+	var err error
 	for fieldNo := 0; fieldNo < t.NumField(); fieldNo++ {
-		field := t.Field(fieldNo)
-		switch field.Type.Kind() {
-		case reflect.Uint8:
-			if len(bytes) < 1 {
-				return fmt.Errorf("error: not enough bytes to read uint8: %d", len(bytes))
-			}
-			u8 := uint8(bytes[0])
-			val.Field(fieldNo).Set(reflect.ValueOf(u8))
-			bytes = bytes[1:]
-		case reflect.Int8:
-			if len(bytes) < 1 {
-				return fmt.Errorf("error: not enough bytes to read int8: %d", len(bytes))
-			}
-			i8 := int8(bytes[0])
-			val.Field(fieldNo).Set(reflect.ValueOf(i8))
-			bytes = bytes[1:]
-		case reflect.Uint16:
-			if len(bytes) < 2 {
-				return fmt.Errorf("error: not enough bytes to read uint16: %d", len(bytes))
-			}
-			u16 := HostByteOrder.Uint16(bytes[0:2])
-			val.Field(fieldNo).Set(reflect.ValueOf(u16))
-			bytes = bytes[2:]
-		case reflect.Int16:
-			if len(bytes) < 2 {
-				return fmt.Errorf("error: not enough bytes to read int16: %d", len(bytes))
-			}
-			i16 := int16(HostByteOrder.Uint16(bytes[0:2]))
-			val.Field(fieldNo).Set(reflect.ValueOf(i16))
-			bytes = bytes[2:]
-		case reflect.Uint32:
-			if len(bytes) < 4 {
-				return fmt.Errorf("error: not enough bytes to read uint32: %d", len(bytes))
-			}
-			u32 := HostByteOrder.Uint32(bytes[0:4])
-			val.Field(fieldNo).Set(reflect.ValueOf(u32))
-			bytes = bytes[4:]
-		case reflect.Int32:
-			if len(bytes) < 4 {
-				return fmt.Errorf("error: not enough bytes to read int32: %d", len(bytes))
-			}
-			i32 := int32(HostByteOrder.Uint32(bytes[0:4]))
-			val.Field(fieldNo).Set(reflect.ValueOf(i32))
-			bytes = bytes[4:]
-		case reflect.Uint64:
-			if len(bytes) < 8 {
-				return fmt.Errorf("error: not enough bytes to read uint64: %d", len(bytes))
-			}
-			u64 := HostByteOrder.Uint64(bytes[0:8])
-			val.Field(fieldNo).Set(reflect.ValueOf(u64))
-			bytes = bytes[8:]
-		case reflect.Int64:
-			if len(bytes) < 8 {
-				return fmt.Errorf("error: not enough bytes to read int64: %d", len(bytes))
-			}
-			i64 := int64(HostByteOrder.Uint64(bytes[0:8]))
-			val.Field(fieldNo).Set(reflect.ValueOf(i64))
-			bytes = bytes[8:]
-		case reflect.Float32:
-			if len(bytes) < 4 {
-				return fmt.Errorf("error: not enough bytes to read float32: %d", len(bytes))
-			}
-			f32 := math.Float32frombits(HostByteOrder.Uint32(bytes[0:4]))
-			val.Field(fieldNo).Set(reflect.ValueOf(f32))
-			bytes = bytes[4:]
-		case reflect.Float64:
-			if len(bytes) < 8 {
-				return fmt.Errorf("error: not enough bytes to read float64: %d", len(bytes))
-			}
-			f64 := math.Float64frombits(HostByteOrder.Uint64(bytes[0:8]))
-			val.Field(fieldNo).Set(reflect.ValueOf(f64))
-			bytes = bytes[8:]
-
-		default:
-			return fmt.Errorf("error: cannot read non-primitive type %s", field.Type.Name())
+		if bytes, err = readPackedValue(bytes, val.Field(fieldNo), order); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
+// Reads a single primitive (or array of primitives) into v.
+// Returns the bytes that follow it.
+func readPackedValue(bytes []byte, v reflect.Value, order binary.ByteOrder) ([]byte, error) {
+	switch v.Kind() {
+	case reflect.Uint8:
+		if len(bytes) < 1 {
+			return nil, fmt.Errorf("error: not enough bytes to read uint8: %d", len(bytes))
+		}
+		v.SetUint(uint64(bytes[0]))
+		return bytes[1:], nil
+	case reflect.Int8:
+		if len(bytes) < 1 {
+			return nil, fmt.Errorf("error: not enough bytes to read int8: %d", len(bytes))
+		}
+		v.SetInt(int64(int8(bytes[0])))
+		return bytes[1:], nil
+	case reflect.Uint16:
+		if len(bytes) < 2 {
+			return nil, fmt.Errorf("error: not enough bytes to read uint16: %d", len(bytes))
+		}
+		v.SetUint(uint64(order.Uint16(bytes[0:2])))
+		return bytes[2:], nil
+	case reflect.Int16:
+		if len(bytes) < 2 {
+			return nil, fmt.Errorf("error: not enough bytes to read int16: %d", len(bytes))
+		}
+		v.SetInt(int64(int16(order.Uint16(bytes[0:2]))))
+		return bytes[2:], nil
+	case reflect.Uint32:
+		if len(bytes) < 4 {
+			return nil, fmt.Errorf("error: not enough bytes to read uint32: %d", len(bytes))
+		}
+		v.SetUint(uint64(order.Uint32(bytes[0:4])))
+		return bytes[4:], nil
+	case reflect.Int32:
+		if len(bytes) < 4 {
+			return nil, fmt.Errorf("error: not enough bytes to read int32: %d", len(bytes))
+		}
+		v.SetInt(int64(int32(order.Uint32(bytes[0:4]))))
+		return bytes[4:], nil
+	case reflect.Uint64:
+		if len(bytes) < 8 {
+			return nil, fmt.Errorf("error: not enough bytes to read uint64: %d", len(bytes))
+		}
+		v.SetUint(order.Uint64(bytes[0:8]))
+		return bytes[8:], nil
+	case reflect.Int64:
+		if len(bytes) < 8 {
+			return nil, fmt.Errorf("error: not enough bytes to read int64: %d", len(bytes))
+		}
+		v.SetInt(int64(order.Uint64(bytes[0:8])))
+		return bytes[8:], nil
+	case reflect.Float32:
+		if len(bytes) < 4 {
+			return nil, fmt.Errorf("error: not enough bytes to read float32: %d", len(bytes))
+		}
+		v.SetFloat(float64(math.Float32frombits(order.Uint32(bytes[0:4]))))
+		return bytes[4:], nil
+	case reflect.Float64:
+		if len(bytes) < 8 {
+			return nil, fmt.Errorf("error: not enough bytes to read float64: %d", len(bytes))
+		}
+		v.SetFloat(math.Float64frombits(order.Uint64(bytes[0:8])))
+		return bytes[8:], nil
+	case reflect.Array:
+		var err error
+		for i := 0; i < v.Len(); i++ {
+			if bytes, err = readPackedValue(bytes, v.Index(i), order); err != nil {
+				return nil, err
+			}
+		}
+		return bytes, nil
+	}
+	return nil, fmt.Errorf("error: cannot read non-primitive type %s", v.Type().Name())
+}
+
 // returns the size of the packed struct.
 // It is an error to call this function on anything that is not a struct (or a pointer thereto) with primitive-only members.
 func PackedStructSize(theStruct interface{}) (int, error) {
@@ -129,10 +134,10 @@ func PackedStructSize(theStruct interface{}) (int, error) {
 	return size, nil
 }
 
-// Converts theStruct into an array of bytes.
+// Converts theStruct into an array of bytes, encoding multi-byte members in the given byte order.
 // It is an error to call this function on anything that is not a struct (or a pointer thereto) with primitive-only members.
 // len(bytes) must be sufficient to store every member of theStruct.
-func PackedStructToBytes(bytes []byte, theStruct interface{}) error {
+func PackedStructToBytes(bytes []byte, theStruct interface{}, order binary.ByteOrder) error {
 	t := reflect.TypeOf(theStruct)
 	v := reflect.ValueOf(theStruct)
 	if t.Kind() == reflect.Ptr {
@@ -144,74 +149,88 @@ func PackedStructToBytes(bytes []byte, theStruct interface{}) error {
 		return fmt.Errorf("error: PackedStructToBytes() called on non-struct type %s", t.Name())
 	}
 
+	var err error
 	for fieldNo := 0; fieldNo < v.NumField(); fieldNo++ {
-		field := t.Field(fieldNo)
-		switch field.Type.Kind() {
-		case reflect.Uint8:
-			if len(bytes) < 1 {
-				return fmt.Errorf("error: not enough space to write uint8: %d", len(bytes))
-			}
-			bytes[0] = byte(v.Field(fieldNo).Uint())
-			bytes = bytes[1:]
-		case reflect.Int8:
-			if len(bytes) < 1 {
-				return fmt.Errorf("error: not enough space to write int8: %d", len(bytes))
-			}
-			bytes[0] = byte(v.Field(fieldNo).Int())
-			bytes = bytes[1:]
-		case reflect.Uint16:
-			if len(bytes) < 2 {
-				return fmt.Errorf("error: not enough space to write uint16: %d", len(bytes))
-			}
-			HostByteOrder.PutUint16(bytes[:2], uint16(v.Field(fieldNo).Uint()))
-			bytes = bytes[2:]
-		case reflect.Int16:
-			if len(bytes) < 2 {
-				return fmt.Errorf("error: not enough space to write int16: %d", len(bytes))
-			}
-			HostByteOrder.PutUint16(bytes[:2], uint16(v.Field(fieldNo).Int()))
-			bytes = bytes[2:]
-		case reflect.Uint32:
-			if len(bytes) < 4 {
-				return fmt.Errorf("error: not enough space to write uint32: %d", len(bytes))
-			}
-			HostByteOrder.PutUint32(bytes[:4], uint32(v.Field(fieldNo).Uint()))
-			bytes = bytes[4:]
-		case reflect.Int32:
-			if len(bytes) < 4 {
-				return fmt.Errorf("error: not enough space to write int32: %d", len(bytes))
-			}
-			HostByteOrder.PutUint32(bytes[:4], uint32(v.Field(fieldNo).Int()))
-			bytes = bytes[4:]
-		case reflect.Uint64:
-			if len(bytes) < 8 {
-				return fmt.Errorf("error: not enough space to write uint64: %d", len(bytes))
-			}
-			HostByteOrder.PutUint64(bytes[:8], v.Field(fieldNo).Uint())
-			bytes = bytes[8:]
-		case reflect.Int64:
-			if len(bytes) < 8 {
-				return fmt.Errorf("error: not enough space to write int64: %d", len(bytes))
-			}
-			HostByteOrder.PutUint64(bytes[:8], uint64(v.Field(fieldNo).Int()))
-			bytes = bytes[8:]
-		case reflect.Float32:
-			if len(bytes) < 4 {
-				return fmt.Errorf("error: not enough space to write float32: %d", len(bytes))
-			}
-			HostByteOrder.PutUint32(bytes[:4], math.Float32bits(float32(v.Field(fieldNo).Float())))
-			bytes = bytes[4:]
-		case reflect.Float64:
-			if len(bytes) < 8 {
-				return fmt.Errorf("error: not enough bytes to read float64: %d", len(bytes))
-			}
-			HostByteOrder.PutUint64(bytes[:8], math.Float64bits(v.Field(fieldNo).Float()))
-			bytes = bytes[8:]
-
-		default:
-			return fmt.Errorf("error: cannot read non-primitive type %s", field.Type.Name())
+		if bytes, err = writePackedValue(bytes, v.Field(fieldNo), order); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
+
+// Writes a single primitive (or array of primitives) to bytes.
+// Returns the bytes that follow it.
+func writePackedValue(bytes []byte, v reflect.Value, order binary.ByteOrder) ([]byte, error) {
+	switch v.Kind() {
+	case reflect.Uint8:
+		if len(bytes) < 1 {
+			return nil, fmt.Errorf("error: not enough space to write uint8: %d", len(bytes))
+		}
+		bytes[0] = byte(v.Uint())
+		return bytes[1:], nil
+	case reflect.Int8:
+		if len(bytes) < 1 {
+			return nil, fmt.Errorf("error: not enough space to write int8: %d", len(bytes))
+		}
+		bytes[0] = byte(v.Int())
+		return bytes[1:], nil
+	case reflect.Uint16:
+		if len(bytes) < 2 {
+			return nil, fmt.Errorf("error: not enough space to write uint16: %d", len(bytes))
+		}
+		order.PutUint16(bytes[:2], uint16(v.Uint()))
+		return bytes[2:], nil
+	case reflect.Int16:
+		if len(bytes) < 2 {
+			return nil, fmt.Errorf("error: not enough space to write int16: %d", len(bytes))
+		}
+		order.PutUint16(bytes[:2], uint16(v.Int()))
+		return bytes[2:], nil
+	case reflect.Uint32:
+		if len(bytes) < 4 {
+			return nil, fmt.Errorf("error: not enough space to write uint32: %d", len(bytes))
+		}
+		order.PutUint32(bytes[:4], uint32(v.Uint()))
+		return bytes[4:], nil
+	case reflect.Int32:
+		if len(bytes) < 4 {
+			return nil, fmt.Errorf("error: not enough space to write int32: %d", len(bytes))
+		}
+		order.PutUint32(bytes[:4], uint32(v.Int()))
+		return bytes[4:], nil
+	case reflect.Uint64:
+		if len(bytes) < 8 {
+			return nil, fmt.Errorf("error: not enough space to write uint64: %d", len(bytes))
+		}
+		order.PutUint64(bytes[:8], v.Uint())
+		return bytes[8:], nil
+	case reflect.Int64:
+		if len(bytes) < 8 {
+			return nil, fmt.Errorf("error: not enough space to write int64: %d", len(bytes))
+		}
+		order.PutUint64(bytes[:8], uint64(v.Int()))
+		return bytes[8:], nil
+	case reflect.Float32:
+		if len(bytes) < 4 {
+			return nil, fmt.Errorf("error: not enough space to write float32: %d", len(bytes))
+		}
+		order.PutUint32(bytes[:4], math.Float32bits(float32(v.Float())))
+		return bytes[4:], nil
+	case reflect.Float64:
+		if len(bytes) < 8 {
+			return nil, fmt.Errorf("error: not enough space to write float64: %d", len(bytes))
+		}
+		order.PutUint64(bytes[:8], math.Float64bits(v.Float()))
+		return bytes[8:], nil
+	case reflect.Array:
+		var err error
+		for i := 0; i < v.Len(); i++ {
+			if bytes, err = writePackedValue(bytes, v.Index(i), order); err != nil {
+				return nil, err
+			}
+		}
+		return bytes, nil
+	}
+	return nil, fmt.Errorf("error: cannot write non-primitive type %s", v.Type().Name())
+}
@@ -1,6 +1,7 @@
 package util
 
 import (
+	"encoding/binary"
 	"math"
 	"testing"
 )
@@ -38,7 +39,7 @@ var (
 func TestUnitReadPackedStructEmpty(t *testing.T) {
 	var bytes []byte
 	theStruct := emptyStruct{}
-	if err := ReadPackedStruct(bytes, &theStruct); err != nil {
+	if err := ReadPackedStruct(bytes, &theStruct, binary.LittleEndian); err != nil {
 		t.Fatalf("error: ReadPackedStruct() returned an unexpected error: %s", err)
 	}
 }
@@ -47,15 +48,15 @@ func TestUnitReadPackedStructSimple(t *testing.T) {
 	var bytes [40]byte
 	var theStruct simpleStruct
 
-	HostByteOrder.PutUint16(bytes[0:2], expectedU16)
-	HostByteOrder.PutUint16(bytes[2:4], uint16(expectedI16))
-	HostByteOrder.PutUint32(bytes[4:8], expectedU32)
-	HostByteOrder.PutUint32(bytes[8:12], uint32(expectedI32))
-	HostByteOrder.PutUint64(bytes[12:20], expectedU64)
-	HostByteOrder.PutUint64(bytes[20:28], uint64(expectedI64))
-	HostByteOrder.PutUint32(bytes[28:32], math.Float32bits(expectedF32))
-	HostByteOrder.PutUint64(bytes[32:40], math.Float64bits(expectedF64))
-	ReadPackedStruct(bytes[:], &theStruct)
+	binary.LittleEndian.PutUint16(bytes[0:2], expectedU16)
+	binary.LittleEndian.PutUint16(bytes[2:4], uint16(expectedI16))
+	binary.LittleEndian.PutUint32(bytes[4:8], expectedU32)
+	binary.LittleEndian.PutUint32(bytes[8:12], uint32(expectedI32))
+	binary.LittleEndian.PutUint64(bytes[12:20], expectedU64)
+	binary.LittleEndian.PutUint64(bytes[20:28], uint64(expectedI64))
+	binary.LittleEndian.PutUint32(bytes[28:32], math.Float32bits(expectedF32))
+	binary.LittleEndian.PutUint64(bytes[32:40], math.Float64bits(expectedF64))
+	ReadPackedStruct(bytes[:], &theStruct, binary.LittleEndian)
 
 	if theStruct.U16 != expectedU16 {
 		t.Fatalf("Expected U16 = %d, found %d", expectedU16, theStruct.U16)
@@ -136,7 +137,7 @@ func TestUnitPackedStructSizeSimplePtr(t *testing.T) {
 func TestUnitWritePackedStructEmptyValue(t *testing.T) {
 	var buffer []byte
 	theStruct := emptyStruct{}
-	if err := PackedStructToBytes(buffer, theStruct); err != nil {
+	if err := PackedStructToBytes(buffer, theStruct, binary.LittleEndian); err != nil {
 		t.Fatalf("PackedStructToBytes() returned an unexpected error: %s", err)
 	}
 }
@@ -144,7 +145,7 @@ func TestUnitWritePackedStructEmptyValue(t *testing.T) {
 func TestUnitWritePackedStructEmptyPtr(t *testing.T) {
 	var buffer []byte
 	theStruct := emptyStruct{}
-	if err := PackedStructToBytes(buffer, &theStruct); err != nil {
+	if err := PackedStructToBytes(buffer, &theStruct, binary.LittleEndian); err != nil {
 		t.Fatalf("PackedStructToBytes() returned an unexpected error: %s", err)
 	}
 }
@@ -161,18 +162,18 @@ func TestUnitWritePackedStructSimpleValue(t *testing.T) {
 		F32: expectedF32,
 		F64: expectedF64,
 	}
-	if err := PackedStructToBytes(buffer[:], theStruct); err != nil {
+	if err := PackedStructToBytes(buffer[:], theStruct, binary.LittleEndian); err != nil {
 		t.Fatalf("PackedStructToBytes() returned an unexpected error: %s", err)
 	}
 
-	actualU16 := HostByteOrder.Uint16(buffer[:2])
-	actualI16 := int16(HostByteOrder.Uint16(buffer[2:4]))
-	actualU32 := HostByteOrder.Uint32(buffer[4:8])
-	actualI32 := int32(HostByteOrder.Uint32(buffer[8:12]))
-	actualU64 := HostByteOrder.Uint64(buffer[12:20])
-	actualI64 := int64(HostByteOrder.Uint64(buffer[20:28]))
-	actualF32 := math.Float32frombits(HostByteOrder.Uint32(buffer[28:32]))
-	actualF64 := math.Float64frombits(HostByteOrder.Uint64(buffer[32:40]))
+	actualU16 := binary.LittleEndian.Uint16(buffer[:2])
+	actualI16 := int16(binary.LittleEndian.Uint16(buffer[2:4]))
+	actualU32 := binary.LittleEndian.Uint32(buffer[4:8])
+	actualI32 := int32(binary.LittleEndian.Uint32(buffer[8:12]))
+	actualU64 := binary.LittleEndian.Uint64(buffer[12:20])
+	actualI64 := int64(binary.LittleEndian.Uint64(buffer[20:28]))
+	actualF32 := math.Float32frombits(binary.LittleEndian.Uint32(buffer[28:32]))
+	actualF64 := math.Float64frombits(binary.LittleEndian.Uint64(buffer[32:40]))
 
 	if expectedU16 != actualU16 {
 		t.Fatalf("Expected U16 = %d, found %d", expectedU16, actualU16)
@@ -207,3 +208,56 @@ func TestUnitF32Size(t *testing.T) {
 		t.Fatalf("expected size %d, found %d", expected, actual)
 	}
 }
+
+type arrayStruct struct {
+	Count  uint8
+	Values [3]uint16
+}
+
+func TestUnitPackedStructArrayRoundTrip(t *testing.T) {
+	expected := arrayStruct{Count: 3, Values: [3]uint16{1000, 1500, 2000}}
+	size, err := PackedStructSize(&expected)
+	if err != nil {
+		t.Fatalf("PackedStructSize() returned an unexpected error: %s", err)
+	} else if size != 7 {
+		t.Fatalf("expected size = 7, found %d", size)
+	}
+
+	buffer := make([]byte, size)
+	if err := PackedStructToBytes(buffer, &expected, binary.LittleEndian); err != nil {
+		t.Fatalf("PackedStructToBytes() returned an unexpected error: %s", err)
+	} else if binary.LittleEndian.Uint16(buffer[3:5]) != 1500 {
+		t.Fatalf("array element written to the wrong offset")
+	}
+
+	var actual arrayStruct
+	if err := ReadPackedStruct(buffer, &actual, binary.LittleEndian); err != nil {
+		t.Fatalf("ReadPackedStruct() returned an unexpected error: %s", err)
+	} else if actual != expected {
+		t.Fatalf("expected %+v, found %+v", expected, actual)
+	}
+}
+
+func TestUnitReadPackedStructArrayTooShort(t *testing.T) {
+	var actual arrayStruct
+	if err := ReadPackedStruct(make([]byte, 6), &actual, binary.LittleEndian); err == nil {
+		t.Fatalf("expected ReadPackedStruct() to reject a truncated array")
+	}
+}
+
+func TestUnitPackedStructBigEndian(t *testing.T) {
+	expected := arrayStruct{Count: 3, Values: [3]uint16{1000, 1500, 2000}}
+	buffer := make([]byte, 7)
+	if err := PackedStructToBytes(buffer, &expected, binary.BigEndian); err != nil {
+		t.Fatalf("PackedStructToBytes() returned an unexpected error: %s", err)
+	} else if buffer[1] != 0x03 || buffer[2] != 0xE8 {
+		t.Fatalf("expected 1000 to be written most significant byte first, found %x", buffer[1:3])
+	}
+
+	var actual arrayStruct
+	if err := ReadPackedStruct(buffer, &actual, binary.BigEndian); err != nil {
+		t.Fatalf("ReadPackedStruct() returned an unexpected error: %s", err)
+	} else if actual != expected {
+		t.Fatalf("expected %+v, found %+v", expected, actual)
+	}
+}
@@ -19,7 +19,7 @@ DESCRIPTOR = _descriptor.FileDescriptor(
   syntax='proto3',
   serialized_options=b'Z\013/controller',
   create_key=_descriptor._internal_create_key,
-  serialized_pb=b'\n\x1asimulator_controller.proto\x12\ncontroller\"*\n\x05\x45rror\x12\x0c\n\x04\x63ode\x18\x01 \x01(\x05\x12\x13\n\x0b\x65xplanation\x18\x02 \x01(\t\"\r\n\x0bStepRequest\"B\n\x0cStepResponse\x12 \n\x05\x65rror\x18\x01 \x01(\x0b\x32\x11.controller.Error\x12\x10\n\x08hasError\x18\x02 \x01(\x08\"\x11\n\x0fPositionRequest\"3\n\x10PositionResponse\x12\t\n\x01x\x18\x01 \x01(\x01\x12\t\n\x01y\x18\x02 \x01(\x01\x12\t\n\x01z\x18\x03 \x01(\x01\"\r\n\x0bTimeRequest\"a\n\x0cTimeResponse\x12\r\n\x05tvSec\x18\x01 \x01(\x04\x12\x0e\n\x06tvUSec\x18\x02 \x01(\x04\x12\x10\n\x08hasError\x18\x03 \x01(\x08\x12 \n\x05\x65rror\x18\x04 \x01(\x0b\x32\x11.controller.Error\"8\n\x10TerminateRequest\x12\x0f\n\x07\x64idPass\x18\x01 \x01(\x08\x12\x13\n\x0b\x65xplanation\x18\x02 \x01(\t\"\x13\n\x11TerminateResponse\"%\n\x11ModeChangeRequest\x12\x10\n\x08nextMode\x18\x01 \x01(\r\"\x14\n\x12ModeChangeResponse2\xe9\x02\n\x13SimulatorController\x12\x39\n\x04Step\x12\x17.controller.StepRequest\x1a\x18.controller.StepResponse\x12\x45\n\x08Position\x12\x1b.controller.PositionRequest\x1a\x1c.controller.PositionResponse\x12\x39\n\x04Time\x12\x17.controller.TimeRequest\x1a\x18.controller.TimeResponse\x12H\n\tTerminate\x12\x1c.controller.TerminateRequest\x1a\x1d.controller.TerminateResponse\x12K\n\nModeChange\x12\x1d.controller.ModeChangeRequest\x1a\x1e.controller.ModeChangeResponseB\rZ\x0b/controllerb\x06proto3'
+  serialized_pb=b'\n\x1asimulator_controller.proto\x12\ncontroller\"*\n\x05\x45rror\x12\x0c\n\x04\x63ode\x18\x01 \x01(\x05\x12\x13\n\x0b\x65xplanation\x18\x02 \x01(\t\"\r\n\x0bStepRequest\"B\n\x0cStepResponse\x12 \n\x05\x65rror\x18\x01 \x01(\x0b\x32\x11.controller.Error\x12\x10\n\x08hasError\x18\x02 \x01(\x08\"\x11\n\x0fPositionRequest\"3\n\x10PositionResponse\x12\t\n\x01x\x18\x01 \x01(\x01\x12\t\n\x01y\x18\x02 \x01(\x01\x12\t\n\x01z\x18\x03 \x01(\x01\"\r\n\x0bTimeRequest\"a\n\x0cTimeResponse\x12\r\n\x05tvSec\x18\x01 \x01(\x04\x12\x0e\n\x06tvUSec\x18\x02 \x01(\x04\x12\x10\n\x08hasError\x18\x03 \x01(\x08\x12 \n\x05\x65rror\x18\x04 \x01(\x0b\x32\x11.controller.Error\"8\n\x10TerminateRequest\x12\x0f\n\x07\x64idPass\x18\x01 \x01(\x08\x12\x13\n\x0b\x65xplanation\x18\x02 \x01(\t\"\x13\n\x11TerminateResponse\"%\n\x11ModeChangeRequest\x12\x10\n\x08nextMode\x18\x01 \x01(\r\"\x14\n\x12ModeChangeResponse\" \n\x0fSetRulesRequest\x12\r\n\x05rules\x18\x01 \x01(\t\"\x12\n\x10SetRulesResponse2\xb0\x03\n\x13SimulatorController\x12\x39\n\x04Step\x12\x17.controller.StepRequest\x1a\x18.controller.StepResponse\x12\x45\n\x08Position\x12\x1b.controller.PositionRequest\x1a\x1c.controller.PositionResponse\x12\x39\n\x04Time\x12\x17.controller.TimeRequest\x1a\x18.controller.TimeResponse\x12H\n\tTerminate\x12\x1c.controller.TerminateRequest\x1a\x1d.controller.TerminateResponse\x12K\n\nModeChange\x12\x1d.controller.ModeChangeRequest\x1a\x1e.controller.ModeChangeResponse\x12\x45\n\x08SetRules\x12\x1b.controller.SetRulesRequest\x1a\x1c.controller.SetRulesResponseB\rZ\x0b/controllerb\x06proto3'
 )
 
 
@@ -397,6 +397,63 @@ _MODECHANGERESPONSE = _descriptor.Descriptor(
   serialized_end=493,
 )
 
+
+_SETRULESREQUEST = _descriptor.Descriptor(
+  name='SetRulesRequest',
+  full_name='controller.SetRulesRequest',
+  filename=None,
+  file=DESCRIPTOR,
+  containing_type=None,
+  create_key=_descriptor._internal_create_key,
+  fields=[
+    _descriptor.FieldDescriptor(
+      name='rules', full_name='controller.SetRulesRequest.rules', index=0,
+      number=1, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=b"".decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      serialized_options=None, file=DESCRIPTOR,  create_key=_descriptor._internal_create_key),
+  ],
+  extensions=[
+  ],
+  nested_types=[],
+  enum_types=[
+  ],
+  serialized_options=None,
+  is_extendable=False,
+  syntax='proto3',
+  extension_ranges=[],
+  oneofs=[
+  ],
+  serialized_start=495,
+  serialized_end=527,
+)
+
+
+_SETRULESRESPONSE = _descriptor.Descriptor(
+  name='SetRulesResponse',
+  full_name='controller.SetRulesResponse',
+  filename=None,
+  file=DESCRIPTOR,
+  containing_type=None,
+  create_key=_descriptor._internal_create_key,
+  fields=[
+  ],
+  extensions=[
+  ],
+  nested_types=[],
+  enum_types=[
+  ],
+  serialized_options=None,
+  is_extendable=False,
+  syntax='proto3',
+  extension_ranges=[],
+  oneofs=[
+  ],
+  serialized_start=529,
+  serialized_end=547,
+)
+
 _STEPRESPONSE.fields_by_name['error'].message_type = _ERROR
 _TIMERESPONSE.fields_by_name['error'].message_type = _ERROR
 DESCRIPTOR.message_types_by_name['Error'] = _ERROR
@@ -410,6 +467,8 @@ DESCRIPTOR.message_types_by_name['TerminateRequest'] = _TERMINATEREQUEST
 DESCRIPTOR.message_types_by_name['TerminateResponse'] = _TERMINATERESPONSE
 DESCRIPTOR.message_types_by_name['ModeChangeRequest'] = _MODECHANGEREQUEST
 DESCRIPTOR.message_types_by_name['ModeChangeResponse'] = _MODECHANGERESPONSE
+DESCRIPTOR.message_types_by_name['SetRulesRequest'] = _SETRULESREQUEST
+DESCRIPTOR.message_types_by_name['SetRulesResponse'] = _SETRULESRESPONSE
 _sym_db.RegisterFileDescriptor(DESCRIPTOR)
 
 Error = _reflection.GeneratedProtocolMessageType('Error', (_message.Message,), {
@@ -489,6 +548,20 @@ ModeChangeResponse = _reflection.GeneratedProtocolMessageType('ModeChangeRespons
   })
 _sym_db.RegisterMessage(ModeChangeResponse)
 
+SetRulesRequest = _reflection.GeneratedProtocolMessageType('SetRulesRequest', (_message.Message,), {
+  'DESCRIPTOR' : _SETRULESREQUEST,
+  '__module__' : 'simulator_controller_pb2'
+  # @@protoc_insertion_point(class_scope:controller.SetRulesRequest)
+  })
+_sym_db.RegisterMessage(SetRulesRequest)
+
+SetRulesResponse = _reflection.GeneratedProtocolMessageType('SetRulesResponse', (_message.Message,), {
+  'DESCRIPTOR' : _SETRULESRESPONSE,
+  '__module__' : 'simulator_controller_pb2'
+  # @@protoc_insertion_point(class_scope:controller.SetRulesResponse)
+  })
+_sym_db.RegisterMessage(SetRulesResponse)
+
 
 DESCRIPTOR._options = None
 
@@ -499,8 +572,8 @@ _SIMULATORCONTROLLER = _descriptor.ServiceDescriptor(
   index=0,
   serialized_options=None,
   create_key=_descriptor._internal_create_key,
-  serialized_start=496,
-  serialized_end=857,
+  serialized_start=550,
+  serialized_end=982,
   methods=[
   _descriptor.MethodDescriptor(
     name='Step',
@@ -552,6 +625,16 @@ _SIMULATORCONTROLLER = _descriptor.ServiceDescriptor(
     serialized_options=None,
     create_key=_descriptor._internal_create_key,
   ),
+  _descriptor.MethodDescriptor(
+    name='SetRules',
+    full_name='controller.SimulatorController.SetRules',
+    index=5,
+    containing_service=None,
+    input_type=_SETRULESREQUEST,
+    output_type=_SETRULESRESPONSE,
+    serialized_options=None,
+    create_key=_descriptor._internal_create_key,
+  ),
 ])
 _sym_db.RegisterServiceDescriptor(_SIMULATORCONTROLLER)
 
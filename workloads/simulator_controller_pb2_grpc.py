@@ -39,6 +39,11 @@ class SimulatorControllerStub(object):
                 request_serializer=simulator__controller__pb2.ModeChangeRequest.SerializeToString,
                 response_deserializer=simulator__controller__pb2.ModeChangeResponse.FromString,
                 )
+        self.SetRules = channel.unary_unary(
+                '/controller.SimulatorController/SetRules',
+                request_serializer=simulator__controller__pb2.SetRulesRequest.SerializeToString,
+                response_deserializer=simulator__controller__pb2.SetRulesResponse.FromString,
+                )
 
 
 class SimulatorControllerServicer(object):
@@ -74,6 +79,12 @@ class SimulatorControllerServicer(object):
         context.set_details('Method not implemented!')
         raise NotImplementedError('Method not implemented!')
 
+    def SetRules(self, request, context):
+        """Missing associated documentation comment in .proto file."""
+        context.set_code(grpc.StatusCode.UNIMPLEMENTED)
+        context.set_details('Method not implemented!')
+        raise NotImplementedError('Method not implemented!')
+
 
 def add_SimulatorControllerServicer_to_server(servicer, server):
     rpc_method_handlers = {
@@ -102,6 +113,11 @@ def add_SimulatorControllerServicer_to_server(servicer, server):
                     request_deserializer=simulator__controller__pb2.ModeChangeRequest.FromString,
                     response_serializer=simulator__controller__pb2.ModeChangeResponse.SerializeToString,
             ),
+            'SetRules': grpc.unary_unary_rpc_method_handler(
+                    servicer.SetRules,
+                    request_deserializer=simulator__controller__pb2.SetRulesRequest.FromString,
+                    response_serializer=simulator__controller__pb2.SetRulesResponse.SerializeToString,
+            ),
     }
     generic_handler = grpc.method_handlers_generic_handler(
             'controller.SimulatorController', rpc_method_handlers)
@@ -196,3 +212,20 @@ class SimulatorController(object):
             simulator__controller__pb2.ModeChangeResponse.FromString,
             options, channel_credentials,
             insecure, call_credentials, compression, wait_for_ready, timeout, metadata)
+
+    @staticmethod
+    def SetRules(request,
+            target,
+            options=(),
+            channel_credentials=None,
+            call_credentials=None,
+            insecure=False,
+            compression=None,
+            wait_for_ready=None,
+            timeout=None,
+            metadata=None):
+        return grpc.experimental.unary_unary(request, target, '/controller.SimulatorController/SetRules',
+            simulator__controller__pb2.SetRulesRequest.SerializeToString,
+            simulator__controller__pb2.SetRulesResponse.FromString,
+            options, channel_credentials,
+            insecure, call_credentials, compression, wait_for_ready, timeout, metadata)
@@ -20,7 +20,7 @@ class TakeoffAndHover(Target):
 
 if __name__ == '__main__':
     t = TakeoffAndHover(
-        'udp:127.0.0.1:14550',
+        get_mavlink_addr(),
         get_rpc_addr(),
         get_RAL()
     )
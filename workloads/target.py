@@ -6,11 +6,21 @@ from abc import ABC, abstractmethod
 from pymavlink import mavutil
 from time import sleep
 
+def grpc_target(addr: str) -> str:
+    # gRPC has no tcp scheme, so avis' tcp://host:port becomes a dns target
+    for scheme in ('tcp://', 'tcp4://', 'tcp6://'):
+        if addr.startswith(scheme):
+            host_port = addr[len(scheme):].rstrip('/')
+            if host_port.startswith(':'):
+                host_port = 'localhost' + host_port
+            return 'dns:///' + host_port
+    return addr
+
 # The robot abstraction layer
 class RAL(ABC):
     def __init__(self, mav_addr, rpc_addr):
         self.address = mav_addr
-        self.channel = grpc.insecure_channel(rpc_addr)
+        self.channel = grpc.insecure_channel(grpc_target(rpc_addr))
         self.stub = simulator_controller_pb2_grpc.SimulatorControllerStub(self.channel)
         self.mav = mavutil.mavlink_connection(mav_addr)
         self.mav_addr = mav_addr
@@ -52,11 +62,15 @@ class RAL(ABC):
         return self.stub.Position(simulator_controller_pb2.PositionRequest())
 
     def pass_test(self):
-        return self.stub.Terminate(simulator_controller_pb2.TerminateRequest())
+        return self.stub.Terminate(simulator_controller_pb2.TerminateRequest(didPass=True))
 
     def change_mode(self, mode_no):
         return self.stub.ModeChange(simulator_controller_pb2.ModeChangeRequest(nextMode=mode_no))
 
+    def set_rules(self, rules: str):
+        '''Replaces the HINJ rules in effect with the JSON rule set in rules; '' removes them'''
+        return self.stub.SetRules(simulator_controller_pb2.SetRulesRequest(rules=rules))
+
     def arm_system(self):
         '''Arms the system for takeoff'''
         verified = False
@@ -18,4 +18,10 @@ def get_RAL() -> type:
     return RALS[platform]
 
 def get_rpc_addr() -> str:
+    # avis sets this when it runs several workers side by side
+    if os.getenv('AVIS_RPC_ADDR'):
+        return target.grpc_target(os.getenv('AVIS_RPC_ADDR'))
     return 'unix://' + os.path.join(os.getenv('HOME'), '.rmck_rpc')
+
+def get_mavlink_addr() -> str:
+    return os.getenv('AVIS_MAVLINK_ADDR', 'udp:127.0.0.1:14550')
@@ -52,7 +52,7 @@ class Waypoint(Target):
 
 if __name__ == '__main__':
     t = Waypoint(
-        'udp:127.0.0.1:14550',
+        get_mavlink_addr(),
         get_rpc_addr(),
         get_RAL()
     )